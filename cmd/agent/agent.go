@@ -15,14 +15,15 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/signals"
 	"github.com/OpenCIDN/OpenCIDN/pkg/blobs"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/signing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/gorilla/handlers"
 	"github.com/spf13/cobra"
 	"github.com/wzshiming/httpseek"
-	"github.com/wzshiming/sss"
 )
 
 func main() {
@@ -38,14 +39,23 @@ type flagpole struct {
 	BigStorageURL  string
 	BigStorageSize int
 
+	HotStorageURL     string
+	HotStorageSize    int64
+	HotStorageMinHits int
+
 	StorageURL    string
 	RedirectLinks string
 	LinkExpires   time.Duration
 	SignLink      bool
 
-	Userpass      []string
-	Retry         int
-	RetryInterval time.Duration
+	Userpass          []string
+	UserFiles         []string
+	UserEnvs          []string
+	DockerConfig      string
+	CredentialHelpers []string
+	Mirrors           []string
+	Retry             int
+	RetryInterval     time.Duration
 
 	Behind         bool
 	Address        string
@@ -61,17 +71,25 @@ type flagpole struct {
 	BlobNoRedirectMaxSizePerSecond int
 	BlobCacheDuration              time.Duration
 	ForceBlobNoRedirect            bool
+	BlobAccessFlushInterval        time.Duration
+	ScrubInterval                  time.Duration
+	ScrubMaxSizePerSecond          int
+	RepositoryCheck                bool
 
 	Concurrency int
 
 	QueueURL   string
 	QueueToken string
+
+	MetricsAddress string
+	OTLPEndpoint   string
 }
 
 func NewCommand() *cobra.Command {
 	flags := &flagpole{
 		Address:           ":18002",
 		BlobCacheDuration: time.Hour,
+		HotStorageMinHits: 2,
 		Concurrency:       10,
 		SignLink:          true,
 		LinkExpires:       1 * time.Hour,
@@ -85,14 +103,22 @@ func NewCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url")
+	cmd.Flags().StringVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url, file:///path for a local directory")
 	cmd.Flags().StringVar(&flags.BigStorageURL, "big-storage-url", flags.BigStorageURL, "Big storage driver url")
 	cmd.Flags().IntVar(&flags.BigStorageSize, "big-storage-size", flags.BigStorageSize, "Big storage size")
+	cmd.Flags().StringVar(&flags.HotStorageURL, "hot-storage-url", flags.HotStorageURL, "Hot storage driver url, usually file:///path on local disk, keeps the most served blobs to serve them directly")
+	cmd.Flags().Int64Var(&flags.HotStorageSize, "hot-storage-size", flags.HotStorageSize, "Hot storage capacity in bytes, the least recently used blobs are evicted beyond it")
+	cmd.Flags().IntVar(&flags.HotStorageMinHits, "hot-storage-min-hits", flags.HotStorageMinHits, "Times a blob is served before it is copied to the hot storage")
 	cmd.Flags().StringVar(&flags.RedirectLinks, "redirect-links", flags.RedirectLinks, "Redirect links")
 	cmd.Flags().DurationVar(&flags.LinkExpires, "link-expires", flags.LinkExpires, "Link expires")
 	cmd.Flags().BoolVar(&flags.SignLink, "sign-link", flags.SignLink, "Sign Link")
 
-	cmd.Flags().StringSliceVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host")
+	cmd.Flags().StringSliceVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host, repeat for a host to rotate across several accounts, use <token>:refresh-token@host or <registry-token>:token@host for token auth")
+	cmd.Flags().StringArrayVar(&flags.UserFiles, "user-file", flags.UserFiles, "File with one user:pwd@host per line, read again when it changes")
+	cmd.Flags().StringArrayVar(&flags.UserEnvs, "user-env", flags.UserEnvs, "Environment variable holding user:pwd@host entries separated by whitespace")
+	cmd.Flags().StringArrayVar(&flags.CredentialHelpers, "credential-helper", flags.CredentialHelpers, "Docker credential helper exchanging short-lived credentials for a host, like: 123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login")
+	cmd.Flags().StringVar(&flags.DockerConfig, "docker-config", flags.DockerConfig, "Docker config.json to resolve upstream credentials from, including credential helpers")
+	cmd.Flags().StringArrayVar(&flags.Mirrors, "mirror", flags.Mirrors, "Ordered upstream endpoints for a registry host, like: registry-1.docker.io=harbor.internal/dockerhub,registry-1.docker.io")
 	cmd.Flags().IntVar(&flags.Retry, "retry", flags.Retry, "Retry")
 	cmd.Flags().DurationVar(&flags.RetryInterval, "retry-interval", flags.RetryInterval, "Retry interval")
 
@@ -110,12 +136,19 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().IntVar(&flags.BlobNoRedirectMaxSizePerSecond, "blob-no-redirect-max-size-per-second", flags.BlobNoRedirectMaxSizePerSecond, "Maximum size per second for no redirect")
 	cmd.Flags().DurationVar(&flags.BlobCacheDuration, "blob-cache-duration", flags.BlobCacheDuration, "Blob cache duration")
 	cmd.Flags().BoolVar(&flags.ForceBlobNoRedirect, "force-blob-no-redirect", flags.ForceBlobNoRedirect, "Force blob no redirect")
+	cmd.Flags().DurationVar(&flags.BlobAccessFlushInterval, "blob-access-flush-interval", flags.BlobAccessFlushInterval, "Record when blobs are served and write the access times to storage at this interval, for LRU eviction by gc")
+	cmd.Flags().DurationVar(&flags.ScrubInterval, "scrub-interval", flags.ScrubInterval, "Re-hash stored blobs at this interval, quarantining and fetching again the corrupted ones")
+	cmd.Flags().IntVar(&flags.ScrubMaxSizePerSecond, "scrub-max-size-per-second", flags.ScrubMaxSizePerSecond, "Scrub max size per second")
+	cmd.Flags().BoolVar(&flags.RepositoryCheck, "repository-check", flags.RepositoryCheck, "Only serve cached blobs under repositories with a cached manifest referencing them")
 
 	cmd.Flags().IntVar(&flags.Concurrency, "concurrency", flags.Concurrency, "Concurrency to source")
 
 	cmd.Flags().StringVar(&flags.QueueToken, "queue-token", flags.QueueToken, "Queue token")
 	cmd.Flags().StringVar(&flags.QueueURL, "queue-url", flags.QueueURL, "Queue URL")
 
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+	cmd.Flags().StringVar(&flags.OTLPEndpoint, "otlp-endpoint", flags.OTLPEndpoint, "OTLP/HTTP endpoint to export traces to, like: http://localhost:4318")
+
 	return cmd
 }
 
@@ -126,19 +159,27 @@ func runE(ctx context.Context, flags *flagpole) error {
 
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
+	if flags.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(ctx, "agent", flags.OTLPEndpoint)
+		if err != nil {
+			return fmt.Errorf("setup tracing failed: %w", err)
+		}
+		defer shutdown(context.Background())
+	}
+
 	cacheOpts := []cache.Option{
 		cache.WithSignLink(flags.SignLink),
 	}
 
-	sd, err := sss.NewSSS(sss.WithURL(flags.StorageURL))
-	if err != nil {
-		return fmt.Errorf("create storage driver failed: %w", err)
-	}
-	cacheOpts = append(cacheOpts, cache.WithStorageDriver(sd))
+	cacheOpts = append(cacheOpts, cache.WithStorageURL(flags.StorageURL))
 	if flags.LinkExpires > 0 {
 		cacheOpts = append(cacheOpts, cache.WithLinkExpires(flags.LinkExpires))
 	}
 
+	if flags.BlobAccessFlushInterval > 0 {
+		cacheOpts = append(cacheOpts, cache.WithAccessFlushInterval(flags.BlobAccessFlushInterval))
+	}
+
 	if flags.RedirectLinks != "" {
 		u, err := url.Parse(flags.RedirectLinks)
 		if err != nil {
@@ -151,6 +192,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 	if err != nil {
 		return fmt.Errorf("create cache failed: %w", err)
 	}
+	defer sdcache.StartAccessTracker(ctx, logger)()
 
 	blobsOpts = append(blobsOpts,
 		blobs.WithCache(sdcache),
@@ -159,29 +201,40 @@ func runE(ctx context.Context, flags *flagpole) error {
 		blobs.WithBlobNoRedirectMaxSizePerSecond(flags.BlobNoRedirectMaxSizePerSecond),
 		blobs.WithBlobCacheDuration(flags.BlobCacheDuration),
 		blobs.WithForceBlobNoRedirect(flags.ForceBlobNoRedirect),
+		blobs.WithScrubInterval(flags.ScrubInterval),
+		blobs.WithScrubMaxSizePerSecond(flags.ScrubMaxSizePerSecond),
+		blobs.WithRepositoryCheck(flags.RepositoryCheck),
 		blobs.WithConcurrency(flags.Concurrency),
 	)
 
 	if flags.BigStorageURL != "" && flags.BigStorageSize > 0 {
 		bigCacheOpts := []cache.Option{}
-		sd, err := sss.NewSSS(sss.WithURL(flags.BigStorageURL))
-		if err != nil {
-			return fmt.Errorf("create storage driver failed: %w", err)
-		}
 		bigCacheOpts = append(bigCacheOpts,
 			cache.WithSignLink(flags.SignLink),
-			cache.WithStorageDriver(sd),
+			cache.WithStorageURL(flags.BigStorageURL),
 		)
 		if flags.LinkExpires > 0 {
 			bigCacheOpts = append(bigCacheOpts, cache.WithLinkExpires(flags.LinkExpires))
 		}
+		if flags.BlobAccessFlushInterval > 0 {
+			bigCacheOpts = append(bigCacheOpts, cache.WithAccessFlushInterval(flags.BlobAccessFlushInterval))
+		}
 		bigsdcache, err := cache.NewCache(bigCacheOpts...)
 		if err != nil {
 			return fmt.Errorf("create cache failed: %w", err)
 		}
+		defer bigsdcache.StartAccessTracker(ctx, logger)()
 		blobsOpts = append(blobsOpts, blobs.WithBigCache(bigsdcache, flags.BigStorageSize))
 	}
 
+	if flags.HotStorageURL != "" && flags.HotStorageSize > 0 {
+		hotsdcache, err := cache.NewCache(cache.WithStorageURL(flags.HotStorageURL))
+		if err != nil {
+			return fmt.Errorf("create hot cache failed: %w", err)
+		}
+		blobsOpts = append(blobsOpts, blobs.WithHotCache(hotsdcache, flags.HotStorageSize, flags.HotStorageMinHits))
+	}
+
 	if flags.QueueURL != "" {
 		queueClient := client.NewMessageClient(http.DefaultClient, flags.QueueURL, flags.QueueToken)
 		blobsOpts = append(blobsOpts, blobs.WithQueueClient(queueClient))
@@ -201,11 +254,30 @@ func runE(ctx context.Context, flags *flagpole) error {
 		blobsOpts = append(blobsOpts, blobs.WithAuthenticator(authenticator))
 	}
 
+	rateLimits := transport.NewRateLimits()
 	transportOpts := []transport.Option{
 		transport.WithUserAndPass(flags.Userpass),
+		transport.WithMirrors(flags.Mirrors),
+		transport.WithRateLimits(rateLimits),
 		transport.WithLogger(logger),
 	}
 
+	if len(flags.UserFiles) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserFiles(flags.UserFiles))
+	}
+
+	if len(flags.UserEnvs) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserEnvs(flags.UserEnvs))
+	}
+
+	if len(flags.CredentialHelpers) != 0 {
+		transportOpts = append(transportOpts, transport.WithCredentialHelpers(flags.CredentialHelpers))
+	}
+
+	if flags.DockerConfig != "" {
+		transportOpts = append(transportOpts, transport.WithKeychain(transport.NewDockerConfigKeychain(flags.DockerConfig)))
+	}
+
 	tp, err := transport.NewTransport(transportOpts...)
 	if err != nil {
 		return fmt.Errorf("create clientset failed: %w", err)
@@ -228,6 +300,8 @@ func runE(ctx context.Context, flags *flagpole) error {
 		})
 	}
 
+	tp = transport.NewMetricsTransport(tp)
+	tp = transport.NewTracingTransport(tp)
 	tp = transport.NewLogTransport(tp, logger, time.Minute)
 
 	httpClient := &http.Client{
@@ -248,7 +322,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 		},
 		Transport: tp,
 	}
-	blobsOpts = append(blobsOpts, blobs.WithClient(httpClient))
+	blobsOpts = append(blobsOpts, blobs.WithClient(httpClient), blobs.WithRateLimits(rateLimits))
 
 	a, err := blobs.NewBlobs(blobsOpts...)
 	if err != nil {
@@ -258,11 +332,21 @@ func runE(ctx context.Context, flags *flagpole) error {
 	mux.Handle("/v2/", a)
 
 	var handler http.Handler = mux
+	handler = tracing.NewHandler("agent", handler)
 	handler = handlers.LoggingHandler(os.Stderr, handler)
 	if flags.Behind {
 		handler = handlers.ProxyHeaders(handler)
 	}
 
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
 	err = server.Run(ctx, flags.Address, handler, flags.AcmeHosts, flags.AcmeCacheDir, flags.CertFile, flags.PrivateKeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to run server: %w", err)
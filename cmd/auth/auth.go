@@ -17,6 +17,7 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/server"
 	"github.com/OpenCIDN/OpenCIDN/internal/signals"
 	"github.com/OpenCIDN/OpenCIDN/pkg/auth"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/signing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
 	"github.com/emicklei/go-restful/v3"
@@ -56,6 +57,8 @@ type flagpole struct {
 	BlobsURLs []string
 
 	DBURL string
+
+	MetricsAddress string
 }
 
 func NewCommand() *cobra.Command {
@@ -94,6 +97,8 @@ func NewCommand() *cobra.Command {
 
 	cmd.Flags().StringVar(&flags.DBURL, "db-url", flags.DBURL, "Database URL")
 
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+
 	return cmd
 }
 
@@ -226,6 +231,15 @@ func runE(ctx context.Context, flags *flagpole) error {
 		handlers.AllowedOrigins([]string{"*"}),
 	)(handler)
 
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
 	err = server.Run(ctx, flags.Address, handler, flags.AcmeHosts, flags.AcmeCacheDir, flags.CertFile, flags.PrivateKeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to run server: %w", err)
@@ -20,14 +20,15 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
 	"github.com/OpenCIDN/OpenCIDN/pkg/gateway"
 	"github.com/OpenCIDN/OpenCIDN/pkg/manifests"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/signing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/gorilla/handlers"
 	"github.com/spf13/cobra"
 	"github.com/wzshiming/httpseek"
-	"github.com/wzshiming/sss"
 )
 
 func main() {
@@ -43,18 +44,31 @@ type flagpole struct {
 	BigStorageURL  string
 	BigStorageSize int
 
+	HotStorageURL     string
+	HotStorageSize    int64
+	HotStorageMinHits int
+
 	StorageURL    string
 	RedirectLinks string
 	LinkExpires   time.Duration
 	SignLink      bool
 
 	ManifestCacheDuration  time.Duration
+	ManifestMaxStale       time.Duration
+	Offline                bool
+	ManifestConvert        bool
 	RecacheMaxWaitDuration time.Duration
 
-	Userpass        []string
-	Retry           int
-	RetryInterval   time.Duration
-	DisableTagsList bool
+	Userpass          []string
+	UserFiles         []string
+	UserEnvs          []string
+	DockerConfig      string
+	CredentialHelpers []string
+	Mirrors           []string
+	Retry             int
+	RetryInterval     time.Duration
+	DisableTagsList   bool
+	CachedCatalog     bool
 
 	Behind         bool
 	Address        string
@@ -72,6 +86,10 @@ type flagpole struct {
 	BlobNoRedirectMaxSizePerSecond int
 	BlobCacheDuration              time.Duration
 	ForceBlobNoRedirect            bool
+	BlobAccessFlushInterval        time.Duration
+	ScrubInterval                  time.Duration
+	ScrubMaxSizePerSecond          int
+	RepositoryCheck                bool
 
 	DefaultRegistry         string
 	OverrideDefaultRegistry map[string]string
@@ -82,12 +100,16 @@ type flagpole struct {
 
 	QueueURL   string
 	QueueToken string
+
+	MetricsAddress string
+	OTLPEndpoint   string
 }
 
 func NewCommand() *cobra.Command {
 	flags := &flagpole{
 		Address:               ":18001",
 		BlobCacheDuration:     time.Hour,
+		HotStorageMinHits:     2,
 		ManifestCacheDuration: time.Hour,
 		Concurrency:           10,
 		SignLink:              true,
@@ -102,20 +124,32 @@ func NewCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url")
+	cmd.Flags().StringVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url, file:///path for a local directory")
 	cmd.Flags().StringVar(&flags.BigStorageURL, "big-storage-url", flags.BigStorageURL, "Big storage driver url")
 	cmd.Flags().IntVar(&flags.BigStorageSize, "big-storage-size", flags.BigStorageSize, "Big storage size")
+	cmd.Flags().StringVar(&flags.HotStorageURL, "hot-storage-url", flags.HotStorageURL, "Hot storage driver url, usually file:///path on local disk, keeps the most served blobs to serve them directly")
+	cmd.Flags().Int64Var(&flags.HotStorageSize, "hot-storage-size", flags.HotStorageSize, "Hot storage capacity in bytes, the least recently used blobs are evicted beyond it")
+	cmd.Flags().IntVar(&flags.HotStorageMinHits, "hot-storage-min-hits", flags.HotStorageMinHits, "Times a blob is served before it is copied to the hot storage")
 	cmd.Flags().StringVar(&flags.RedirectLinks, "redirect-links", flags.RedirectLinks, "Redirect links")
 	cmd.Flags().DurationVar(&flags.LinkExpires, "link-expires", flags.LinkExpires, "Link expires")
 	cmd.Flags().BoolVar(&flags.SignLink, "sign-link", flags.SignLink, "Sign Link")
 
 	cmd.Flags().DurationVar(&flags.ManifestCacheDuration, "manifest-cache-duration", flags.ManifestCacheDuration, "Manifest cache duration")
+	cmd.Flags().DurationVar(&flags.ManifestMaxStale, "manifest-max-stale", flags.ManifestMaxStale, "Maximum age of a cached tag served while refreshing in the background, 0 means no limit")
 	cmd.Flags().DurationVar(&flags.RecacheMaxWaitDuration, "recache-max-wait-duration", flags.RecacheMaxWaitDuration, "Recache max wait duration")
-
-	cmd.Flags().StringSliceVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host")
+	cmd.Flags().BoolVar(&flags.Offline, "offline", flags.Offline, "Never contact upstream for manifests already in the cache")
+	cmd.Flags().BoolVar(&flags.ManifestConvert, "manifest-convert", flags.ManifestConvert, "Convert manifests between the OCI and Docker schema2 formats for clients that do not accept the cached one")
+
+	cmd.Flags().StringSliceVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host, repeat for a host to rotate across several accounts, use <token>:refresh-token@host or <registry-token>:token@host for token auth")
+	cmd.Flags().StringArrayVar(&flags.UserFiles, "user-file", flags.UserFiles, "File with one user:pwd@host per line, read again when it changes")
+	cmd.Flags().StringArrayVar(&flags.UserEnvs, "user-env", flags.UserEnvs, "Environment variable holding user:pwd@host entries separated by whitespace")
+	cmd.Flags().StringArrayVar(&flags.CredentialHelpers, "credential-helper", flags.CredentialHelpers, "Docker credential helper exchanging short-lived credentials for a host, like: 123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login")
+	cmd.Flags().StringVar(&flags.DockerConfig, "docker-config", flags.DockerConfig, "Docker config.json to resolve upstream credentials from, including credential helpers")
+	cmd.Flags().StringArrayVar(&flags.Mirrors, "mirror", flags.Mirrors, "Ordered upstream endpoints for a registry host, like: registry-1.docker.io=harbor.internal/dockerhub,registry-1.docker.io")
 	cmd.Flags().IntVar(&flags.Retry, "retry", flags.Retry, "Retry")
 	cmd.Flags().DurationVar(&flags.RetryInterval, "retry-interval", flags.RetryInterval, "Retry interval")
 	cmd.Flags().BoolVar(&flags.DisableTagsList, "disable-tags-list", flags.DisableTagsList, "Disable tags list")
+	cmd.Flags().BoolVar(&flags.CachedCatalog, "cached-catalog", flags.CachedCatalog, "Serve catalog and tags list from the cache")
 
 	cmd.Flags().BoolVar(&flags.Behind, "behind", flags.Behind, "Behind")
 	cmd.Flags().StringVar(&flags.Address, "address", flags.Address, "Address")
@@ -133,6 +167,10 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().IntVar(&flags.BlobNoRedirectMaxSizePerSecond, "blob-no-redirect-max-size-per-second", flags.BlobNoRedirectMaxSizePerSecond, "Maximum size per second for no redirect")
 	cmd.Flags().DurationVar(&flags.BlobCacheDuration, "blob-cache-duration", flags.BlobCacheDuration, "Blob cache duration")
 	cmd.Flags().BoolVar(&flags.ForceBlobNoRedirect, "force-blob-no-redirect", flags.ForceBlobNoRedirect, "Force blob no redirect")
+	cmd.Flags().DurationVar(&flags.BlobAccessFlushInterval, "blob-access-flush-interval", flags.BlobAccessFlushInterval, "Record when blobs are served and write the access times to storage at this interval, for LRU eviction by gc")
+	cmd.Flags().DurationVar(&flags.ScrubInterval, "scrub-interval", flags.ScrubInterval, "Re-hash stored blobs at this interval, quarantining and fetching again the corrupted ones")
+	cmd.Flags().IntVar(&flags.ScrubMaxSizePerSecond, "scrub-max-size-per-second", flags.ScrubMaxSizePerSecond, "Scrub max size per second")
+	cmd.Flags().BoolVar(&flags.RepositoryCheck, "repository-check", flags.RepositoryCheck, "Only serve cached blobs under repositories with a cached manifest referencing them")
 
 	cmd.Flags().StringVar(&flags.DefaultRegistry, "default-registry", flags.DefaultRegistry, "default registry used for non full-path docker pull, like:docker.io")
 	cmd.Flags().StringToStringVar(&flags.OverrideDefaultRegistry, "override-default-registry", flags.OverrideDefaultRegistry, "override default registry")
@@ -143,16 +181,46 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().StringVar(&flags.QueueToken, "queue-token", flags.QueueToken, "Queue token")
 	cmd.Flags().StringVar(&flags.QueueURL, "queue-url", flags.QueueURL, "Queue URL")
 
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+	cmd.Flags().StringVar(&flags.OTLPEndpoint, "otlp-endpoint", flags.OTLPEndpoint, "OTLP/HTTP endpoint to export traces to, like: http://localhost:4318")
+
 	return cmd
 }
 
 func runE(ctx context.Context, flags *flagpole) error {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if flags.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(ctx, "gateway", flags.OTLPEndpoint)
+		if err != nil {
+			return fmt.Errorf("setup tracing failed: %w", err)
+		}
+		defer shutdown(context.Background())
+	}
+	rateLimits := transport.NewRateLimits()
 	transportOpts := []transport.Option{
 		transport.WithUserAndPass(flags.Userpass),
+		transport.WithMirrors(flags.Mirrors),
+		transport.WithRateLimits(rateLimits),
 		transport.WithLogger(logger),
 	}
 
+	if len(flags.UserFiles) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserFiles(flags.UserFiles))
+	}
+
+	if len(flags.UserEnvs) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserEnvs(flags.UserEnvs))
+	}
+
+	if len(flags.CredentialHelpers) != 0 {
+		transportOpts = append(transportOpts, transport.WithCredentialHelpers(flags.CredentialHelpers))
+	}
+
+	if flags.DockerConfig != "" {
+		transportOpts = append(transportOpts, transport.WithKeychain(transport.NewDockerConfigKeychain(flags.DockerConfig)))
+	}
+
 	tp, err := transport.NewTransport(transportOpts...)
 	if err != nil {
 		return fmt.Errorf("create clientset failed: %w", err)
@@ -175,6 +243,8 @@ func runE(ctx context.Context, flags *flagpole) error {
 		})
 	}
 
+	tp = transport.NewMetricsTransport(tp)
+	tp = transport.NewTracingTransport(tp)
 	tp = transport.NewLogTransport(tp, logger, time.Second)
 
 	httpClient := &http.Client{
@@ -237,6 +307,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 			return info
 		}),
 		gateway.WithDisableTagsList(flags.DisableTagsList),
+		gateway.WithCachedCatalog(flags.CachedCatalog),
 	}
 
 	if flags.StorageURL != "" {
@@ -252,22 +323,25 @@ func runE(ctx context.Context, flags *flagpole) error {
 			blobs.WithBlobNoRedirectMaxSizePerSecond(flags.BlobNoRedirectMaxSizePerSecond),
 			blobs.WithBlobCacheDuration(flags.BlobCacheDuration),
 			blobs.WithForceBlobNoRedirect(flags.ForceBlobNoRedirect),
+			blobs.WithScrubInterval(flags.ScrubInterval),
+			blobs.WithScrubMaxSizePerSecond(flags.ScrubMaxSizePerSecond),
+			blobs.WithRepositoryCheck(flags.RepositoryCheck),
 		}
 
 		cacheOpts := []cache.Option{
 			cache.WithSignLink(flags.SignLink),
 		}
 
-		sd, err := sss.NewSSS(sss.WithURL(flags.StorageURL))
-		if err != nil {
-			return fmt.Errorf("create storage driver failed: %w", err)
-		}
-		cacheOpts = append(cacheOpts, cache.WithStorageDriver(sd))
+		cacheOpts = append(cacheOpts, cache.WithStorageURL(flags.StorageURL))
 
 		if flags.LinkExpires > 0 {
 			cacheOpts = append(cacheOpts, cache.WithLinkExpires(flags.LinkExpires))
 		}
 
+		if flags.BlobAccessFlushInterval > 0 {
+			cacheOpts = append(cacheOpts, cache.WithAccessFlushInterval(flags.BlobAccessFlushInterval))
+		}
+
 		if flags.RedirectLinks != "" {
 			u, err := url.Parse(flags.RedirectLinks)
 			if err != nil {
@@ -280,9 +354,13 @@ func runE(ctx context.Context, flags *flagpole) error {
 		if err != nil {
 			return fmt.Errorf("create cache failed: %w", err)
 		}
+		defer sdcache.StartAccessTracker(ctx, logger)()
 		manifestsOpts = append(manifestsOpts,
 			manifests.WithCache(sdcache),
 			manifests.WithManifestCacheDuration(flags.ManifestCacheDuration),
+			manifests.WithManifestMaxStale(flags.ManifestMaxStale),
+			manifests.WithOffline(flags.Offline),
+			manifests.WithConvert(flags.ManifestConvert),
 		)
 
 		blobsOpts = append(blobsOpts,
@@ -291,24 +369,32 @@ func runE(ctx context.Context, flags *flagpole) error {
 
 		if flags.BigStorageURL != "" && flags.BigStorageSize > 0 {
 			bigCacheOpts := []cache.Option{}
-			sd, err := sss.NewSSS(sss.WithURL(flags.BigStorageURL))
-			if err != nil {
-				return fmt.Errorf("create storage driver failed: %w", err)
-			}
 			bigCacheOpts = append(bigCacheOpts,
 				cache.WithSignLink(flags.SignLink),
-				cache.WithStorageDriver(sd),
+				cache.WithStorageURL(flags.BigStorageURL),
 			)
 			if flags.LinkExpires > 0 {
 				bigCacheOpts = append(bigCacheOpts, cache.WithLinkExpires(flags.LinkExpires))
 			}
+			if flags.BlobAccessFlushInterval > 0 {
+				bigCacheOpts = append(bigCacheOpts, cache.WithAccessFlushInterval(flags.BlobAccessFlushInterval))
+			}
 			bigsdcache, err := cache.NewCache(bigCacheOpts...)
 			if err != nil {
 				return fmt.Errorf("create cache failed: %w", err)
 			}
+			defer bigsdcache.StartAccessTracker(ctx, logger)()
 			blobsOpts = append(blobsOpts, blobs.WithBigCache(bigsdcache, flags.BigStorageSize))
 		}
 
+		if flags.HotStorageURL != "" && flags.HotStorageSize > 0 {
+			hotsdcache, err := cache.NewCache(cache.WithStorageURL(flags.HotStorageURL))
+			if err != nil {
+				return fmt.Errorf("create hot cache failed: %w", err)
+			}
+			blobsOpts = append(blobsOpts, blobs.WithHotCache(hotsdcache, flags.HotStorageSize, flags.HotStorageMinHits))
+		}
+
 		if flags.QueueURL != "" {
 			queueClient := client.NewMessageClient(http.DefaultClient, flags.QueueURL, flags.QueueToken)
 			manifestsOpts = append(manifestsOpts,
@@ -320,7 +406,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 		}
 
 		manifestsOpts = append(manifestsOpts, manifests.WithClient(httpClient))
-		blobsOpts = append(blobsOpts, blobs.WithClient(httpClient))
+		blobsOpts = append(blobsOpts, blobs.WithClient(httpClient), blobs.WithRateLimits(rateLimits))
 
 		manifest, err := manifests.NewManifests(
 			manifestsOpts...,
@@ -338,6 +424,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 		gatewayOpts = append(gatewayOpts,
 			gateway.WithManifests(manifest),
 			gateway.WithBlobs(blob),
+			gateway.WithCache(sdcache),
 		)
 	}
 
@@ -354,11 +441,21 @@ func runE(ctx context.Context, flags *flagpole) error {
 	mux.Handle("/v2/", gw)
 
 	var handler http.Handler = mux
+	handler = tracing.NewHandler("gateway", handler)
 	handler = handlers.LoggingHandler(os.Stderr, handler)
 	if flags.Behind {
 		handler = handlers.ProxyHeaders(handler)
 	}
 
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
 	err = server.Run(ctx, flags.Address, handler, flags.AcmeHosts, flags.AcmeCacheDir, flags.CertFile, flags.PrivateKeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to run server: %w", err)
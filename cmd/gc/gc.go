@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/signals"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/gc"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	ctx := signals.SetupSignalContext()
+	err := NewCommand().ExecuteContext(ctx)
+	if err != nil {
+		slog.Error("execute failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+type flagpole struct {
+	StorageURL         []string
+	ManifestStorageURL string
+
+	MinAge          time.Duration
+	MaxSize         int64
+	EvictReferenced bool
+	DryRun          bool
+
+	Retention []string
+
+	Interval time.Duration
+
+	MetricsAddress string
+}
+
+func NewCommand() *cobra.Command {
+	flags := &flagpole{
+		MinAge: 24 * time.Hour,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Garbage collect blobs no longer referenced by cached manifests",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runE(cmd.Context(), flags)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url to sweep")
+	cmd.Flags().StringVar(&flags.ManifestStorageURL, "manifest-storage-url", flags.ManifestStorageURL, "Manifest storage driver url, defaults to the first storage url")
+	cmd.Flags().DurationVar(&flags.MinAge, "min-age", flags.MinAge, "Never sweep blobs written or served more recently than this")
+	cmd.Flags().Int64Var(&flags.MaxSize, "max-size", flags.MaxSize, "Keep unreferenced blobs, most recently used first, while the storage is under this many bytes, 0 sweeps all of them")
+	cmd.Flags().BoolVar(&flags.EvictReferenced, "evict-referenced", flags.EvictReferenced, "Also evict the least recently used referenced layers while the storage is over max size")
+	cmd.Flags().StringArrayVar(&flags.Retention, "retention", flags.Retention, "Tag retention policy, the first matching a repository applies, like: \"docker.io/library/* keep-last=10 keep-tags=^v[0-9.]+$ max-idle=720h\", tags are used when last pulled as recorded by --blob-access-flush-interval of the gateway, or last moved")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", flags.DryRun, "Only report the blobs that would be swept")
+	cmd.Flags().DurationVar(&flags.Interval, "interval", flags.Interval, "Run repeatedly at this interval instead of once")
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+
+	return cmd
+}
+
+func runE(ctx context.Context, flags *flagpole) error {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if len(flags.StorageURL) == 0 {
+		return fmt.Errorf("at least one storage url must be provided")
+	}
+
+	var caches []*cache.Cache
+	for _, s := range flags.StorageURL {
+		cache, err := cache.NewCache(cache.WithStorageURL(s))
+		if err != nil {
+			return fmt.Errorf("create cache failed: %w", err)
+		}
+
+		caches = append(caches, cache)
+	}
+
+	opts := []gc.Option{
+		gc.WithCaches(caches...),
+		gc.WithMinAge(flags.MinAge),
+		gc.WithMaxSize(flags.MaxSize),
+		gc.WithEvictReferenced(flags.EvictReferenced),
+		gc.WithDryRun(flags.DryRun),
+		gc.WithLogger(logger),
+	}
+
+	if len(flags.Retention) != 0 {
+		policies := make([]gc.Policy, 0, len(flags.Retention))
+		for _, r := range flags.Retention {
+			policy, err := gc.ParsePolicy(r)
+			if err != nil {
+				return fmt.Errorf("parse retention policy failed: %w", err)
+			}
+			policies = append(policies, policy)
+		}
+		opts = append(opts, gc.WithPolicies(policies...))
+	}
+
+	if flags.ManifestStorageURL != "" {
+		manifestCache, err := cache.NewCache(cache.WithStorageURL(flags.ManifestStorageURL))
+		if err != nil {
+			return fmt.Errorf("create cache failed: %w", err)
+		}
+		opts = append(opts, gc.WithManifestCache(manifestCache))
+	}
+
+	g, err := gc.NewGC(opts...)
+	if err != nil {
+		return err
+	}
+
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
+	for {
+		result, err := g.Run(ctx)
+		if err != nil {
+			if flags.Interval <= 0 {
+				return err
+			}
+			logger.Error("failed to collect garbage", "error", err)
+		} else {
+			logger.Info("applied retention", "expiredTags", len(result.ExpiredTags), "orphanedRevisions", len(result.OrphanedRevisions), "unlinkedLayers", result.UnlinkedLayers, "dryRun", result.DryRun)
+			for i, report := range result.Caches {
+				logger.Info("collected garbage", "storage", i, "blobs", report.Blobs, "size", report.Size, "sweptBlobs", report.SweptBlobs, "sweptSize", report.SweptSize, "evictedBlobs", report.EvictedBlobs, "evictedSize", report.EvictedSize, "sharedBlobs", report.SharedBlobs, "dedupSavedSize", report.DedupSavedSize, "dryRun", report.DryRun)
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(result)
+			if err != nil {
+				return err
+			}
+		}
+
+		if flags.Interval <= 0 {
+			return nil
+		}
+
+		select {
+		case <-time.After(flags.Interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -12,7 +12,9 @@ import (
 
 	"github.com/OpenCIDN/OpenCIDN/internal/server"
 	"github.com/OpenCIDN/OpenCIDN/internal/signals"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/gorilla/handlers"
 	"github.com/spf13/cobra"
@@ -44,6 +46,9 @@ type flagpole struct {
 	AdminToken string
 
 	DBURL string
+
+	MetricsAddress string
+	OTLPEndpoint   string
 }
 
 func NewCommand() *cobra.Command {
@@ -72,13 +77,26 @@ func NewCommand() *cobra.Command {
 
 	cmd.Flags().StringVar(&flags.DBURL, "db-url", flags.DBURL, "Database URL")
 
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+	cmd.Flags().StringVar(&flags.OTLPEndpoint, "otlp-endpoint", flags.OTLPEndpoint, "OTLP/HTTP endpoint to export traces to, like: http://localhost:4318")
+
 	cmd.Flags().BoolVar(&flags.AllowAnonymousRead, "allow-anonymous-read", flags.AllowAnonymousRead, "Allow anonymous read access")
+
+	cmd.AddCommand(newWarmupCommand())
 	return cmd
 }
 
 func runE(ctx context.Context, flags *flagpole) error {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
+	if flags.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(ctx, "queue", flags.OTLPEndpoint)
+		if err != nil {
+			return fmt.Errorf("setup tracing failed: %w", err)
+		}
+		defer shutdown(context.Background())
+	}
+
 	container := restful.NewContainer()
 
 	var mgr *queue.QueueManager
@@ -106,6 +124,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 	}
 
 	var handler http.Handler = container
+	handler = tracing.NewHandler("queue", handler)
 
 	handler = handlers.LoggingHandler(os.Stderr, handler)
 
@@ -119,6 +138,15 @@ func runE(ctx context.Context, flags *flagpole) error {
 		handlers.AllowedOrigins([]string{"*"}),
 	)(handler)
 
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
 	err := server.Run(ctx, flags.Address, handler, flags.AcmeHosts, flags.AcmeCacheDir, flags.CertFile, flags.PrivateKeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to run server: %w", err)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/warmup"
+	"github.com/spf13/cobra"
+)
+
+type warmupFlagpole struct {
+	QueueURL   string
+	QueueToken string
+
+	Files    []string
+	Priority int
+
+	Wait     bool
+	Interval time.Duration
+}
+
+func newWarmupCommand() *cobra.Command {
+	flags := &warmupFlagpole{
+		Interval: 5 * time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "warmup [image...]",
+		Short: "Fetch images with all their blobs into the cache before they are pulled",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runWarmup(cmd.Context(), flags, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&flags.QueueURL, "queue-url", flags.QueueURL, "Queue URL")
+	cmd.Flags().StringVar(&flags.QueueToken, "queue-token", flags.QueueToken, "Queue token")
+	cmd.Flags().StringArrayVarP(&flags.Files, "file", "f", flags.Files, "File listing images one per line, or Kubernetes manifests and rendered Helm charts, - for stdin")
+	cmd.Flags().IntVar(&flags.Priority, "priority", flags.Priority, "Priority of the messages")
+	cmd.Flags().BoolVar(&flags.Wait, "wait", flags.Wait, "Wait for the images to be fetched, reporting the progress")
+	cmd.Flags().DurationVar(&flags.Interval, "interval", flags.Interval, "Interval of the progress reports")
+	return cmd
+}
+
+func runWarmup(ctx context.Context, flags *warmupFlagpole, args []string) error {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if flags.QueueURL == "" {
+		return fmt.Errorf("--queue-url is required")
+	}
+
+	images := args
+	for _, file := range flags.Files {
+		list, err := readImages(file)
+		if err != nil {
+			return fmt.Errorf("failed to read images from %s: %w", file, err)
+		}
+		images = append(images, list...)
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no images to warm up")
+	}
+
+	queueClient := client.NewMessageClient(http.DefaultClient, flags.QueueURL, flags.QueueToken)
+
+	resp, err := queueClient.Warmup(ctx, client.WarmupRequest{
+		Images:   images,
+		Priority: flags.Priority,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to warm up: %w", err)
+	}
+
+	for _, msg := range resp.Messages {
+		logger.Info("warm up image", "id", msg.MessageID, "image", msg.Content, "status", msg.Status.String())
+	}
+	logProgress(logger, resp.Progress)
+
+	if !flags.Wait {
+		return nil
+	}
+
+	messages := resp.Messages
+	progress := resp.Progress
+	for !progress.Done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(flags.Interval):
+		}
+
+		progress = warmup.Progress{}
+		for i, msg := range messages {
+			if msg.Status == model.StatusPending || msg.Status == model.StatusProcessing {
+				curr, err := queueClient.Get(ctx, msg.MessageID)
+				if err == nil {
+					messages[i] = curr
+				} else if strings.Contains(err.Error(), "MessageNotFoundError") {
+					// Finished messages are cleaned up after a while.
+					messages[i].Status = model.StatusCleanup
+				} else {
+					logger.Warn("failed to get message", "id", msg.MessageID, "error", err)
+				}
+			}
+			progress.Add(messages[i].Status, messages[i].Data)
+		}
+		logProgress(logger, progress)
+	}
+
+	if progress.Failed != 0 {
+		for _, msg := range messages {
+			if msg.Status == model.StatusFailed {
+				logger.Error("failed to warm up image", "image", msg.Content, "error", msg.Data.Error)
+			}
+		}
+		return fmt.Errorf("failed to warm up %d of %d images", progress.Failed, progress.Total)
+	}
+	return nil
+}
+
+func logProgress(logger *slog.Logger, progress warmup.Progress) {
+	logger.Info("warm up progress", "total", progress.Total, "pending", progress.Pending, "processing", progress.Processing, "completed", progress.Completed, "failed", progress.Failed, "progress", progress.Progress, "size", progress.Size)
+}
+
+func readImages(file string) ([]string, error) {
+	var r io.Reader
+	if file == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return warmup.ParseImages(r)
+}
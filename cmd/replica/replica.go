@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/signals"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/replica"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	ctx := signals.SetupSignalContext()
+	err := NewCommand().ExecuteContext(ctx)
+	if err != nil {
+		slog.Error("execute failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+type flagpole struct {
+	StorageURL []string
+}
+
+func NewCommand() *cobra.Command {
+	flags := &flagpole{}
+
+	cmd := &cobra.Command{
+		Use:   "replica",
+		Short: "Compare and repair storages holding replicas of the same cache",
+	}
+
+	cmd.PersistentFlags().StringArrayVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url of a replica, repeat for each replica")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Report blobs, manifests and tags missing or mismatched across the replicas",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runE(cmd.Context(), flags, false)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "repair",
+		Short: "Copy blobs, manifests and tags missing or mismatched to the replicas lacking them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runE(cmd.Context(), flags, true)
+		},
+	})
+
+	return cmd
+}
+
+func runE(ctx context.Context, flags *flagpole, repair bool) error {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	var caches []*cache.Cache
+	for _, s := range flags.StorageURL {
+		cache, err := cache.NewCache(cache.WithStorageURL(s))
+		if err != nil {
+			return fmt.Errorf("create cache failed: %w", err)
+		}
+		caches = append(caches, cache)
+	}
+
+	r, err := replica.NewReplica(
+		replica.WithCaches(caches...),
+		replica.WithLogger(logger),
+	)
+	if err != nil {
+		return err
+	}
+
+	var report *replica.Report
+	if repair {
+		report, err = r.Repair(ctx)
+	} else {
+		report, err = r.Verify(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("verified replicas", "blobs", report.Blobs, "revisions", report.Revisions, "tags", report.Tags, "divergent", len(report.Divergent), "repaired", report.Repaired, "failed", report.Failed)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(report)
+	if err != nil {
+		return err
+	}
+
+	if report.Failed != 0 {
+		return fmt.Errorf("failed to repair %d objects", report.Failed)
+	}
+	return nil
+}
@@ -15,12 +15,13 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/signals"
 	"github.com/OpenCIDN/OpenCIDN/internal/spec"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/runner"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/spf13/cobra"
 	"github.com/wzshiming/httpseek"
-	"github.com/wzshiming/sss"
 )
 
 func main() {
@@ -43,16 +44,28 @@ type flagpole struct {
 
 	ResumeSize int
 
-	StorageURL    []string
-	Quick         bool
-	Platform      []string
-	Userpass      []string
-	Retry         int
-	RetryInterval time.Duration
+	StorageURL        []string
+	Quick             bool
+	Platform          []string
+	Userpass          []string
+	UserFiles         []string
+	UserEnvs          []string
+	DockerConfig      string
+	CredentialHelpers []string
+	Mirrors           []string
+	Retry             int
+	RetryInterval     time.Duration
+
+	TagWatchInterval time.Duration
+
+	Referrers bool
 
 	Lease string
 
 	Duration time.Duration
+
+	MetricsAddress string
+	OTLPEndpoint   string
 }
 
 func NewCommand() *cobra.Command {
@@ -74,7 +87,7 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().StringVar(&flags.QueueToken, "queue-token", flags.QueueToken, "Queue token")
 	cmd.Flags().StringVar(&flags.QueueURL, "queue-url", flags.QueueURL, "Queue URL")
 
-	cmd.Flags().StringArrayVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url")
+	cmd.Flags().StringArrayVar(&flags.StorageURL, "storage-url", flags.StorageURL, "Storage driver url, file:///path for a local directory")
 	cmd.Flags().StringVar(&flags.BigStorageURL, "big-storage-url", flags.BigStorageURL, "Big storage driver url")
 	cmd.Flags().IntVar(&flags.BigStorageSize, "big-storage-size", flags.BigStorageSize, "Big storage size")
 	cmd.Flags().IntVar(&flags.ResumeSize, "resume-size", flags.ResumeSize, "Resume size")
@@ -82,11 +95,20 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().StringVar(&flags.ManifestStorageURL, "manifest-storage-url", flags.ManifestStorageURL, "manifest storage driver url")
 	cmd.Flags().BoolVar(&flags.Quick, "quick", flags.Quick, "Quick sync with tags")
 	cmd.Flags().StringSliceVar(&flags.Platform, "platform", flags.Platform, "Platform")
-	cmd.Flags().StringArrayVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host")
+	cmd.Flags().StringArrayVarP(&flags.Userpass, "user", "u", flags.Userpass, "host and username and password -u user:pwd@host, repeat for a host to rotate across several accounts, use <token>:refresh-token@host or <registry-token>:token@host for token auth")
+	cmd.Flags().StringArrayVar(&flags.UserFiles, "user-file", flags.UserFiles, "File with one user:pwd@host per line, read again when it changes")
+	cmd.Flags().StringArrayVar(&flags.UserEnvs, "user-env", flags.UserEnvs, "Environment variable holding user:pwd@host entries separated by whitespace")
+	cmd.Flags().StringArrayVar(&flags.CredentialHelpers, "credential-helper", flags.CredentialHelpers, "Docker credential helper exchanging short-lived credentials for a host, like: 123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login")
+	cmd.Flags().StringVar(&flags.DockerConfig, "docker-config", flags.DockerConfig, "Docker config.json to resolve upstream credentials from, including credential helpers")
+	cmd.Flags().StringArrayVar(&flags.Mirrors, "mirror", flags.Mirrors, "Ordered upstream endpoints for a registry host, like: registry-1.docker.io=harbor.internal/dockerhub,registry-1.docker.io")
 	cmd.Flags().IntVar(&flags.Retry, "retry", flags.Retry, "Retry")
 	cmd.Flags().DurationVar(&flags.RetryInterval, "retry-interval", flags.RetryInterval, "Retry interval")
+	cmd.Flags().DurationVar(&flags.TagWatchInterval, "tag-watch-interval", flags.TagWatchInterval, "Check the tag watches of the queue at this interval, queueing deep syncs of tags changed upstream, enable on one runner only")
+	cmd.Flags().BoolVar(&flags.Referrers, "referrers", flags.Referrers, "Follow the referrers of manifests in deep syncs, like signatures, SBOMs and attestations")
 	cmd.Flags().DurationVar(&flags.Duration, "duration", flags.Duration, "Duration of the runner")
 	cmd.Flags().StringVar(&flags.Lease, "lease", flags.Lease, "Lease of the runner")
+	cmd.Flags().StringVar(&flags.MetricsAddress, "metrics-address", flags.MetricsAddress, "Metrics address")
+	cmd.Flags().StringVar(&flags.OTLPEndpoint, "otlp-endpoint", flags.OTLPEndpoint, "OTLP/HTTP endpoint to export traces to, like: http://localhost:4318")
 
 	return cmd
 }
@@ -94,14 +116,17 @@ func NewCommand() *cobra.Command {
 func runE(ctx context.Context, flags *flagpole) error {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
 
-	var caches []*cache.Cache
-	for _, s := range flags.StorageURL {
-		sd, err := sss.NewSSS(sss.WithURL(s))
+	if flags.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(ctx, "runner", flags.OTLPEndpoint)
 		if err != nil {
-			return fmt.Errorf("create storage driver failed: %w", err)
+			return fmt.Errorf("setup tracing failed: %w", err)
 		}
+		defer shutdown(context.Background())
+	}
 
-		cache, err := cache.NewCache(cache.WithStorageDriver(sd))
+	var caches []*cache.Cache
+	for _, s := range flags.StorageURL {
+		cache, err := cache.NewCache(cache.WithStorageURL(s))
 		if err != nil {
 			return fmt.Errorf("create cache failed: %w", err)
 		}
@@ -109,7 +134,9 @@ func runE(ctx context.Context, flags *flagpole) error {
 		caches = append(caches, cache)
 	}
 
+	rateLimits := transport.NewRateLimits()
 	transportOpts := []transport.Option{
+		transport.WithRateLimits(rateLimits),
 		transport.WithLogger(logger),
 	}
 
@@ -117,6 +144,26 @@ func runE(ctx context.Context, flags *flagpole) error {
 		transportOpts = append(transportOpts, transport.WithUserAndPass(flags.Userpass))
 	}
 
+	if len(flags.Mirrors) != 0 {
+		transportOpts = append(transportOpts, transport.WithMirrors(flags.Mirrors))
+	}
+
+	if len(flags.UserFiles) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserFiles(flags.UserFiles))
+	}
+
+	if len(flags.UserEnvs) != 0 {
+		transportOpts = append(transportOpts, transport.WithUserEnvs(flags.UserEnvs))
+	}
+
+	if len(flags.CredentialHelpers) != 0 {
+		transportOpts = append(transportOpts, transport.WithCredentialHelpers(flags.CredentialHelpers))
+	}
+
+	if flags.DockerConfig != "" {
+		transportOpts = append(transportOpts, transport.WithKeychain(transport.NewDockerConfigKeychain(flags.DockerConfig)))
+	}
+
 	tp, err := transport.NewTransport(transportOpts...)
 	if err != nil {
 		return fmt.Errorf("create transport failed: %w", err)
@@ -149,6 +196,9 @@ func runE(ctx context.Context, flags *flagpole) error {
 		})
 	}
 
+	tp = transport.NewMetricsTransport(tp)
+	tp = transport.NewTracingTransport(tp)
+
 	httpClient := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) > 10 {
@@ -177,16 +227,15 @@ func runE(ctx context.Context, flags *flagpole) error {
 		runner.WithLogger(logger),
 		runner.WithQueueClient(queueClient),
 		runner.WithFilterPlatform(filterPlatform(flags.Platform)),
+		runner.WithRateLimits(rateLimits),
+		runner.WithTagWatchInterval(flags.TagWatchInterval),
+		runner.WithReferrers(flags.Referrers),
 	}
 
 	if flags.BigStorageURL != "" && flags.BigStorageSize > 0 {
 		bigCacheOpts := []cache.Option{}
-		sd, err := sss.NewSSS(sss.WithURL(flags.BigStorageURL))
-		if err != nil {
-			return fmt.Errorf("create storage driver failed: %w", err)
-		}
 		bigCacheOpts = append(bigCacheOpts,
-			cache.WithStorageDriver(sd),
+			cache.WithStorageURL(flags.BigStorageURL),
 		)
 		bigsdcache, err := cache.NewCache(bigCacheOpts...)
 		if err != nil {
@@ -197,12 +246,8 @@ func runE(ctx context.Context, flags *flagpole) error {
 
 	if flags.ManifestStorageURL != "" {
 		manifestCacheOpts := []cache.Option{}
-		sd, err := sss.NewSSS(sss.WithURL(flags.ManifestStorageURL))
-		if err != nil {
-			return fmt.Errorf("create storage driver failed: %w", err)
-		}
 		manifestCacheOpts = append(manifestCacheOpts,
-			cache.WithStorageDriver(sd),
+			cache.WithStorageURL(flags.ManifestStorageURL),
 		)
 		manifestsdcache, err := cache.NewCache(manifestCacheOpts...)
 		if err != nil {
@@ -224,6 +269,15 @@ func runE(ctx context.Context, flags *flagpole) error {
 		ctx, _ = context.WithTimeout(ctx, flags.Duration)
 	}
 
+	if flags.MetricsAddress != "" {
+		go func() {
+			err := metrics.Run(ctx, flags.MetricsAddress)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("failed to run metrics server", "error", err)
+			}
+		}()
+	}
+
 	err = runner.Run(ctx)
 	if err != nil {
 		if !errors.Is(err, context.DeadlineExceeded) {
@@ -0,0 +1,178 @@
+// Package queuetest provides a queue server for tests, keeping messages in
+// memory with the semantics of the queue controller.
+package queuetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+)
+
+// Queue returns the existing message when a message is created for content
+// already queued, whatever its status unless renewed, like the queue
+// controller.
+type Queue struct {
+	*httptest.Server
+
+	mut      sync.Mutex
+	messages []*message
+}
+
+type message struct {
+	client.MessageResponse
+	lease   string
+	deleted bool
+}
+
+// NewQueue starts a Queue closed when the test ends.
+func NewQueue(t testing.TB) *Queue {
+	q := &Queue{}
+	q.Server = httptest.NewServer(q)
+	t.Cleanup(q.Close)
+	return q
+}
+
+// MessageClient returns a client of the queue.
+func (q *Queue) MessageClient() *client.MessageClient {
+	return client.NewMessageClient(q.Client(), q.URL, "")
+}
+
+// Messages returns every message created, in order.
+func (q *Queue) Messages() []client.MessageResponse {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	out := make([]client.MessageResponse, 0, len(q.messages))
+	for _, m := range q.messages {
+		out = append(out, m.MessageResponse)
+	}
+	return out
+}
+
+func (q *Queue) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	p := strings.Trim(r.URL.Path, "/")
+	if p == "messages" {
+		switch r.Method {
+		case http.MethodPut:
+			q.create(rw, r)
+		case http.MethodGet:
+			list := []client.MessageResponse{}
+			for _, m := range q.messages {
+				if !m.deleted {
+					list = append(list, m.MessageResponse)
+				}
+			}
+			serveJSON(rw, http.StatusOK, list)
+		default:
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(p, "messages/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 || int(id) > len(q.messages) || q.messages[id-1].deleted {
+		serveJSON(rw, http.StatusNotFound, map[string]string{"code": "MessageNotFoundError"})
+		return
+	}
+	m := q.messages[id-1]
+
+	if len(parts) == 1 {
+		serveJSON(rw, http.StatusOK, m.MessageResponse)
+		return
+	}
+
+	var req struct {
+		Lease string            `json:"lease"`
+		Data  model.MessageAttr `json:"data"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	from, to := model.StatusProcessing, model.StatusProcessing
+	switch parts[1] {
+	case "consume":
+		from = model.StatusPending
+	case "complete":
+		to = model.StatusCompleted
+	case "failed":
+		to = model.StatusFailed
+		m.Data.Error = req.Data.Error
+	case "cancel":
+		to = model.StatusPending
+	}
+	if m.Status != from || (from == model.StatusProcessing && m.lease != req.Lease) {
+		serveJSON(rw, http.StatusNotAcceptable, map[string]string{"code": "MessageNotAcceptableError"})
+		return
+	}
+	m.Status = to
+	m.lease = req.Lease
+	if to != model.StatusProcessing {
+		m.lease = ""
+	}
+	m.LastHeartbeat = time.Now()
+	if parts[1] == "heartbeat" {
+		if req.Data.Progress != 0 {
+			m.Data.Progress = req.Data.Progress
+		}
+		if req.Data.Size > 0 {
+			m.Data.Size = req.Data.Size
+		}
+	}
+
+	if parts[1] == "consume" {
+		serveJSON(rw, http.StatusOK, m.MessageResponse)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (q *Queue) create(rw http.ResponseWriter, r *http.Request) {
+	var req client.MessageRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		serveJSON(rw, http.StatusBadRequest, map[string]string{"code": "MessageRequestError"})
+		return
+	}
+
+	for _, m := range q.messages {
+		if m.Content != req.Content || m.deleted {
+			continue
+		}
+		if req.Renew && (m.Status == model.StatusCompleted || m.Status == model.StatusFailed) {
+			m.deleted = true
+			continue
+		}
+		if m.Status == model.StatusPending && req.Priority > m.Priority {
+			m.Priority = req.Priority
+		}
+		serveJSON(rw, http.StatusOK, m.MessageResponse)
+		return
+	}
+
+	m := &message{
+		MessageResponse: client.MessageResponse{
+			MessageID: int64(len(q.messages) + 1),
+			Content:   req.Content,
+			Priority:  req.Priority,
+			Data:      req.Data,
+		},
+	}
+	q.messages = append(q.messages, m)
+	serveJSON(rw, http.StatusCreated, m.MessageResponse)
+}
+
+func serveJSON(rw http.ResponseWriter, code int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,160 @@
+// Package registrytest provides an upstream registry for tests, so they do
+// not depend on public registries.
+package registrytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Registry serves the manifests and blobs put into it over TLS, use its
+// Client to reach it.
+type Registry struct {
+	*httptest.Server
+
+	mut       sync.Mutex
+	manifests map[string]manifest
+	tags      map[string][]string
+	blobs     map[string][]byte
+
+	requests atomic.Int32
+}
+
+type manifest struct {
+	mediaType string
+	content   []byte
+}
+
+// NewRegistry starts a Registry closed when the test ends.
+func NewRegistry(t testing.TB) *Registry {
+	r := &Registry{
+		manifests: map[string]manifest{},
+		tags:      map[string][]string{},
+		blobs:     map[string][]byte{},
+	}
+	r.Server = httptest.NewTLSServer(r)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Host is the host the registry is reached at.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.URL, "https://")
+}
+
+// Requests is the number of requests served, besides the API base.
+func (r *Registry) Requests() int {
+	return int(r.requests.Load())
+}
+
+// PutBlob stores content and returns its digest.
+func (r *Registry) PutBlob(content []byte) string {
+	d := digest.FromBytes(content).String()
+	r.mut.Lock()
+	r.blobs[d] = content
+	r.mut.Unlock()
+	return d
+}
+
+// PutManifest stores content for image under its digest and tag, when tag
+// is not empty, and returns the digest.
+func (r *Registry) PutManifest(image, tag string, content []byte) string {
+	var m struct {
+		MediaType string `json:"mediaType"`
+	}
+	_ = json.Unmarshal(content, &m)
+
+	d := digest.FromBytes(content).String()
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.manifests[image+"@"+d] = manifest{mediaType: m.MediaType, content: content}
+	if tag != "" {
+		if _, ok := r.manifests[image+":"+tag]; !ok {
+			r.tags[image] = append(r.tags[image], tag)
+		}
+		r.manifests[image+":"+tag] = manifest{mediaType: m.MediaType, content: content}
+	}
+	return d
+}
+
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if p == "" {
+		return
+	}
+	r.requests.Add(1)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if image, ok := strings.CutSuffix(p, "/tags/list"); ok {
+		r.mut.Lock()
+		tags := r.tags[image]
+		r.mut.Unlock()
+		if tags == nil {
+			serveError(rw, http.StatusNotFound, "NAME_UNKNOWN")
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]any{"name": image, "tags": tags})
+		return
+	}
+
+	if i := strings.LastIndex(p, "/manifests/"); i >= 0 {
+		image, ref := p[:i], p[i+len("/manifests/"):]
+		sep := ":"
+		if strings.Contains(ref, ":") {
+			sep = "@"
+		}
+		r.mut.Lock()
+		m, ok := r.manifests[image+sep+ref]
+		r.mut.Unlock()
+		if !ok {
+			serveError(rw, http.StatusNotFound, "MANIFEST_UNKNOWN")
+			return
+		}
+		rw.Header().Set("Content-Type", m.mediaType)
+		rw.Header().Set("Content-Length", strconv.Itoa(len(m.content)))
+		rw.Header().Set("Docker-Content-Digest", digest.FromBytes(m.content).String())
+		if req.Method == http.MethodHead {
+			return
+		}
+		rw.Write(m.content)
+		return
+	}
+
+	if i := strings.LastIndex(p, "/blobs/"); i >= 0 {
+		r.mut.Lock()
+		content, ok := r.blobs[p[i+len("/blobs/"):]]
+		r.mut.Unlock()
+		if !ok {
+			serveError(rw, http.StatusNotFound, "BLOB_UNKNOWN")
+			return
+		}
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+
+	serveError(rw, http.StatusNotFound, "NAME_UNKNOWN")
+}
+
+func serveError(rw http.ResponseWriter, code int, errCode string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(map[string]any{
+		"errors": []map[string]string{{"code": errCode}},
+	})
+}
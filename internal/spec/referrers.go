@@ -0,0 +1,81 @@
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrDenied is returned when the registry denies the referrers.
+var ErrDenied = errors.New("denied by upstream")
+
+// maxIndexSize bounds the indexes of referrers read from registries.
+const maxIndexSize = 4 * 1024 * 1024
+
+// Referrers returns the referrers of the manifest from the referrers API of
+// the registry, or from the index tagged with the digest, like sha256-<hex>,
+// on registries without it. filtered reports whether the registry already
+// filtered them by the artifact type.
+func Referrers(ctx context.Context, client *http.Client, host, image, manifestDigest, artifactType string) (_ []Descriptor, filtered bool, _ error) {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   "/v2/" + image + "/referrers/" + manifestDigest,
+	}
+	if artifactType != "" {
+		u.RawQuery = url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+
+	index, header, found, err := getIndex(ctx, client, u)
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		filtered := strings.Contains(header.Get("OCI-Filters-Applied"), "artifactType")
+		return index.Manifests, filtered, nil
+	}
+
+	u.Path = "/v2/" + image + "/manifests/" + strings.Replace(manifestDigest, ":", "-", 1)
+	u.RawQuery = ""
+	index, _, _, err = getIndex(ctx, client, u)
+	if err != nil {
+		return nil, false, err
+	}
+	return index.Manifests, false, nil
+}
+
+func getIndex(ctx context.Context, client *http.Client, u *url.URL) (Index, http.Header, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Index{}, nil, false, err
+	}
+	req.Header.Set("Accept", MediaTypeImageIndex)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Index{}, nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Index{}, resp.Header, false, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return Index{}, nil, false, fmt.Errorf("%w: %s: status code %d", ErrDenied, u.String(), resp.StatusCode)
+	default:
+		return Index{}, nil, false, fmt.Errorf("failed to get %s: status code %d", u.String(), resp.StatusCode)
+	}
+
+	var index Index
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxIndexSize)).Decode(&index)
+	if err != nil {
+		return Index{}, nil, false, fmt.Errorf("invalid index of %s: %w", u.String(), err)
+	}
+	return index, resp.Header, true, nil
+}
@@ -3,6 +3,9 @@ package spec
 type ManifestLayers struct {
 	Config Layer   `json:"config"`
 	Layers []Layer `json:"layers"`
+	// Blobs are the layers of artifact manifests.
+	Blobs   []Layer `json:"blobs"`
+	Subject *Layer  `json:"subject"`
 }
 
 type Layer struct {
@@ -25,3 +28,43 @@ type Platform struct {
 	Architecture string `json:"architecture"`
 	OS           string `json:"os"`
 }
+
+const MediaTypeImageIndex = "application/vnd.oci.image.index.v1+json"
+
+// Index is an OCI image index, like the response of the referrers API.
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// NewIndex returns an index of the descriptors, the manifests are never null.
+func NewIndex(manifests []Descriptor) Index {
+	if manifests == nil {
+		manifests = []Descriptor{}
+	}
+	return Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests:     manifests,
+	}
+}
+
+// FilterArtifactType returns the descriptors of the artifact type.
+func FilterArtifactType(manifests []Descriptor, artifactType string) []Descriptor {
+	filtered := []Descriptor{}
+	for _, m := range manifests {
+		if m.ArtifactType == artifactType {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
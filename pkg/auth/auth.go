@@ -230,6 +230,7 @@ func (m *AuthManager) GetTokenWithUser(ctx context.Context, userinfo *url.Userin
 		RateLimitPerSecond: tok.Data.RateLimitPerSecond,
 		Weight:             tok.Data.Weight,
 		CacheFirst:         tok.Data.CacheFirst,
+		Offline:            tok.Data.Offline,
 
 		NoAllowlist:   tok.Data.NoAllowlist,
 		NoBlock:       tok.Data.NoBlock,
@@ -18,6 +18,7 @@ type TokenAttr struct {
 	RateLimitPerSecond uint64 `json:"rate_limit_per_second,omitempty"`
 	Weight             int    `json:"weight,omitempty"`
 	CacheFirst         bool   `json:"cache_first,omitempty"`
+	Offline            bool   `json:"offline,omitempty"`
 	AllowTagsList      bool   `json:"allow_tags_list,omitempty"`
 	NoAllowlist        bool   `json:"no_allowlist,omitempty"`
 	NoBlock            bool   `json:"no_block,omitempty"`
@@ -18,11 +18,17 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/throttled"
 	"github.com/OpenCIDN/OpenCIDN/internal/utils"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/docker/distribution/registry/api/errcode"
-	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	crtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/opencontainers/go-digest"
+	"github.com/wzshiming/imc"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/time/rate"
 )
 
@@ -56,6 +62,11 @@ type Blobs struct {
 	bigCacheSize int
 	bigCache     *cache.Cache
 
+	hotStorage      *cache.Cache
+	hotCacheSize    int64
+	hotCacheMinHits int
+	hot             *hotCache
+
 	blobCacheDuration time.Duration
 	blobCache         *blobsCache
 	authenticator     *token.Authenticator
@@ -65,6 +76,13 @@ type Blobs struct {
 	forceBlobNoRedirect bool
 
 	queueClient *client.MessageClient
+	rateLimits  *transport.RateLimits
+
+	scrubInterval time.Duration
+	scrubLimit    *rate.Limiter
+
+	repositoryCheck bool
+	layers          *imc.Cache[string, bool]
 }
 
 type Option func(c *Blobs) error
@@ -84,6 +102,20 @@ func WithBigCache(cache *cache.Cache, size int) Option {
 	}
 }
 
+// WithHotCache keeps blobs served at least minHits times on a local cache in
+// front of the other caches, up to size bytes.
+func WithHotCache(cache *cache.Cache, size int64, minHits int) Option {
+	return func(c *Blobs) error {
+		if minHits < 1 {
+			minHits = 1
+		}
+		c.hotStorage = cache
+		c.hotCacheSize = size
+		c.hotCacheMinHits = minHits
+		return nil
+	}
+}
+
 func WithLogger(logger *slog.Logger) Option {
 	return func(c *Blobs) error {
 		c.logger = logger
@@ -157,6 +189,13 @@ func WithQueueClient(queueClient *client.MessageClient) Option {
 	}
 }
 
+func WithRateLimits(rateLimits *transport.RateLimits) Option {
+	return func(c *Blobs) error {
+		c.rateLimits = rateLimits
+		return nil
+	}
+}
+
 func NewBlobs(opts ...Option) (*Blobs, error) {
 	c := &Blobs{
 		logger:            slog.Default(),
@@ -176,6 +215,25 @@ func NewBlobs(opts ...Option) (*Blobs, error) {
 	c.blobCache = newBlobsCache(c.blobCacheDuration)
 	c.blobCache.Start(ctx, c.logger)
 
+	if c.repositoryCheck {
+		c.layers = imc.NewCache[string, bool]()
+		go c.layers.RunEvict(ctx, func(key string, value bool) bool {
+			return true
+		})
+	}
+
+	if c.hotStorage != nil && c.hotCacheSize > 0 {
+		hot, err := newHotCache(ctx, c.hotStorage, c.hotCacheSize, c.hotCacheMinHits, c.logger)
+		if err != nil {
+			return nil, fmt.Errorf("load hot cache: %w", err)
+		}
+		c.hot = hot
+	}
+
+	if c.scrubInterval > 0 {
+		go c.runScrub(ctx)
+	}
+
 	for i := 0; i <= c.concurrency; i++ {
 		go c.worker(ctx)
 	}
@@ -183,25 +241,25 @@ func NewBlobs(opts ...Option) (*Blobs, error) {
 	for i := range c.groupQueue {
 		q := queue.NewWeightQueue[*downloadBlob]()
 		c.groupQueue[i] = q
-		go c.downloadBlobWorker(ctx, q)
+		go c.downloadBlobWorker(ctx, q, i)
 	}
 
 	for i := 0; i <= c.concurrency*8/10; i++ {
 		q := queue.NewWeightQueue[*downloadBlob]()
 		c.groupQueue[0] = q
-		go c.downloadBlobWorker(ctx, q)
+		go c.downloadBlobWorker(ctx, q, 0)
 	}
 
 	for i := 0; i <= c.concurrency*1/10; i++ {
 		q := queue.NewWeightQueue[*downloadBlob]()
 		c.groupQueue[1] = q
-		go c.downloadBlobWorker(ctx, q)
+		go c.downloadBlobWorker(ctx, q, 1)
 	}
 
 	return c, nil
 }
 
-// /v2/{source}/{path...}/blobs/sha256:{digest}
+// /v2/{source}/{path...}/blobs/{algorithm}:{digest}
 
 func parsePath(path string) (string, string, string, bool) {
 	path = strings.TrimPrefix(path, prefix)
@@ -214,11 +272,11 @@ func parsePath(path string) (string, string, string, bool) {
 	}
 	source := parts[0]
 	image := strings.Join(parts[1:len(parts)-2], "/")
-	digest := parts[len(parts)-1]
-	if !strings.HasPrefix(digest, "sha256:") {
+	blob := parts[len(parts)-1]
+	if _, err := digest.Parse(blob); err != nil {
 		return "", "", "", false
 	}
-	return source, image, digest, true
+	return source, image, blob, true
 }
 
 func (b *Blobs) worker(ctx context.Context) {
@@ -228,6 +286,18 @@ func (b *Blobs) worker(ctx context.Context) {
 			return
 		}
 
+		if b.rateLimits != nil {
+			if d := b.rateLimits.Delay(info.Host); d > 0 {
+				b.logger.Info("delay for upstream rate limit", "info", info, "delay", d)
+				select {
+				case <-time.After(d):
+				case <-ctx.Done():
+					finish()
+					return
+				}
+			}
+		}
+
 		size, continueFunc, sc, err := b.cacheBlob(&info)
 		if err != nil {
 			b.logger.Warn("failed download file request", "info", info, "error", err)
@@ -241,20 +311,26 @@ func (b *Blobs) worker(ctx context.Context) {
 			group = uint(len(b.groupQueue)) - 1
 		}
 
-		b.groupQueue[group].AddWeight(&downloadBlob{
+		q := b.groupQueue[group]
+		q.AddWeight(&downloadBlob{
 			ContinueFunc: continueFunc,
 			Finish:       finish,
 			Info:         info,
 		}, weight+ew)
+		metrics.BlobQueueDepth.WithLabelValues(strconv.FormatUint(uint64(group), 10)).Inc()
 	}
 }
 
-func (b *Blobs) downloadBlobWorker(ctx context.Context, queue *queue.WeightQueue[*downloadBlob]) {
+func (b *Blobs) downloadBlobWorker(ctx context.Context, queue *queue.WeightQueue[*downloadBlob], group int) {
+	// Several queues can serve one group, so the depth is counted up and
+	// down instead of being set from a single queue length.
+	depth := metrics.BlobQueueDepth.WithLabelValues(strconv.Itoa(group))
 	for {
 		bb, _, finish, ok := queue.GetOrWaitWithDone(ctx.Done())
 		if !ok {
 			return
 		}
+		depth.Dec()
 		err := bb.ContinueFunc()
 		if err != nil {
 			b.logger.Warn("failed download file", "info", bb.Info, "error", err)
@@ -321,8 +397,13 @@ func (b *Blobs) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token) bool {
 	ctx := r.Context()
 
+	if b.serveHotBlob(rw, r, info, t) {
+		return true
+	}
+
 	value, ok := b.blobCache.Get(info.Blobs)
 	if ok {
+		metrics.BlobCacheTotal.WithLabelValues("memory", "hit").Inc()
 		if value.Error != nil {
 			utils.ServeError(rw, r, value.Error, 0)
 			return true
@@ -341,11 +422,15 @@ func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobIn
 		return true
 	}
 
+	metrics.BlobCacheTotal.WithLabelValues("memory", "miss").Inc()
+
 	stat, err := b.cache.StatBlob(ctx, info.Blobs)
 	if err == nil {
+		metrics.BlobCacheTotal.WithLabelValues("storage", "hit").Inc()
 		if b.bigCache != nil && stat.Size() >= int64(b.bigCacheSize) {
 			stat, err := b.bigCache.StatBlob(ctx, info.Blobs)
 			if err == nil {
+				metrics.BlobCacheTotal.WithLabelValues("big_storage", "hit").Inc()
 				if b.serveCachedBlobHead(rw, r, stat.Size()) {
 					return true
 				}
@@ -353,6 +438,7 @@ func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobIn
 				b.serveBigCachedBlobRedirect(rw, r, info, t, stat.ModTime(), stat.Size())
 				return true
 			}
+			metrics.BlobCacheTotal.WithLabelValues("big_storage", "miss").Inc()
 		} else {
 			if b.serveCachedBlobHead(rw, r, stat.Size()) {
 				return true
@@ -362,9 +448,11 @@ func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobIn
 			return true
 		}
 	} else {
+		metrics.BlobCacheTotal.WithLabelValues("storage", "miss").Inc()
 		if b.bigCache != nil {
 			stat, err := b.bigCache.StatBlob(ctx, info.Blobs)
 			if err == nil {
+				metrics.BlobCacheTotal.WithLabelValues("big_storage", "hit").Inc()
 				if b.serveCachedBlobHead(rw, r, stat.Size()) {
 					return true
 				}
@@ -372,6 +460,7 @@ func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobIn
 				b.serveBigCachedBlobRedirect(rw, r, info, t, stat.ModTime(), stat.Size())
 				return true
 			}
+			metrics.BlobCacheTotal.WithLabelValues("big_storage", "miss").Inc()
 		}
 	}
 	return false
@@ -380,6 +469,11 @@ func (b *Blobs) serveCache(rw http.ResponseWriter, r *http.Request, info *BlobIn
 func (b *Blobs) Serve(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token) {
 	ctx := r.Context()
 
+	if b.repositoryCheck && !b.referenced(ctx, info) {
+		utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
+		return
+	}
+
 	if b.serveCache(rw, r, info, t) {
 		return
 	}
@@ -397,6 +491,9 @@ func (b *Blobs) Serve(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t
 			} else if strings.Contains(errStr, "status code 401") {
 				utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
 				return
+			} else if strings.Contains(errStr, "status code 429") {
+				utils.ServeError(rw, r, errcode.ErrorCodeTooManyRequests, 0)
+				return
 			}
 			b.logger.Warn("failed to wait queue message", "error", err)
 			utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
@@ -435,7 +532,7 @@ func (b *Blobs) cacheBlob(info *BlobInfo) (int64, func() error, int, error) {
 
 	resp, err := b.httpClient.Do(forwardReq)
 	if err != nil {
-		var tErr *transport.Error
+		var tErr *crtransport.Error
 		if errors.As(err, &tErr) {
 			return 0, nil, http.StatusForbidden, errcode.ErrorCodeDenied
 		}
@@ -454,6 +551,10 @@ func (b *Blobs) cacheBlob(info *BlobInfo) (int64, func() error, int, error) {
 		resp.Body.Close()
 		b.logger.Error("upstream denied", "statusCode", resp.StatusCode, "url", u.String())
 		return 0, nil, 0, errcode.ErrorCodeDenied
+	case http.StatusTooManyRequests:
+		resp.Body.Close()
+		b.logger.Warn("upstream rate limited", "url", u.String(), "retryAfter", resp.Header.Get("Retry-After"))
+		return 0, nil, http.StatusTooManyRequests, errcode.ErrorCodeTooManyRequests
 	}
 	if resp.StatusCode < http.StatusOK ||
 		(resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest) {
@@ -533,6 +634,11 @@ func (b *Blobs) serveCachedBlobHead(rw http.ResponseWriter, r *http.Request, siz
 }
 
 func (b *Blobs) serveBigCachedBlobRedirect(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token, modTime time.Time, size int64) {
+	if !b.bigCache.CanRedirect() {
+		b.serveCachedBlobDirect(rw, r, b.bigCache, info, t, modTime, size)
+		return
+	}
+
 	referer := r.RemoteAddr
 	if info != nil {
 		referer = fmt.Sprintf("%d-%d:%s:%s/%s", t.RegistryID, t.TokenID, referer, info.Host, info.Image)
@@ -547,12 +653,22 @@ func (b *Blobs) serveBigCachedBlobRedirect(rw http.ResponseWriter, r *http.Reque
 	}
 
 	b.blobCache.PutNoTTL(info.Blobs, modTime, size, true)
+	b.bigCache.TouchBlob(info.Blobs)
+	if b.hot != nil {
+		b.hot.hit(info.Blobs, size, b.bigCache)
+	}
 
+	metrics.BlobServeTotal.WithLabelValues("big_redirect").Inc()
 	b.logger.Info("Big Cache hit", "digest", info.Blobs, "url", u)
 	http.Redirect(rw, r, u, http.StatusTemporaryRedirect)
 }
 
 func (b *Blobs) serveCachedBlob(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token, modTime time.Time, size int64) {
+	if !b.cache.CanRedirect() {
+		b.serveCachedBlobDirect(rw, r, b.cache, info, t, modTime, size)
+		return
+	}
+
 	if t.AlwaysRedirect {
 		b.serveCachedBlobRedirect(rw, r, info, t, modTime, size)
 		return
@@ -566,13 +682,13 @@ func (b *Blobs) serveCachedBlob(rw http.ResponseWriter, r *http.Request, info *B
 				return
 			}
 		}
-		b.serveCachedBlobDirect(rw, r, info, t, modTime, size)
+		b.serveCachedBlobDirect(rw, r, b.cache, info, t, modTime, size)
 		return
 	}
 
 	if size < int64(b.blobNoRedirectSize) {
 		if b.blobNoRedirectLimit != nil && b.blobNoRedirectLimit.Allow() {
-			b.serveCachedBlobDirect(rw, r, info, t, modTime, size)
+			b.serveCachedBlobDirect(rw, r, b.cache, info, t, modTime, size)
 			return
 		}
 	}
@@ -580,13 +696,13 @@ func (b *Blobs) serveCachedBlob(rw http.ResponseWriter, r *http.Request, info *B
 	b.serveCachedBlobRedirect(rw, r, info, t, modTime, size)
 }
 
-func (b *Blobs) serveCachedBlobDirect(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token, modTime time.Time, size int64) {
+func (b *Blobs) serveCachedBlobDirect(rw http.ResponseWriter, r *http.Request, c *cache.Cache, info *BlobInfo, t *token.Token, modTime time.Time, size int64) {
 
 	ctx := r.Context()
 	rw.Header().Set("Content-Type", "application/octet-stream")
 
 	rs := seeker.NewReadSeekCloser(func(start int64) (io.ReadCloser, error) {
-		data, err := b.cache.GetBlobWithOffset(ctx, info.Blobs, start)
+		data, err := c.GetBlobWithOffset(ctx, info.Blobs, start)
 		if err != nil {
 			return nil, err
 		}
@@ -613,7 +729,15 @@ func (b *Blobs) serveCachedBlobDirect(rw http.ResponseWriter, r *http.Request, i
 
 	http.ServeContent(rw, r, "", modTime, rs)
 
-	b.blobCache.Put(info.Blobs, modTime, size, false)
+	metrics.BlobServeTotal.WithLabelValues("direct").Inc()
+	switch c {
+	case b.cache, b.bigCache:
+		b.blobCache.Put(info.Blobs, modTime, size, c == b.bigCache)
+		c.TouchBlob(info.Blobs)
+		if b.hot != nil {
+			b.hot.hit(info.Blobs, size, c)
+		}
+	}
 }
 
 func (b *Blobs) serveCachedBlobRedirect(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token, modTime time.Time, size int64) {
@@ -631,12 +755,22 @@ func (b *Blobs) serveCachedBlobRedirect(rw http.ResponseWriter, r *http.Request,
 	}
 
 	b.blobCache.Put(info.Blobs, modTime, size, false)
+	b.cache.TouchBlob(info.Blobs)
+	if b.hot != nil {
+		b.hot.hit(info.Blobs, size, b.cache)
+	}
 
+	metrics.BlobServeTotal.WithLabelValues("redirect").Inc()
 	b.logger.Info("Cache hit", "digest", info.Blobs, "url", u)
 	http.Redirect(rw, r, u, http.StatusTemporaryRedirect)
 }
 
-func (b *Blobs) waitingQueue(ctx context.Context, msg string, weight int, info *BlobInfo) error {
+func (b *Blobs) waitingQueue(ctx context.Context, msg string, weight int, info *BlobInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "blobs.waitingQueue", attribute.String("message.content", msg))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -3,8 +3,10 @@ package blobs
 import (
 	"context"
 	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/wzshiming/imc"
 )
 
@@ -41,10 +43,15 @@ func (c *blobsCache) Remove(key string) {
 }
 
 func (c *blobsCache) PutError(key string, err error, sc int) {
+	duration := c.duration
+	if sc == http.StatusTooManyRequests && duration > transport.MaxRateLimitDelay {
+		// Let the blob be retried once the upstream quota may have recovered.
+		duration = transport.MaxRateLimitDelay
+	}
 	c.digest.SetWithTTL(key, blobValue{
 		Error:      err,
 		StatusCode: sc,
-	}, c.duration)
+	}, duration)
 }
 
 func (c *blobsCache) Put(key string, modTime time.Time, size int64, bigCache bool) {
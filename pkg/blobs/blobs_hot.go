@@ -0,0 +1,315 @@
+package blobs
+
+import (
+	"container/list"
+	"context"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+)
+
+// maxHitsTracked bounds the hit counts kept for blobs not yet promoted.
+const maxHitsTracked = 100000
+
+// hotCache keeps the most served blobs on local disk in front of the object
+// storage, up to capacity bytes, evicting the least recently used.
+type hotCache struct {
+	cache    *cache.Cache
+	capacity int64
+	minHits  int
+	logger   *slog.Logger
+
+	mut       sync.Mutex
+	size      int64
+	lru       *list.List
+	blobs     map[string]*list.Element
+	hits      map[string]int
+	promoting map[string]struct{}
+	semaphore chan struct{}
+
+	// inUse counts the blobs being served, evicted ones are only deleted
+	// once the last of them is done.
+	inUse   map[string]int
+	evicted map[string]struct{}
+}
+
+type hotBlob struct {
+	blob    string
+	size    int64
+	modTime time.Time
+	// src is the cache the blob was promoted from, nil for blobs found on
+	// the hot cache at start.
+	src *cache.Cache
+}
+
+func newHotCache(ctx context.Context, c *cache.Cache, capacity int64, minHits int, logger *slog.Logger) (*hotCache, error) {
+	h := &hotCache{
+		cache:     c,
+		capacity:  capacity,
+		minHits:   minHits,
+		logger:    logger,
+		lru:       list.New(),
+		blobs:     map[string]*list.Element{},
+		hits:      map[string]int{},
+		promoting: map[string]struct{}{},
+		semaphore: make(chan struct{}, 2),
+		inUse:     map[string]int{},
+		evicted:   map[string]struct{}{},
+	}
+
+	var existing []hotBlob
+	err := c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		existing = append(existing, hotBlob{
+			blob:    blob,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.mut.Lock()
+	for _, b := range existing {
+		h.insert(b)
+	}
+	evicted := h.evict()
+	h.mut.Unlock()
+	h.delete(ctx, evicted)
+
+	return h, nil
+}
+
+// has reports whether the blob is kept on the hot cache.
+func (h *hotCache) has(blob string) bool {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	_, ok := h.blobs[blob]
+	return ok
+}
+
+// get returns the blob if it is kept on the hot cache, marking it used. The
+// blob is not deleted until release is called.
+func (h *hotCache) get(ctx context.Context, blob string) (_ hotBlob, release func(), _ bool) {
+	h.mut.Lock()
+	e, ok := h.blobs[blob]
+	if ok {
+		h.lru.MoveToFront(e)
+		h.inUse[blob]++
+	}
+	h.mut.Unlock()
+	if !ok {
+		return hotBlob{}, nil, false
+	}
+
+	release = func() {
+		h.mut.Lock()
+		h.inUse[blob]--
+		if h.inUse[blob] > 0 {
+			h.mut.Unlock()
+			return
+		}
+		delete(h.inUse, blob)
+		_, evicted := h.evicted[blob]
+		delete(h.evicted, blob)
+		h.mut.Unlock()
+		if evicted {
+			h.delete(context.Background(), []string{blob})
+		}
+	}
+
+	b := e.Value.(hotBlob)
+	_, err := h.cache.StatBlob(ctx, blob)
+	if err != nil {
+		h.logger.Warn("hot cache blob is gone", "digest", blob, "error", err)
+		h.mut.Lock()
+		h.remove(blob)
+		h.mut.Unlock()
+		release()
+		return hotBlob{}, nil, false
+	}
+	return b, release, true
+}
+
+// hit records that blob has been served from src, and copies it to the hot
+// cache once it has been served often enough.
+func (h *hotCache) hit(blob string, size int64, src *cache.Cache) {
+	if size > h.capacity {
+		return
+	}
+
+	h.mut.Lock()
+	if _, ok := h.blobs[blob]; ok {
+		h.mut.Unlock()
+		return
+	}
+	if _, ok := h.promoting[blob]; ok {
+		h.mut.Unlock()
+		return
+	}
+	if len(h.hits) >= maxHitsTracked {
+		h.hits = map[string]int{}
+	}
+	h.hits[blob]++
+	if h.hits[blob] < h.minHits {
+		h.mut.Unlock()
+		return
+	}
+	delete(h.hits, blob)
+	h.promoting[blob] = struct{}{}
+	h.mut.Unlock()
+
+	go h.promote(context.Background(), blob, src)
+}
+
+func (h *hotCache) promote(ctx context.Context, blob string, src *cache.Cache) {
+	defer func() {
+		h.mut.Lock()
+		delete(h.promoting, blob)
+		h.mut.Unlock()
+	}()
+
+	select {
+	case h.semaphore <- struct{}{}:
+		defer func() { <-h.semaphore }()
+	default:
+		// Promotions are best effort, drop this one while busy.
+		return
+	}
+
+	r, err := src.GetBlob(ctx, blob)
+	if err != nil {
+		h.logger.Warn("failed to read blob for hot cache", "digest", blob, "error", err)
+		return
+	}
+	defer r.Close()
+
+	size, err := h.cache.PutBlob(ctx, blob, r)
+	if err != nil {
+		h.logger.Warn("failed to promote blob to hot cache", "digest", blob, "error", err)
+		return
+	}
+
+	h.mut.Lock()
+	h.insert(hotBlob{
+		blob:    blob,
+		size:    size,
+		modTime: time.Now(),
+		src:     src,
+	})
+	evicted := h.evict()
+	h.mut.Unlock()
+	h.delete(ctx, evicted)
+
+	h.logger.Info("promote blob to hot cache", "digest", blob, "size", size)
+}
+
+func (h *hotCache) insert(b hotBlob) {
+	if _, ok := h.blobs[b.blob]; ok {
+		return
+	}
+	h.blobs[b.blob] = h.lru.PushFront(b)
+	h.size += b.size
+	delete(h.evicted, b.blob)
+}
+
+func (h *hotCache) remove(blob string) {
+	e, ok := h.blobs[blob]
+	if !ok {
+		return
+	}
+	h.lru.Remove(e)
+	delete(h.blobs, blob)
+	h.size -= e.Value.(hotBlob).size
+}
+
+// forget drops the blob from the index, it is served from the other caches
+// until it is promoted again.
+func (h *hotCache) forget(blob string) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.remove(blob)
+	delete(h.hits, blob)
+}
+
+// evict drops the least recently used blobs from the index until it fits in
+// capacity, returning them to be deleted.
+func (h *hotCache) evict() []string {
+	var evicted []string
+	for h.size > h.capacity {
+		e := h.lru.Back()
+		if e == nil {
+			break
+		}
+		blob := e.Value.(hotBlob).blob
+		h.remove(blob)
+		evicted = append(evicted, blob)
+	}
+	return evicted
+}
+
+// delete removes evicted blobs from the hot cache, deferring the ones being
+// served until they are released.
+func (h *hotCache) delete(ctx context.Context, blobs []string) {
+	for _, blob := range blobs {
+		h.mut.Lock()
+		if _, ok := h.blobs[blob]; ok {
+			// Promoted again since it was evicted.
+			h.mut.Unlock()
+			continue
+		}
+		if h.inUse[blob] > 0 {
+			h.evicted[blob] = struct{}{}
+			h.mut.Unlock()
+			continue
+		}
+		h.mut.Unlock()
+
+		err := h.cache.DeleteBlob(ctx, blob)
+		if err != nil {
+			h.logger.Warn("failed to evict blob from hot cache", "digest", blob, "error", err)
+			continue
+		}
+		h.logger.Info("evict blob from hot cache", "digest", blob)
+	}
+}
+
+// serveHotBlob serves the blob directly from the hot cache if it is kept there.
+func (b *Blobs) serveHotBlob(rw http.ResponseWriter, r *http.Request, info *BlobInfo, t *token.Token) bool {
+	if b.hot == nil {
+		return false
+	}
+
+	hb, release, ok := b.hot.get(r.Context(), info.Blobs)
+	if !ok {
+		metrics.BlobCacheTotal.WithLabelValues("hot_storage", "miss").Inc()
+		return false
+	}
+	defer release()
+	metrics.BlobCacheTotal.WithLabelValues("hot_storage", "hit").Inc()
+
+	// Keep the blob recently used on the cache backing the hot cache, or it
+	// is evicted there while served hot.
+	src := hb.src
+	if src == nil {
+		src = b.cache
+		if b.bigCache != nil && hb.size >= int64(b.bigCacheSize) {
+			src = b.bigCache
+		}
+	}
+	src.TouchBlob(info.Blobs)
+
+	if b.serveCachedBlobHead(rw, r, hb.size) {
+		return true
+	}
+
+	b.serveCachedBlobDirect(rw, r, b.hot.cache, info, t, hb.modTime, hb.size)
+	return true
+}
@@ -0,0 +1,159 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+)
+
+func TestHotCache(t *testing.T) {
+	ctx := context.Background()
+	src, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var digests []string
+	for _, content := range []string{"aaaa", "bbbb", "cccc"} {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+		_, err := src.PutBlob(ctx, digest, bytes.NewBufferString(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, digest)
+	}
+
+	h, err := newHotCache(ctx, dst, 8, 2, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	has := func(blob string) bool {
+		_, release, ok := h.get(ctx, blob)
+		if ok {
+			release()
+		}
+		return ok
+	}
+
+	promote := func(blob string) {
+		t.Helper()
+		h.hit(blob, 4, src)
+		h.hit(blob, 4, src)
+		for i := 0; i < 100; i++ {
+			if has(blob) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("blob %s was not promoted", blob)
+	}
+
+	h.hit(digests[0], 4, src)
+	if has(digests[0]) {
+		t.Fatalf("blob promoted before min hits")
+	}
+
+	promote(digests[0])
+	promote(digests[1])
+
+	// Use the first blob so the second one is the least recently used.
+	if !has(digests[0]) {
+		t.Fatalf("blob %s evicted", digests[0])
+	}
+
+	promote(digests[2])
+
+	if has(digests[1]) {
+		t.Errorf("least recently used blob %s not evicted", digests[1])
+	}
+	if _, err := dst.StatBlob(ctx, digests[1]); err == nil {
+		t.Errorf("evicted blob %s still in storage", digests[1])
+	}
+	for _, blob := range []string{digests[0], digests[2]} {
+		if !has(blob) {
+			t.Errorf("blob %s not kept", blob)
+		}
+	}
+
+	// A blob evicted while served is only deleted once served.
+	_, release, ok := h.get(ctx, digests[0])
+	if !ok {
+		t.Fatalf("blob %s not kept", digests[0])
+	}
+	h.mut.Lock()
+	h.remove(digests[0])
+	h.mut.Unlock()
+	h.delete(ctx, []string{digests[0]})
+	if _, err := dst.StatBlob(ctx, digests[0]); err != nil {
+		t.Errorf("blob %s deleted while served: %v", digests[0], err)
+	}
+	release()
+	if _, err := dst.StatBlob(ctx, digests[0]); err == nil {
+		t.Errorf("evicted blob %s still in storage after served", digests[0])
+	}
+}
+
+func TestServeHotBlobTouchesSource(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()), cache.WithAccessFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBlobs(WithCache(c), WithHotCache(hot, 1024, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hot")
+	blob := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	_, err = hot.PutBlob(ctx, blob, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.hot.mut.Lock()
+	b.hot.insert(hotBlob{blob: blob, size: int64(len(content)), modTime: time.Now()})
+	b.hot.mut.Unlock()
+
+	rw := httptest.NewRecorder()
+	if !b.serveHotBlob(rw, httptest.NewRequest(http.MethodGet, "/", nil), &BlobInfo{Blobs: blob}, &token.Token{}) {
+		t.Fatal("serveHotBlob() = false, want served from the hot cache")
+	}
+	if rw.Body.String() != string(content) {
+		t.Errorf("serveHotBlob() body = %q, want %q", rw.Body.String(), content)
+	}
+
+	err = c.FlushBlobAccess(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var touched []string
+	err = c.WalkBlobAccess(ctx, func(blob string, accessed time.Time) bool {
+		touched = append(touched, blob)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(touched) != 1 || touched[0] != blob {
+		t.Errorf("blobs touched on the backing cache = %v, want [%s]", touched, blob)
+	}
+}
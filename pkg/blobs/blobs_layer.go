@@ -0,0 +1,67 @@
+package blobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+)
+
+// WithRepositoryCheck only serves a cached blob under repositories having a
+// cached manifest that references it, blobs not yet cached are left to the
+// upstream to authorize.
+func WithRepositoryCheck(repositoryCheck bool) Option {
+	return func(c *Blobs) error {
+		c.repositoryCheck = repositoryCheck
+		return nil
+	}
+}
+
+// layerDeniedTTL is how long a blob not referenced by a repository is denied
+// without checking again, short as the manifest referencing it may be cached
+// right after.
+const layerDeniedTTL = time.Minute
+
+// referenced reports whether the blob may be served from the cache under
+// the repository of info.
+func (b *Blobs) referenced(ctx context.Context, info *BlobInfo) bool {
+	key := info.Host + "/" + info.Image + "@" + info.Blobs
+	if ok, found := b.layers.Get(key); found {
+		return ok
+	}
+
+	value, ok := b.blobCache.Get(info.Blobs)
+	if (!ok || value.Error != nil) && !b.cached(ctx, info.Blobs) {
+		return true
+	}
+
+	ok, err := b.cache.HasLayer(ctx, info.Host, info.Image, info.Blobs)
+	if err != nil {
+		b.logger.Warn("failed to check layer link", "info", info, "error", err)
+		return false
+	}
+	if !ok {
+		metrics.BlobUnreferencedTotal.Inc()
+		b.logger.Info("blob not referenced by repository", "info", info)
+		b.layers.SetWithTTL(key, false, layerDeniedTTL)
+		return false
+	}
+	b.layers.SetWithTTL(key, true, b.blobCacheDuration)
+	return true
+}
+
+// cached reports whether the blob is kept on any tier.
+func (b *Blobs) cached(ctx context.Context, blob string) bool {
+	if b.hot != nil && b.hot.has(blob) {
+		return true
+	}
+	if _, err := b.cache.StatBlob(ctx, blob); err == nil {
+		return true
+	}
+	if b.bigCache != nil {
+		if _, err := b.bigCache.StatBlob(ctx, blob); err == nil {
+			return true
+		}
+	}
+	return false
+}
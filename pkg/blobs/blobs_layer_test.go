@@ -0,0 +1,71 @@
+package blobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReferenced(t *testing.T) {
+	ctx := context.Background()
+	newCache := func() *cache.Cache {
+		c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	c, big, hot := newCache(), newCache(), newCache()
+	b, err := NewBlobs(WithCache(c), WithBigCache(big, 1), WithHotCache(hot, 1024, 1), WithRepositoryCheck(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(c *cache.Cache, content string) string {
+		blob := digest.FromString(content).String()
+		_, err := c.PutBlobContent(ctx, blob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+	linked := put(c, "linked")
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", []byte(`{"schemaVersion":2,"layers":[{"digest":"`+linked+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigOnly := put(big, "big")
+	hotOnly := put(hot, "hot")
+	b.hot.mut.Lock()
+	b.hot.insert(hotBlob{blob: hotOnly, size: 3, modTime: time.Now()})
+	b.hot.mut.Unlock()
+
+	tests := []struct {
+		name string
+		blob string
+		want bool
+		// wantRemembered is set when the result is kept, not checked again.
+		wantRemembered bool
+	}{
+		{name: "linked", blob: linked, want: true, wantRemembered: true},
+		{name: "not cached", blob: digest.FromString("missing").String(), want: true},
+		{name: "big cache only", blob: bigOnly, wantRemembered: true},
+		{name: "hot cache only", blob: hotOnly, wantRemembered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &BlobInfo{Host: "docker.io", Image: "library/busybox", Blobs: tt.blob}
+			if got := b.referenced(ctx, info); got != tt.want {
+				t.Errorf("referenced() = %v, want %v", got, tt.want)
+			}
+			got, ok := b.layers.Get(info.Host + "/" + info.Image + "@" + info.Blobs)
+			if ok != tt.wantRemembered || (ok && got != tt.want) {
+				t.Errorf("remembered result = %v, %v, want %v, %v", got, ok, tt.want, tt.wantRemembered)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/sets"
+	"github.com/OpenCIDN/OpenCIDN/internal/throttled"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/time/rate"
+)
+
+var errCorrupted = errors.New("blob does not match its digest")
+
+// WithScrubInterval re-hashes every stored blob at this interval, corrupted
+// blobs are quarantined and fetched again from upstream.
+func WithScrubInterval(scrubInterval time.Duration) Option {
+	return func(c *Blobs) error {
+		c.scrubInterval = scrubInterval
+		return nil
+	}
+}
+
+// WithScrubMaxSizePerSecond limits how fast the scrubber reads from storage.
+func WithScrubMaxSizePerSecond(scrubMaxSizePerSecond int) Option {
+	return func(c *Blobs) error {
+		if scrubMaxSizePerSecond > 0 {
+			c.scrubLimit = rate.NewLimiter(rate.Limit(scrubMaxSizePerSecond), 32*1024)
+		} else {
+			c.scrubLimit = nil
+		}
+		return nil
+	}
+}
+
+func (b *Blobs) runScrub(ctx context.Context) {
+	for {
+		caches := []*cache.Cache{b.cache, b.bigCache}
+		if b.hot != nil {
+			caches = append(caches, b.hot.cache)
+		}
+		for _, c := range caches {
+			if c == nil {
+				continue
+			}
+			err := b.scrub(ctx, c)
+			if err != nil {
+				b.logger.Warn("failed to scrub blobs", "error", err)
+			}
+		}
+
+		select {
+		case <-time.After(b.scrubInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scrub re-hashes the blobs of c and quarantines the corrupted ones.
+func (b *Blobs) scrub(ctx context.Context, c *cache.Cache) error {
+	var blobs []string
+	err := c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		blobs = append(blobs, blob)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	var corrupted []string
+	for _, blob := range blobs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := b.verifyBlob(ctx, c, blob)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, errCorrupted) {
+			b.logger.Warn("failed to verify blob", "digest", blob, "error", err)
+			continue
+		}
+
+		b.logger.Error("quarantine corrupted blob", "digest", blob, "error", err)
+		metrics.BlobCorruptedTotal.Inc()
+		err = c.QuarantineBlob(ctx, blob, err.Error())
+		if err != nil {
+			b.logger.Warn("failed to quarantine blob", "digest", blob, "error", err)
+			continue
+		}
+		b.blobCache.Remove(blob)
+		if b.hot != nil {
+			// A hot copy was promoted from the corrupted data, or is the
+			// corrupted data itself.
+			b.hot.forget(blob)
+			if c != b.hot.cache {
+				b.hot.delete(ctx, []string{blob})
+			}
+		}
+		corrupted = append(corrupted, blob)
+	}
+
+	// The hot cache is filled again from the caches behind it.
+	if len(corrupted) == 0 || (b.hot != nil && c == b.hot.cache) {
+		return nil
+	}
+	return b.refetch(ctx, c, corrupted)
+}
+
+func (b *Blobs) verifyBlob(ctx context.Context, c *cache.Cache, blob string) error {
+	d, err := digest.Parse(blob)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.GetBlob(ctx, blob)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var body io.Reader = r
+	if b.scrubLimit != nil {
+		body = throttled.NewThrottledReader(ctx, body, b.scrubLimit)
+	}
+
+	digester := d.Algorithm().Digester()
+	n, err := io.Copy(digester.Hash(), body)
+	metrics.BlobScrubbedBytesTotal.Add(float64(n))
+	if err != nil {
+		return err
+	}
+
+	got := digester.Digest()
+	if got != d {
+		return fmt.Errorf("%w: got %s after %d bytes", errCorrupted, got, n)
+	}
+	return nil
+}
+
+// refetch removes the manifest links pointing to the corrupted blobs and
+// queues the blobs to be fetched again, from a repository referencing them.
+func (b *Blobs) refetch(ctx context.Context, c *cache.Cache, corrupted []string) error {
+	corruptedSet := sets.NewSet(corrupted...)
+	repos := map[string]string{}
+	manifests := false
+
+	type revision struct {
+		repo, blob string
+	}
+	var revisions []revision
+	err := c.WalkManifestRevisions(ctx, func(repo, blob string) bool {
+		revisions = append(revisions, revision{repo, blob})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rev := range revisions {
+		host, image, ok := strings.Cut(rev.repo, "/")
+		if !ok {
+			continue
+		}
+
+		if corruptedSet.Contains(rev.blob) {
+			manifests = true
+			err := c.DeleteManifestRevision(ctx, host, image, rev.blob)
+			if err != nil {
+				b.logger.Warn("failed to delete revision", "repo", rev.repo, "digest", rev.blob, "error", err)
+			}
+			b.requeueManifest(ctx, host, image, rev.repo+"@"+rev.blob)
+			continue
+		}
+
+		content, err := c.GetBlobContent(ctx, rev.blob)
+		if err != nil {
+			continue
+		}
+		for _, blob := range corrupted {
+			if _, ok := repos[blob]; !ok && bytes.Contains(content, []byte(blob)) {
+				repos[blob] = rev.repo
+			}
+		}
+	}
+
+	if manifests {
+		type tag struct {
+			repo, tag string
+		}
+		var tags []tag
+		err = c.WalkManifestTags(ctx, func(repo, t string, info fs.FileInfo) bool {
+			tags = append(tags, tag{repo, t})
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tags {
+			host, image, ok := strings.Cut(t.repo, "/")
+			if !ok {
+				continue
+			}
+			tagDigest, err := c.DigestManifest(ctx, host, image, t.tag)
+			if err != nil || !corruptedSet.Contains(tagDigest) {
+				continue
+			}
+			err = c.DeleteManifestTag(ctx, host, image, t.tag)
+			if err != nil {
+				b.logger.Warn("failed to delete tag", "repo", t.repo, "tag", t.tag, "error", err)
+			}
+			b.requeueManifest(ctx, host, image, t.repo+":"+t.tag)
+		}
+	}
+
+	for blob, repo := range repos {
+		host, image, _ := strings.Cut(repo, "/")
+		info := BlobInfo{
+			Host:  host,
+			Image: image,
+			Blobs: blob,
+		}
+		if b.queueClient != nil {
+			// The blob was fetched before, renew its finished message.
+			_, err := b.queueClient.Renew(ctx, blob, 0, model.MessageAttr{
+				Kind:  model.KindBlob,
+				Host:  host,
+				Image: image,
+			})
+			if err != nil {
+				b.logger.Warn("failed to queue blob", "digest", blob, "error", err)
+				continue
+			}
+		} else {
+			b.queue.AddWeight(info, 0)
+		}
+		b.logger.Info("queue corrupted blob", "digest", blob, "repo", repo)
+	}
+	return nil
+}
+
+// requeueManifest queues a manifest whose links were removed, renewing the
+// message it was fetched by. Without a queue it is fetched again on the next
+// pull.
+func (b *Blobs) requeueManifest(ctx context.Context, host, image, content string) {
+	if b.queueClient == nil {
+		return
+	}
+	_, err := b.queueClient.Renew(ctx, content, 0, model.MessageAttr{
+		Kind:  model.KindManifest,
+		Host:  host,
+		Image: image,
+	})
+	if err != nil {
+		b.logger.Warn("failed to queue manifest", "manifest", content, "error", err)
+		return
+	}
+	b.logger.Info("queue corrupted manifest", "manifest", content)
+}
@@ -0,0 +1,204 @@
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/queuetest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+)
+
+func TestScrub(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBlobs(WithCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := []byte("good")
+	goodDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(good))
+	_, err = c.PutBlobContent(ctx, goodDigest, good)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	_, manifestDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the manifest at rest.
+	hex := manifestDigest[len("sha256:"):]
+	err = c.PutContent(ctx, "/docker/registry/v2/blobs/sha256/"+hex[:2]+"/"+hex+"/data", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.scrub(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.StatBlob(ctx, goodDigest); err != nil {
+		t.Errorf("good blob removed: %v", err)
+	}
+	if _, err := c.StatBlob(ctx, manifestDigest); err == nil {
+		t.Errorf("corrupted blob not quarantined")
+	}
+	if _, err := c.StatManifestTag(ctx, "docker.io", "library/busybox", "latest"); err == nil {
+		t.Errorf("tag pointing to corrupted manifest not removed")
+	}
+	err = c.WalkManifestRevisions(ctx, func(repo, blob string) bool {
+		t.Errorf("revision %s@%s of corrupted manifest not removed", repo, blob)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubHot(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both blobs are kept hot, one is corrupted behind the hot cache and the
+	// other on it.
+	var digests []string
+	for _, content := range []string{"backing", "hot"} {
+		blob := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+		for _, c := range []*cache.Cache{c, hot} {
+			_, err = c.PutBlobContent(ctx, blob, []byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		digests = append(digests, blob)
+	}
+	backing, corrupted := digests[0], digests[1]
+
+	b, err := NewBlobs(WithCache(c), WithHotCache(hot, 1024, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for blob, c := range map[string]*cache.Cache{backing: c, corrupted: hot} {
+		hex := blob[len("sha256:"):]
+		err = c.PutContent(ctx, "/docker/registry/v2/blobs/sha256/"+hex[:2]+"/"+hex+"/data", []byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []*cache.Cache{c, hot} {
+		err = b.scrub(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, blob := range digests {
+		if b.hot.has(blob) {
+			t.Errorf("corrupted blob %s still kept hot", blob)
+		}
+		if _, err := hot.StatBlob(ctx, blob); err == nil {
+			t.Errorf("corrupted blob %s not removed from the hot cache", blob)
+		}
+	}
+	if _, err := c.StatBlob(ctx, corrupted); err != nil {
+		t.Errorf("blob corrupted on the hot cache removed behind it: %v", err)
+	}
+}
+
+func TestScrubRequeue(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := queuetest.NewQueue(t)
+	queueClient := queue.MessageClient()
+	b, err := NewBlobs(WithCache(c), WithQueueClient(queueClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := []byte("layer")
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	_, err = c.PutBlobContent(ctx, layerDigest, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/alpine", "latest", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"`+layerDigest+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, manifestDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both were fetched through the queue before.
+	contents := []string{layerDigest, "docker.io/library/busybox:latest"}
+	for _, content := range contents {
+		mr, err := queueClient.Create(ctx, content, 0, model.MessageAttr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = queueClient.Consume(ctx, mr.MessageID, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = queueClient.Complete(ctx, mr.MessageID, client.CompletedRequest{Lease: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Corrupt both at rest.
+	for _, blob := range []string{layerDigest, manifestDigest} {
+		hex := blob[len("sha256:"):]
+		err = c.PutContent(ctx, "/docker/registry/v2/blobs/sha256/"+hex[:2]+"/"+hex+"/data", []byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = b.scrub(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := queueClient.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := map[string]bool{}
+	for _, m := range messages {
+		if m.Status == model.StatusPending {
+			pending[m.Content] = true
+		}
+	}
+	for _, content := range contents {
+		if !pending[content] {
+			t.Errorf("%s not queued again, messages %v", content, messages)
+		}
+	}
+}
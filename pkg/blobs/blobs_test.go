@@ -0,0 +1,67 @@
+package blobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/registrytest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestServeBlob(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	content := []byte("layer content")
+	blob := registry.PutBlob(content)
+
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBlobs(WithCache(c), WithClient(registry.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, blob string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		b.ServeHTTP(rw, httptest.NewRequest(method, "/v2/"+registry.Host()+"/library/busybox/blobs/"+blob, nil))
+		return rw
+	}
+
+	rw := serve(http.MethodGet, blob)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() = %d %s, want %d", rw.Code, rw.Body.String(), http.StatusOK)
+	}
+	if rw.Body.String() != string(content) {
+		t.Errorf("ServeHTTP() body = %q, want %q", rw.Body.String(), content)
+	}
+
+	got, err := c.GetBlobContent(ctx, blob)
+	if err != nil || string(got) != string(content) {
+		t.Errorf("cached blob = %q, %v, want %q", got, err, content)
+	}
+
+	// Served from the cache from now on.
+	requests := registry.Requests()
+	rw = serve(http.MethodHead, blob)
+	if rw.Code != http.StatusOK {
+		t.Errorf("ServeHTTP(HEAD) = %d, want %d", rw.Code, http.StatusOK)
+	}
+	if got, want := rw.Header().Get("Content-Length"), strconv.Itoa(len(content)); got != want {
+		t.Errorf("Content-Length = %q, want %q", got, want)
+	}
+	if got := registry.Requests(); got != requests {
+		t.Errorf("upstream requests = %d, want %d", got, requests)
+	}
+
+	rw = serve(http.MethodGet, digest.FromString("missing").String())
+	if rw.Code == http.StatusOK {
+		t.Errorf("ServeHTTP(missing) = %d, want an error", rw.Code)
+	}
+}
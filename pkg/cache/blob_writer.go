@@ -2,21 +2,20 @@ package cache
 
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
-	"hash"
 
-	"github.com/wzshiming/sss"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/opencontainers/go-digest"
 )
 
 type blobWriter struct {
-	sss.FileWriter
-	cacheHash string
-	h         hash.Hash
+	storage.FileWriter
+	cacheHash digest.Digest
+	digester  digest.Digester
 }
 
 func (bw *blobWriter) Commit(ctx context.Context) error {
-	hash := hex.EncodeToString(bw.h.Sum(nil)[:])
+	hash := bw.digester.Digest()
 	if bw.cacheHash != hash {
 		return fmt.Errorf("expected %s hash, got %s", bw.cacheHash, hash)
 	}
@@ -24,6 +23,6 @@ func (bw *blobWriter) Commit(ctx context.Context) error {
 }
 
 func (bw *blobWriter) Write(p []byte) (int, error) {
-	bw.h.Write(p)
+	bw.digester.Hash().Write(p)
 	return bw.FileWriter.Write(p)
 }
@@ -3,8 +3,6 @@ package cache
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
@@ -14,15 +12,19 @@ import (
 	"sync"
 	"time"
 
-	"github.com/wzshiming/sss"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
 )
 
 type Cache struct {
 	bytesPool     sync.Pool
-	storageDriver *sss.SSS
+	storageDriver storage.Driver
+	storageURL    string
 	linkExpires   time.Duration
 	signLink      bool
 	redirectLinks *url.URL
+
+	accessFlushInterval time.Duration
+	accessTracker       *accessTracker
 }
 
 type Option func(c *Cache)
@@ -39,7 +41,9 @@ func WithRedirectLinks(l *url.URL) Option {
 	}
 }
 
-func WithStorageDriver(storageDriver *sss.SSS) Option {
+// WithStorageDriver sets the storage the cache is kept in, like an
+// s3.Driver, a filesystem.FileSystem or a memory.Memory.
+func WithStorageDriver(storageDriver storage.Driver) Option {
 	return func(c *Cache) {
 		c.storageDriver = storageDriver
 	}
@@ -64,13 +68,36 @@ func NewCache(opts ...Option) (*Cache, error) {
 		opt(c)
 	}
 
+	if c.storageURL != "" {
+		sd, err := NewStorageDriver(c.storageURL)
+		if err != nil {
+			return nil, fmt.Errorf("create storage driver failed: %w", err)
+		}
+		c.storageDriver = sd
+	}
+
 	_, err := c.put(context.Background(), "opencidn.txt", bytes.NewBufferString("opencidn"), nil)
 	if err != nil {
 		return nil, err
 	}
+
+	if c.accessFlushInterval > 0 {
+		c.accessTracker = &accessTracker{
+			accessed: map[string]time.Time{},
+		}
+	}
 	return c, nil
 }
 
+// CanRedirect reports whether Redirect can hand out links to the content.
+func (c *Cache) CanRedirect() bool {
+	if !c.signLink && c.redirectLinks != nil {
+		return true
+	}
+	_, ok := c.storageDriver.(storage.Signer)
+	return ok
+}
+
 func (c *Cache) Redirect(ctx context.Context, blobPath string, referer string) (string, error) {
 	if !c.signLink && c.redirectLinks != nil {
 		u, err := c.redirectLinks.Parse(strings.TrimPrefix(blobPath, "/"))
@@ -80,9 +107,14 @@ func (c *Cache) Redirect(ctx context.Context, blobPath string, referer string) (
 		return u.String(), nil
 	}
 
+	s, ok := c.storageDriver.(storage.Signer)
+	if !ok {
+		return "", ErrRedirectNotSupported
+	}
+
 	linkExpires := c.linkExpires
 
-	u, err := c.storageDriver.SignGet(blobPath, linkExpires)
+	u, err := s.SignGet(blobPath, linkExpires)
 	if err != nil {
 		return "", err
 	}
@@ -98,14 +130,14 @@ func (c *Cache) Redirect(ctx context.Context, blobPath string, referer string) (
 	return u, nil
 }
 
-func (c *Cache) Writer(ctx context.Context, cachePath string, append bool) (sss.FileWriter, error) {
+func (c *Cache) Writer(ctx context.Context, cachePath string, append bool) (storage.FileWriter, error) {
 	if append {
 		return c.storageDriver.WriterWithAppend(ctx, cachePath)
 	}
 	return c.storageDriver.Writer(ctx, cachePath)
 }
 
-func (c *Cache) BlobWriter(ctx context.Context, blob string, append bool) (sss.FileWriter, error) {
+func (c *Cache) BlobWriter(ctx context.Context, blob string, append bool) (storage.FileWriter, error) {
 	cachePath := blobCachePath(blob)
 
 	if append {
@@ -116,10 +148,16 @@ func (c *Cache) BlobWriter(ctx context.Context, blob string, append bool) (sss.F
 		return nil, err
 	}
 
+	d, err := parseDigest(blob)
+	if err != nil {
+		fw.Close()
+		return nil, err
+	}
+
 	return &blobWriter{
 		FileWriter: fw,
-		h:          sha256.New(),
-		cacheHash:  cleanDigest(blob),
+		digester:   d.Algorithm().Digester(),
+		cacheHash:  d,
 	}, nil
 }
 
@@ -134,23 +172,36 @@ func (c *Cache) put(ctx context.Context, cachePath string, r io.Reader, checkFun
 
 	n, err := io.CopyBuffer(fw, r, buf)
 	if err != nil {
+		cancelWriter(ctx, fw)
 		return 0, err
 	}
 
 	if checkFunc != nil {
 		err = checkFunc(n)
 		if err != nil {
+			cancelWriter(ctx, fw)
 			return 0, err
 		}
 	}
 
 	err = fw.Commit(ctx)
 	if err != nil {
+		cancelWriter(ctx, fw)
 		return 0, err
 	}
 	return n, nil
 }
 
+// cancelWriter drops a write that will not be committed, so neither the
+// file nor what has been staged is left behind.
+func cancelWriter(ctx context.Context, fw storage.FileWriter) {
+	if c, ok := fw.(storage.Canceler); ok {
+		_ = c.Cancel(ctx)
+		return
+	}
+	_ = fw.Close()
+}
+
 func (c *Cache) Put(ctx context.Context, cachePath string, r io.Reader) (int64, error) {
 	return c.put(ctx, cachePath, r, nil)
 }
@@ -159,15 +210,20 @@ func (c *Cache) PutContent(ctx context.Context, cachePath string, content []byte
 	return c.storageDriver.PutContent(ctx, cachePath, content)
 }
 
+// PutWithHash writes r to cachePath, committing only if it matches the
+// digest cacheHash, hex encoded sha256 when it has no algorithm prefix.
 func (c *Cache) PutWithHash(ctx context.Context, cachePath string, r io.Reader, cacheHash string, cacheSize int64) (int64, error) {
-	h := sha256.New()
-	return c.put(ctx, cachePath, io.TeeReader(r, h), func(i int64) error {
+	d, err := parseDigest(cacheHash)
+	if err != nil {
+		return 0, err
+	}
+	digester := d.Algorithm().Digester()
+	return c.put(ctx, cachePath, io.TeeReader(r, digester.Hash()), func(i int64) error {
 		if cacheSize > 0 && i != cacheSize {
 			return fmt.Errorf("expected %d bytes, got %d", cacheSize, i)
 		}
-		hash := hex.EncodeToString(h.Sum(nil)[:])
-		if cacheHash != hash {
-			return fmt.Errorf("expected %s hash, got %s", cacheHash, hash)
+		if got := digester.Digest(); got != d {
+			return fmt.Errorf("expected %s hash, got %s", d, got)
 		}
 		return nil
 	})
@@ -189,12 +245,12 @@ func (c *Cache) GetContent(ctx context.Context, cachePath string) ([]byte, error
 	return c.storageDriver.GetContent(ctx, cachePath)
 }
 
-func (c *Cache) Stat(ctx context.Context, cachePath string) (sss.FileInfo, error) {
+func (c *Cache) Stat(ctx context.Context, cachePath string) (storage.FileInfo, error) {
 	return c.storageDriver.Stat(ctx, cachePath)
 }
 
 func (c *Cache) Walk(ctx context.Context, cachePath string, fun fs.WalkDirFunc) error {
-	return c.storageDriver.Walk(ctx, cachePath, func(fi sss.FileInfo) error {
+	return c.storageDriver.Walk(ctx, cachePath, func(fi storage.FileInfo) error {
 		p := fi.Path()
 		fiw := fileInfoWrap{
 			name:     path.Base(p),
@@ -207,7 +263,7 @@ func (c *Cache) Walk(ctx context.Context, cachePath string, fun fs.WalkDirFunc)
 
 func (c *Cache) List(ctx context.Context, cachePath string) ([]string, error) {
 	list := []string{}
-	err := c.storageDriver.List(ctx, cachePath, func(fileInfo sss.FileInfo) bool {
+	err := c.storageDriver.List(ctx, cachePath, func(fileInfo storage.FileInfo) bool {
 		list = append(list, fileInfo.Path())
 		return true
 	})
@@ -219,7 +275,7 @@ func (c *Cache) List(ctx context.Context, cachePath string) ([]string, error) {
 
 type fileInfoWrap struct {
 	name string
-	sss.FileInfo
+	storage.FileInfo
 }
 
 var _ fs.DirEntry = (*fileInfoWrap)(nil)
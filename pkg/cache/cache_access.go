@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+)
+
+// accessFinalFlushTimeout bounds the flush done when the tracker stops.
+const accessFinalFlushTimeout = 10 * time.Second
+
+// accessTracker batches the last served time of blobs in memory and writes
+// them out periodically to an "accessed" object next to each blob's data.
+type accessTracker struct {
+	mut      sync.Mutex
+	accessed map[string]time.Time
+}
+
+// WithAccessFlushInterval records when blobs are served and writes the
+// access times to storage every interval, for LRU eviction.
+func WithAccessFlushInterval(interval time.Duration) Option {
+	return func(c *Cache) {
+		c.accessFlushInterval = interval
+	}
+}
+
+// StartAccessTracker writes out the recorded access times every flush
+// interval until ctx is done, and a last time after. The returned function
+// stops it and waits for the last flush. It is a no-op unless access
+// tracking is enabled.
+func (c *Cache) StartAccessTracker(ctx context.Context, logger *slog.Logger) (stop func()) {
+	if c.accessTracker == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.accessFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accessFinalFlushTimeout)
+				defer cancel()
+				err := c.FlushBlobAccess(ctx)
+				if err != nil {
+					logger.Warn("failed to flush blob access", "error", err)
+				}
+				return
+			case <-ticker.C:
+				err := c.FlushBlobAccess(ctx)
+				if err != nil {
+					logger.Warn("failed to flush blob access", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// TouchBlob records that blob has been served. It is a no-op unless access
+// tracking is enabled.
+func (c *Cache) TouchBlob(blob string) {
+	if c.accessTracker == nil {
+		return
+	}
+	c.accessTracker.mut.Lock()
+	c.accessTracker.accessed[blob] = time.Now()
+	c.accessTracker.mut.Unlock()
+}
+
+// FlushBlobAccess writes out the access times recorded since the last flush.
+func (c *Cache) FlushBlobAccess(ctx context.Context) error {
+	if c.accessTracker == nil {
+		return nil
+	}
+
+	c.accessTracker.mut.Lock()
+	accessed := c.accessTracker.accessed
+	c.accessTracker.accessed = map[string]time.Time{}
+	c.accessTracker.mut.Unlock()
+
+	var errs []error
+	failed := map[string]time.Time{}
+	for blob, t := range accessed {
+		err := c.PutContent(ctx, blobAccessCachePath(blob), []byte(t.UTC().Format(time.RFC3339)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", blob, err))
+			failed[blob] = t
+		}
+	}
+	if len(errs) != 0 {
+		// Keep the failed ones for the next flush, unless served again since.
+		c.accessTracker.mut.Lock()
+		for blob, t := range failed {
+			if _, ok := c.accessTracker.accessed[blob]; !ok {
+				c.accessTracker.accessed[blob] = t
+			}
+		}
+		c.accessTracker.mut.Unlock()
+		return fmt.Errorf("flush blob access: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// BlobAccessed returns the last flushed access time of blob.
+func (c *Cache) BlobAccessed(ctx context.Context, blob string) (time.Time, error) {
+	info, err := c.Stat(ctx, blobAccessCachePath(blob))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// WalkBlobAccess calls accessCb with the last flushed access time of every
+// blob that has been served since tracking was enabled.
+func (c *Cache) WalkBlobAccess(ctx context.Context, accessCb func(blob string, accessed time.Time) bool) error {
+	err := c.Walk(ctx, blobsCachePath(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "accessed" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !accessCb(blobFromCachePath(p), info.ModTime()) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func blobAccessCachePath(blob string) string {
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/blobs", alg, encoded[:2], encoded, "accessed")
+}
@@ -3,29 +3,37 @@ package cache
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"io/fs"
 	"path"
-	"strings"
+	"time"
 
-	"github.com/wzshiming/sss"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (c *Cache) RedirectBlob(ctx context.Context, blob string, referer string) (string, error) {
 	return c.Redirect(ctx, blobCachePath(blob), referer)
 }
 
-func (c *Cache) StatBlob(ctx context.Context, blob string) (sss.FileInfo, error) {
+func (c *Cache) StatBlob(ctx context.Context, blob string) (storage.FileInfo, error) {
 	return c.Stat(ctx, blobCachePath(blob))
 }
 
 func (c *Cache) PutBlob(ctx context.Context, blob string, r io.Reader) (int64, error) {
+	ctx, span := tracing.Start(ctx, "cache.PutBlob", attribute.String("blob.digest", blob))
 	cachePath := blobCachePath(blob)
-	return c.PutWithHash(ctx, cachePath, r, cleanDigest(blob), 0)
+	n, err := c.PutWithHash(ctx, cachePath, r, blob, 0)
+	span.SetAttributes(attribute.Int64("blob.size", n))
+	tracing.End(span, err)
+	return n, err
 }
 
 func (c *Cache) PutBlobContent(ctx context.Context, blob string, content []byte) (int64, error) {
 	cachePath := blobCachePath(blob)
-	return c.PutWithHash(ctx, cachePath, bytes.NewBuffer(content), cleanDigest(blob), int64(len(content)))
+	return c.PutWithHash(ctx, cachePath, bytes.NewBuffer(content), blob, int64(len(content)))
 }
 
 func (c *Cache) GetBlob(ctx context.Context, blob string) (io.ReadCloser, error) {
@@ -40,7 +48,12 @@ func (c *Cache) GetBlobWithOffset(ctx context.Context, blob string, offset int64
 
 func (c *Cache) DeleteBlob(ctx context.Context, blob string) error {
 	cachePath := blobCachePath(blob)
-	return c.Delete(ctx, cachePath)
+	err := c.Delete(ctx, cachePath)
+	if err != nil {
+		return err
+	}
+	_ = c.Delete(ctx, blobAccessCachePath(blob))
+	return nil
 }
 
 func (c *Cache) GetBlobContent(ctx context.Context, blob string) ([]byte, error) {
@@ -52,18 +65,54 @@ func (c *Cache) GetBlobContent(ctx context.Context, blob string) ([]byte, error)
 	return io.ReadAll(r)
 }
 
-func cleanDigest(blob string) string {
-	return strings.TrimPrefix(blob, "sha256:")
+// WalkBlobs calls blobCb with the digest and stat of every blob in the cache,
+// stopping early when blobCb returns false.
+func (c *Cache) WalkBlobs(ctx context.Context, blobCb func(blob string, info fs.FileInfo) bool) error {
+	err := c.Walk(ctx, blobsCachePath(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "data" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !blobCb(blobFromCachePath(p), info) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
-func ensureDigestPrefix(blob string) string {
-	if !strings.HasPrefix(blob, "sha256:") {
-		return "sha256:" + blob
+// QuarantineBlob deletes a blob found not matching its digest, leaving a
+// record of when and why under the quarantine directory.
+func (c *Cache) QuarantineBlob(ctx context.Context, blob string, reason string) error {
+	record := fmt.Sprintf("%s %s\n", time.Now().UTC().Format(time.RFC3339), reason)
+	err := c.PutContent(ctx, blobQuarantineCachePath(blob), []byte(record))
+	if err != nil {
+		return fmt.Errorf("record quarantine: %w", err)
 	}
-	return blob
+	return c.DeleteBlob(ctx, blob)
+}
+
+func blobsCachePath() string {
+	return "/docker/registry/v2/blobs"
 }
 
 func blobCachePath(blob string) string {
-	blob = cleanDigest(blob)
-	return path.Join("/docker/registry/v2/blobs/sha256", blob[:2], blob, "data")
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/blobs", alg, encoded[:2], encoded, "data")
+}
+
+func blobQuarantineCachePath(blob string) string {
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/quarantine", alg, encoded[:2], encoded, "reason")
 }
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// manifestLayers returns the digests of the blobs, not child manifests, a
+// manifest or a legacy schema 1 manifest references.
+func manifestLayers(content []byte) []string {
+	type descriptor struct {
+		Digest string `json:"digest"`
+	}
+	var m struct {
+		Config   *descriptor  `json:"config"`
+		Layers   []descriptor `json:"layers"`
+		Blobs    []descriptor `json:"blobs"`
+		FSLayers []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"`
+	}
+	err := json.Unmarshal(content, &m)
+	if err != nil {
+		return nil
+	}
+
+	var layers []string
+	add := func(blob string) {
+		if isDigest(blob) {
+			layers = append(layers, blob)
+		}
+	}
+	if m.Config != nil {
+		add(m.Config.Digest)
+	}
+	for _, d := range m.Layers {
+		add(d.Digest)
+	}
+	for _, d := range m.Blobs {
+		add(d.Digest)
+	}
+	for _, l := range m.FSLayers {
+		add(l.BlobSum)
+	}
+	return layers
+}
+
+// linkLayers records that the repository references the blobs of a manifest,
+// like the _layers links of distribution.
+func (c *Cache) linkLayers(ctx context.Context, host, image string, content []byte) error {
+	for _, blob := range manifestLayers(content) {
+		layerLinkPath := layerLinkCachePath(host, image, blob)
+		err := c.PutContent(ctx, layerLinkPath, []byte(ensureDigestPrefix(blob)))
+		if err != nil {
+			return fmt.Errorf("put layer link path %s error: %w", layerLinkPath, err)
+		}
+	}
+	return nil
+}
+
+// HasLayer reports whether a manifest of the repository references the blob.
+// Repositories cached before layer links were recorded are checked against
+// their manifest revisions, and linked when they reference it.
+func (c *Cache) HasLayer(ctx context.Context, host, image, blob string) (bool, error) {
+	_, err := c.Stat(ctx, layerLinkCachePath(host, image, blob))
+	if err == nil {
+		return true, nil
+	}
+
+	// The blob of a manifest revision is referenced by the repository too.
+	_, err = c.Stat(ctx, manifestRevisionsCachePath(host, image, blob))
+	if err == nil {
+		return true, nil
+	}
+
+	var revisions []string
+	err = c.Walk(ctx, manifestRevisionsListCachePath(host, image), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+		revisions = append(revisions, path.Base(path.Dir(p))+":"+path.Base(p))
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	blob = ensureDigestPrefix(blob)
+	for _, rev := range revisions {
+		content, err := c.GetBlobContent(ctx, rev)
+		if err != nil {
+			continue
+		}
+		layers := manifestLayers(content)
+		for _, layer := range layers {
+			if layer == blob {
+				err = c.linkLayers(ctx, host, image, content)
+				if err != nil {
+					return false, err
+				}
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// WalkLayers calls layerCb with the "host/image" name of the repository and
+// the digest of every layer link in the cache.
+func (c *Cache) WalkLayers(ctx context.Context, layerCb func(repo, blob string) bool) error {
+	root := repositoriesCachePath()
+	err := c.Walk(ctx, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+
+		i := strings.Index(p, "/_layers/")
+		if i < 0 {
+			return nil
+		}
+
+		repo := strings.TrimPrefix(p[:i], root+"/")
+		alg := path.Base(path.Dir(p))
+		if !layerCb(repo, alg+":"+path.Base(p)) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) DeleteLayerLink(ctx context.Context, host, image, blob string) error {
+	return c.Delete(ctx, layerLinkCachePath(host, image, blob))
+}
+
+func layerLinkCachePath(host, image, blob string) string {
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/repositories", host, image, "_layers", alg, encoded, "link")
+}
+
+func manifestRevisionsListCachePath(host, image string) string {
+	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/revisions")
+}
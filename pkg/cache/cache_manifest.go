@@ -2,16 +2,17 @@ package cache
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/internal/slices"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/opencontainers/go-digest"
 )
 
 func (c *Cache) RelinkManifest(ctx context.Context, host, image, tag string, blob string) error {
@@ -43,20 +44,22 @@ func (c *Cache) PutManifestContent(ctx context.Context, host, image, tagOrBlob s
 		return 0, "", "", fmt.Errorf("invalid content: %w: %s", err, string(content))
 	}
 
-	h := sha256.New()
-	h.Write(content)
-	hash := "sha256:" + hex.EncodeToString(h.Sum(nil)[:])
-
-	isHash := strings.HasPrefix(tagOrBlob, "sha256:")
+	var hash string
+	isHash := isDigest(tagOrBlob)
 	if isHash {
+		d, err := parseDigest(tagOrBlob)
+		if err != nil {
+			return 0, "", "", err
+		}
+		hash = d.Algorithm().FromBytes(content).String()
 		if tagOrBlob != hash {
 			return 0, "", "", fmt.Errorf("expected hash %s is not same to %s", tagOrBlob, hash)
 		}
 	} else {
-		manifestLinkPath := manifestTagCachePath(host, image, tagOrBlob)
-		err := c.PutContent(ctx, manifestLinkPath, []byte(hash))
+		hash = digest.FromBytes(content).String()
+		err := c.linkManifestTag(ctx, host, image, tagOrBlob, hash)
 		if err != nil {
-			return 0, "", "", fmt.Errorf("put manifest link path %s error: %w", manifestLinkPath, err)
+			return 0, "", "", err
 		}
 	}
 
@@ -70,14 +73,24 @@ func (c *Cache) PutManifestContent(ctx context.Context, host, image, tagOrBlob s
 	if err != nil {
 		return 0, "", "", fmt.Errorf("put manifest blob path %s error: %w", hash, err)
 	}
+
+	err = c.linkLayers(ctx, host, image, content)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	err = c.linkReferrer(ctx, host, image, hash, content)
+	if err != nil {
+		return 0, "", "", err
+	}
 	return n, hash, mediaType, nil
 }
 
 func (c *Cache) GetManifestContent(ctx context.Context, host, image, tagOrBlob string) ([]byte, string, string, error) {
 	var manifestLinkPath string
-	isHash := strings.HasPrefix(tagOrBlob, "sha256:")
+	isHash := isDigest(tagOrBlob)
 	if isHash {
-		manifestLinkPath = manifestRevisionsCachePath(host, image, tagOrBlob[7:])
+		manifestLinkPath = manifestRevisionsCachePath(host, image, tagOrBlob)
 	} else {
 		manifestLinkPath = manifestTagCachePath(host, image, tagOrBlob)
 	}
@@ -110,8 +123,10 @@ func (c *Cache) GetManifestContent(ctx context.Context, host, image, tagOrBlob s
 
 func getMediaType(content []byte) (string, error) {
 	mt := struct {
-		MediaType string          `json:"mediaType"`
-		Manifests json.RawMessage `json:"manifests"`
+		SchemaVersion int             `json:"schemaVersion"`
+		MediaType     string          `json:"mediaType"`
+		Manifests     json.RawMessage `json:"manifests"`
+		Signatures    json.RawMessage `json:"signatures"`
 	}{}
 	err := json.Unmarshal(content, &mt)
 	if err != nil {
@@ -120,9 +135,14 @@ func getMediaType(content []byte) (string, error) {
 
 	mediaType := mt.MediaType
 	if mediaType == "" {
-		if len(mt.Manifests) != 0 {
+		switch {
+		case mt.SchemaVersion == 1 && len(mt.Signatures) != 0:
+			mediaType = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+		case mt.SchemaVersion == 1:
+			mediaType = "application/vnd.docker.distribution.manifest.v1+json"
+		case len(mt.Manifests) != 0:
 			mediaType = "application/vnd.oci.image.index.v1+json"
-		} else {
+		default:
 			mediaType = "application/vnd.oci.image.manifest.v1+json"
 		}
 	}
@@ -141,9 +161,9 @@ func (c *Cache) DigestManifest(ctx context.Context, host, image, tag string) (st
 
 func (c *Cache) StatManifest(ctx context.Context, host, image, tagOrBlob string) (bool, error) {
 	var manifestLinkPath string
-	isHash := strings.HasPrefix(tagOrBlob, "sha256:")
+	isHash := isDigest(tagOrBlob)
 	if isHash {
-		manifestLinkPath = manifestRevisionsCachePath(host, image, tagOrBlob[7:])
+		manifestLinkPath = manifestRevisionsCachePath(host, image, tagOrBlob)
 	} else {
 		manifestLinkPath = manifestTagCachePath(host, image, tagOrBlob)
 	}
@@ -161,6 +181,49 @@ func (c *Cache) StatManifest(ctx context.Context, host, image, tagOrBlob string)
 	return stat.Size() != 0, nil
 }
 
+// StatManifestTag returns the stat of the tag link, whose modification time is
+// when the tag last changed upstream.
+func (c *Cache) StatManifestTag(ctx context.Context, host, image, tag string) (storage.FileInfo, error) {
+	return c.Stat(ctx, manifestTagCachePath(host, image, tag))
+}
+
+// ManifestTagChecked returns when the tag was last checked against upstream.
+func (c *Cache) ManifestTagChecked(ctx context.Context, host, image, tag string) (time.Time, error) {
+	stat, err := c.StatManifestTag(ctx, host, image, tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	checked := stat.ModTime()
+
+	stat, err = c.Stat(ctx, manifestTagCheckedCachePath(host, image, tag))
+	if err == nil && stat.ModTime().After(checked) {
+		checked = stat.ModTime()
+	}
+	return checked, nil
+}
+
+// linkManifestTag points the tag to blob. The link is only rewritten when the
+// tag moved, so that its modification time stays when the tag last changed,
+// an unchanged tag only records the time it was checked.
+func (c *Cache) linkManifestTag(ctx context.Context, host, image, tag string, blob string) error {
+	manifestLinkPath := manifestTagCachePath(host, image, tag)
+	digestContent, err := c.GetContent(ctx, manifestLinkPath)
+	if err == nil && string(digestContent) == blob {
+		checkedPath := manifestTagCheckedCachePath(host, image, tag)
+		err = c.PutContent(ctx, checkedPath, []byte(time.Now().UTC().Format(time.RFC3339)))
+		if err != nil {
+			return fmt.Errorf("put manifest checked path %s error: %w", checkedPath, err)
+		}
+		return nil
+	}
+
+	err = c.PutContent(ctx, manifestLinkPath, []byte(blob))
+	if err != nil {
+		return fmt.Errorf("put manifest link path %s error: %w", manifestLinkPath, err)
+	}
+	return nil
+}
+
 func (c *Cache) StatOrRelinkManifest(ctx context.Context, host, image, tag string, blob string) (bool, error) {
 	manifestLinkPath := manifestTagCachePath(host, image, tag)
 
@@ -179,13 +242,14 @@ func (c *Cache) StatOrRelinkManifest(ctx context.Context, host, image, tag strin
 	}
 
 	blob = ensureDigestPrefix(blob)
-	if digest == blob {
-		return true, nil
-	}
 
-	err = c.PutContent(ctx, manifestLinkPath, []byte(blob))
+	err = c.linkManifestTag(ctx, host, image, tag, blob)
 	if err != nil {
-		return false, fmt.Errorf("put manifest link path %s error: %w", manifestLinkPath, err)
+		return false, err
+	}
+
+	if digest == blob {
+		return true, nil
 	}
 
 	manifestBlobLinkPath := manifestRevisionsCachePath(host, image, blob)
@@ -233,15 +297,191 @@ func (c *Cache) ListTags(ctx context.Context, host, image string) ([]string, err
 	return slices.Map(list, path.Base), nil
 }
 
+// WalkRepositories calls repoCb with the "host/image" name of every repository
+// that has manifests in the cache, stopping early when repoCb returns false.
+// Only directories are listed, the files of a repository are never visited.
+func (c *Cache) WalkRepositories(ctx context.Context, repoCb func(repo string) bool) error {
+	root := repositoriesCachePath()
+	err := c.walkRepositories(ctx, root, root, repoCb)
+	if err != nil {
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) walkRepositories(ctx context.Context, root, dir string, repoCb func(repo string) bool) error {
+	var dirs []string
+	isRepo := false
+	err := c.storageDriver.List(ctx, dir, func(fi storage.FileInfo) bool {
+		if !fi.IsDir() {
+			return true
+		}
+		name := path.Base(fi.Path())
+		switch {
+		case name == "_manifests":
+			isRepo = true
+		case !strings.HasPrefix(name, "_"):
+			dirs = append(dirs, fi.Path())
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if isRepo && !repoCb(strings.TrimPrefix(dir, root+"/")) {
+		return fs.SkipAll
+	}
+
+	for _, d := range dirs {
+		err = c.walkRepositories(ctx, root, d, repoCb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkManifestRevisions calls revisionCb with the "host/image" name of the
+// repository and the digest of every manifest revision linked in the cache.
+func (c *Cache) WalkManifestRevisions(ctx context.Context, revisionCb func(repo, blob string) bool) error {
+	root := repositoriesCachePath()
+	err := c.Walk(ctx, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+
+		i := strings.Index(p, "/_manifests/revisions/")
+		if i < 0 {
+			return nil
+		}
+
+		repo := strings.TrimPrefix(p[:i], root+"/")
+		alg := path.Base(path.Dir(p))
+		if !revisionCb(repo, alg+":"+path.Base(p)) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// WalkManifestTags calls tagCb with the "host/image" name of the repository,
+// the tag and the stat of the tag link of every tag in the cache.
+func (c *Cache) WalkManifestTags(ctx context.Context, tagCb func(repo, tag string, info fs.FileInfo) bool) error {
+	root := repositoriesCachePath()
+	err := c.Walk(ctx, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "link" || path.Base(p) != "current" {
+			return nil
+		}
+
+		i := strings.Index(p, "/_manifests/tags/")
+		if i < 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		repo := strings.TrimPrefix(p[:i], root+"/")
+		if !tagCb(repo, path.Base(path.Dir(p)), info) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) DeleteManifestTag(ctx context.Context, host, image, tag string) error {
+	return c.Delete(ctx, path.Join(manifestTagListCachePath(host, image), tag))
+}
+
+// DeleteManifestRevision removes the revision link of the blob, with the link
+// to the manifest converted from it.
+func (c *Cache) DeleteManifestRevision(ctx context.Context, host, image, blob string) error {
+	err := c.Delete(ctx, manifestConversionCachePath(host, image, blob))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return c.Delete(ctx, manifestRevisionsCachePath(host, image, blob))
+}
+
+// LinkManifestConversion records the manifest converted from the blob to the
+// counterpart format, so the conversion is collected along with the blob.
+func (c *Cache) LinkManifestConversion(ctx context.Context, host, image, blob, converted string) error {
+	conversionLinkPath := manifestConversionCachePath(host, image, blob)
+	err := c.PutContent(ctx, conversionLinkPath, []byte(ensureDigestPrefix(converted)))
+	if err != nil {
+		return fmt.Errorf("put manifest conversion path %s error: %w", conversionLinkPath, err)
+	}
+	return nil
+}
+
+// ManifestConversion returns the digest of the manifest converted from the
+// blob.
+func (c *Cache) ManifestConversion(ctx context.Context, host, image, blob string) (string, error) {
+	conversionLinkPath := manifestConversionCachePath(host, image, blob)
+	content, err := c.GetContent(ctx, conversionLinkPath)
+	if err != nil {
+		return "", fmt.Errorf("get manifest conversion path %s error: %w", conversionLinkPath, err)
+	}
+	return string(content), nil
+}
+
+func (c *Cache) ListRepositories(ctx context.Context) ([]string, error) {
+	list := []string{}
+	err := c.WalkRepositories(ctx, func(repo string) bool {
+		list = append(list, repo)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func repositoriesCachePath() string {
+	return "/docker/registry/v2/repositories"
+}
+
 func manifestRevisionsCachePath(host, image, blob string) string {
-	blob = cleanDigest(blob)
-	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/revisions/sha256", blob, "link")
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/revisions", alg, encoded, "link")
+}
+
+func manifestConversionCachePath(host, image, blob string) string {
+	alg, encoded := splitDigest(blob)
+	return path.Join("/docker/registry/v2/repositories", host, image, "_conversions", alg, encoded, "link")
 }
 
 func manifestTagCachePath(host, image, tag string) string {
 	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/tags", tag, "current/link")
 }
 
+func manifestTagCheckedCachePath(host, image, tag string) string {
+	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/tags", tag, "current/checked")
+}
+
 func manifestTagListCachePath(host, image string) string {
 	return path.Join("/docker/registry/v2/repositories", host, image, "_manifests/tags")
 }
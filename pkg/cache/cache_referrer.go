@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/spec"
+	"github.com/opencontainers/go-digest"
+)
+
+type referrerManifest struct {
+	ArtifactType string `json:"artifactType"`
+	Config       *struct {
+		MediaType string `json:"mediaType"`
+	} `json:"config"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// manifestSubject returns the digest of the manifest a manifest refers to,
+// like the image of a signature or an SBOM.
+func manifestSubject(content []byte) string {
+	var m referrerManifest
+	err := json.Unmarshal(content, &m)
+	if err != nil || m.Subject == nil {
+		return ""
+	}
+	d, err := digest.Parse(m.Subject.Digest)
+	if err != nil {
+		return ""
+	}
+	return d.String()
+}
+
+// linkReferrer records the manifest as a referrer of its subject.
+func (c *Cache) linkReferrer(ctx context.Context, host, image, blob string, content []byte) error {
+	subject := manifestSubject(content)
+	if subject == "" {
+		return nil
+	}
+	referrerLinkPath := referrerLinkCachePath(host, image, subject, blob)
+	err := c.PutContent(ctx, referrerLinkPath, []byte(blob))
+	if err != nil {
+		return fmt.Errorf("put referrer link path %s error: %w", referrerLinkPath, err)
+	}
+	return nil
+}
+
+// Referrers returns the descriptors of the cached manifests of the repository
+// whose subject is the blob.
+func (c *Cache) Referrers(ctx context.Context, host, image, blob string) ([]spec.Descriptor, error) {
+	blob = ensureDigestPrefix(blob)
+
+	var referrers []string
+	err := c.Walk(ctx, referrerListCachePath(host, image, blob), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+		referrers = append(referrers, path.Base(path.Dir(p))+":"+path.Base(p))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := []spec.Descriptor{}
+	for _, referrer := range referrers {
+		content, err := c.GetBlobContent(ctx, referrer)
+		if err != nil {
+			// The manifest was collected, the link is stale.
+			continue
+		}
+		if manifestSubject(content) != blob {
+			continue
+		}
+		mediaType, err := getMediaType(content)
+		if err != nil {
+			continue
+		}
+
+		var m referrerManifest
+		_ = json.Unmarshal(content, &m)
+		artifactType := m.ArtifactType
+		if artifactType == "" && m.Config != nil {
+			artifactType = m.Config.MediaType
+		}
+		descriptors = append(descriptors, spec.Descriptor{
+			MediaType:    mediaType,
+			Digest:       referrer,
+			Size:         int64(len(content)),
+			ArtifactType: artifactType,
+			Annotations:  m.Annotations,
+		})
+	}
+	return descriptors, nil
+}
+
+func referrerLinkCachePath(host, image, subject, blob string) string {
+	alg, encoded := splitDigest(blob)
+	return path.Join(referrerListCachePath(host, image, subject), alg, encoded, "link")
+}
+
+func referrerListCachePath(host, image, subject string) string {
+	alg, encoded := splitDigest(subject)
+	return path.Join("/docker/registry/v2/repositories", host, image, "_referrers", alg, encoded)
+}
@@ -0,0 +1,320 @@
+package cache
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/spec"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/filesystem"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestCacheWithMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.CanRedirect() {
+		t.Errorf("CanRedirect() = true, want false for memory storage")
+	}
+
+	content := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	_, digest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, gotDigest, _, err := c.GetManifestContent(ctx, "docker.io", "library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) || gotDigest != digest {
+		t.Errorf("GetManifestContent() = %s, %s, want %s, %s", got, gotDigest, content, digest)
+	}
+
+	var blobs []string
+	err = c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		blobs = append(blobs, blob)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || blobs[0] != digest {
+		t.Errorf("WalkBlobs() = %v, want [%s]", blobs, digest)
+	}
+
+	tags, err := c.ListTags(ctx, "docker.io", "library/busybox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Errorf("ListTags() = %v, want [latest]", tags)
+	}
+}
+
+func TestCacheSHA512Blob(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("sha512 content")
+	blob := digest.SHA512.FromBytes(content).String()
+
+	_, err = c.PutBlobContent(ctx, blob, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.PutBlobContent(ctx, digest.SHA512.FromString("other").String(), content)
+	if err == nil {
+		t.Errorf("PutBlobContent() with a mismatched sha512 digest succeeded")
+	}
+
+	got, err := c.GetBlobContent(ctx, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("GetBlobContent() = %s, want %s", got, content)
+	}
+
+	var blobs []string
+	err = c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		blobs = append(blobs, blob)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 || blobs[0] != blob {
+		t.Errorf("WalkBlobs() = %v, want [%s]", blobs, blob)
+	}
+}
+
+func TestCachePutMismatchCancelsWriter(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	driver, err := filesystem.NewFileSystem(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCache(WithStorageDriver(driver))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.PutBlobContent(ctx, digest.FromString("other").String(), []byte("content"))
+	if err == nil {
+		t.Fatal("PutBlobContent() with a mismatched digest succeeded")
+	}
+
+	staged, err := os.ReadDir(filepath.Join(root, "_uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("staged files left behind: %v", staged)
+	}
+}
+
+func TestCacheHasLayer(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := digest.FromString("layer").String()
+	content := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layer + `"}]}`)
+	_, manifest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image string
+		blob  string
+		want  bool
+	}{
+		{image: "library/busybox", blob: layer, want: true},
+		{image: "library/busybox", blob: manifest, want: true},
+		{image: "library/busybox", blob: digest.FromString("other").String(), want: false},
+		{image: "library/alpine", blob: layer, want: false},
+	}
+	for _, tt := range tests {
+		got, err := c.HasLayer(ctx, "docker.io", tt.image, tt.blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("HasLayer(%s, %s) = %v, want %v", tt.image, tt.blob, got, tt.want)
+		}
+	}
+
+	// Repositories cached without layer links are linked on demand.
+	err = c.DeleteLayerLink(ctx, "docker.io", "library/busybox", layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.HasLayer(ctx, "docker.io", "library/busybox", layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got {
+		t.Errorf("HasLayer() = false after the layer link was removed, want true")
+	}
+	if _, err := c.Stat(ctx, layerLinkCachePath("docker.io", "library/busybox", layer)); err != nil {
+		t.Errorf("layer link not restored: %v", err)
+	}
+}
+
+func TestCacheReferrers(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + digest.FromString("layer").String() + `"}]}`)
+	_, subject, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbom := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/spdx+json","config":{"mediaType":"application/vnd.oci.empty.v1+json"},"layers":[{"digest":"` + digest.FromString("sbom").String() + `"}],"subject":{"digest":"` + subject + `"},"annotations":{"org.example":"sbom"}}`)
+	sbomDigest := digest.FromBytes(sbom).String()
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", sbomDigest, sbom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.dev.cosign.artifact.sig.v1+json"},"layers":[{"digest":"` + digest.FromString("sig").String() + `"}],"subject":{"digest":"` + subject + `"}}`)
+	signatureDigest := digest.FromBytes(signature).String()
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", signatureDigest, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Referrers(ctx, "docker.io", "library/busybox", subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]spec.Descriptor{
+		sbomDigest: {
+			MediaType:    "application/vnd.oci.image.manifest.v1+json",
+			Digest:       sbomDigest,
+			Size:         int64(len(sbom)),
+			ArtifactType: "application/spdx+json",
+			Annotations:  map[string]string{"org.example": "sbom"},
+		},
+		signatureDigest: {
+			MediaType:    "application/vnd.oci.image.manifest.v1+json",
+			Digest:       signatureDigest,
+			Size:         int64(len(signature)),
+			ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json",
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Referrers() = %v, want %v", got, want)
+	}
+	for _, d := range got {
+		if !reflect.DeepEqual(d, want[d.Digest]) {
+			t.Errorf("Referrers() got %v, want %v", d, want[d.Digest])
+		}
+	}
+
+	got, err = c.Referrers(ctx, "docker.io", "library/alpine", subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Referrers() of another repository = %v, want none", got)
+	}
+}
+
+func TestCacheManifestTagChecked(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	_, blob, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := c.StatManifestTag(ctx, "docker.io", "library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// An unchanged tag keeps its link and only records the check.
+	ok, err := c.StatOrRelinkManifest(ctx, "docker.io", "library/busybox", "latest", blob)
+	if err != nil || !ok {
+		t.Fatalf("StatOrRelinkManifest() = %v, %v", ok, err)
+	}
+	stat, err := c.StatManifestTag(ctx, "docker.io", "library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.ModTime().Equal(linked.ModTime()) {
+		t.Errorf("tag link rewritten at %v, want it kept from %v", stat.ModTime(), linked.ModTime())
+	}
+	checked, err := c.ManifestTagChecked(ctx, "docker.io", "library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checked.After(linked.ModTime()) {
+		t.Errorf("ManifestTagChecked() = %v, want after %v", checked, linked.ModTime())
+	}
+
+	err = c.DeleteManifestTag(ctx, "docker.io", "library/busybox", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := c.ListTags(ctx, "docker.io", "library/busybox")
+	if err == nil && len(tags) != 0 {
+		t.Errorf("ListTags() = %v after delete, want none", tags)
+	}
+}
+
+func TestCacheAccessTrackerFlushesOnStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := NewCache(WithStorageDriver(memory.NewMemory()), WithAccessFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := c.StartAccessTracker(ctx, slog.Default())
+
+	blob := digest.FromString("served").String()
+	c.TouchBlob(blob)
+	cancel()
+	stop()
+
+	var got []string
+	err = c.WalkBlobAccess(context.Background(), func(blob string, accessed time.Time) bool {
+		got = append(got, blob)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{blob}) {
+		t.Errorf("WalkBlobAccess() = %v, want the access recorded before stop", got)
+	}
+}
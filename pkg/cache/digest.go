@@ -0,0 +1,46 @@
+package cache
+
+import (
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// splitDigest returns the algorithm and encoded part of a digest, a digest
+// without an algorithm is sha256.
+func splitDigest(blob string) (string, string) {
+	alg, encoded, ok := strings.Cut(blob, ":")
+	if !ok {
+		return string(digest.SHA256), blob
+	}
+	return alg, encoded
+}
+
+func cleanDigest(blob string) string {
+	_, encoded := splitDigest(blob)
+	return encoded
+}
+
+func ensureDigestPrefix(blob string) string {
+	alg, encoded := splitDigest(blob)
+	return alg + ":" + encoded
+}
+
+func parseDigest(blob string) (digest.Digest, error) {
+	return digest.Parse(ensureDigestPrefix(blob))
+}
+
+// isDigest reports whether a manifest reference is a digest rather than a
+// tag, tags can not contain a colon.
+func isDigest(tagOrBlob string) bool {
+	return strings.Contains(tagOrBlob, ":")
+}
+
+// blobFromCachePath returns the digest of the blob stored in the directory
+// p, like .../blobs/sha256/xx/<encoded>.
+func blobFromCachePath(p string) string {
+	return path.Base(path.Dir(path.Dir(p))) + ":" + path.Base(p)
+}
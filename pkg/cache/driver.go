@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/filesystem"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/s3"
+)
+
+// ErrRedirectNotSupported is returned by Redirect when the storage can not
+// hand out links, the content has to be served directly.
+var ErrRedirectNotSupported = errors.New("storage driver does not support redirect")
+
+// WithStorageURL opens the storage from a url, file:///path for a local
+// directory or sss://... for S3 compatible storage.
+func WithStorageURL(rawURL string) Option {
+	return func(c *Cache) {
+		c.storageURL = rawURL
+	}
+}
+
+// NewStorageDriver opens the storage driver for a url as accepted by WithStorageURL.
+func NewStorageDriver(rawURL string) (storage.Driver, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return filesystem.NewFileSystem(u.Path)
+	default:
+		return s3.NewDriverFromURL(rawURL)
+	}
+}
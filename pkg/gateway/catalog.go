@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/utils"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+type catalogResponse struct {
+	Repositories []string `json:"repositories"`
+}
+
+type tagsListResponse struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+func (c *Gateway) catalog(rw http.ResponseWriter, r *http.Request, t *token.Token) {
+	repos, err := c.cache.ListRepositories(r.Context())
+	if err != nil {
+		c.logger.Warn("failed to list repositories", "error", err)
+		utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+		return
+	}
+
+	// Tokens pinned to a host or an image only see their repositories.
+	if t.Attribute.Host != "" || t.Attribute.Image != "" {
+		filtered := repos[:0]
+		for _, repo := range repos {
+			host, image, _ := strings.Cut(repo, "/")
+			if t.Attribute.Host != "" && host != t.Attribute.Host {
+				continue
+			}
+			if t.Attribute.Image != "" && image != t.Attribute.Image {
+				continue
+			}
+			filtered = append(filtered, repo)
+		}
+		repos = filtered
+	}
+
+	page, next, ok := paginate(repos, r.URL.Query())
+	if !ok {
+		utils.ServeError(rw, r, v2.ErrorCodePaginationNumberInvalid, 0)
+		return
+	}
+
+	if next != "" {
+		rw.Header().Set("Link", paginationLink(catalog, next, len(page)))
+	}
+
+	serveJSON(rw, r, catalogResponse{
+		Repositories: page,
+	})
+}
+
+func (c *Gateway) tagsList(rw http.ResponseWriter, r *http.Request, info *PathInfo) {
+	tags, err := c.cache.ListTags(r.Context(), info.Host, info.Image)
+	if (err == nil && len(tags) == 0) || errors.Is(err, fs.ErrNotExist) {
+		utils.ServeError(rw, r, v2.ErrorCodeNameUnknown, 0)
+		return
+	}
+	if err != nil {
+		c.logger.Warn("failed to list tags", "host", info.Host, "image", info.Image, "error", err)
+		utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+		return
+	}
+
+	page, next, ok := paginate(tags, r.URL.Query())
+	if !ok {
+		utils.ServeError(rw, r, v2.ErrorCodePaginationNumberInvalid, 0)
+		return
+	}
+
+	name := info.Host + "/" + info.Image
+	if next != "" {
+		rw.Header().Set("Link", paginationLink(prefix+name+"/tags/list", next, len(page)))
+	}
+
+	serveJSON(rw, r, tagsListResponse{
+		Name: name,
+		Tags: page,
+	})
+}
+
+// paginate sorts list and returns the entries after the "last" query
+// parameter, at most "n" of them, and the last entry returned when more remain.
+func paginate(list []string, query url.Values) ([]string, string, bool) {
+	sort.Strings(list)
+
+	if last := query.Get("last"); last != "" {
+		i := sort.SearchStrings(list, last)
+		if i < len(list) && list[i] == last {
+			i++
+		}
+		list = list[i:]
+	}
+
+	n := len(list)
+	if s := query.Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return nil, "", false
+		}
+		n = v
+	}
+
+	if n >= len(list) {
+		return list, "", true
+	}
+
+	list = list[:n]
+	if n == 0 {
+		return list, "", true
+	}
+	return list, list[n-1], true
+}
+
+func paginationLink(path string, last string, n int) string {
+	query := url.Values{
+		"last": {last},
+		"n":    {strconv.Itoa(n)},
+	}
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", path, query.Encode())
+}
+
+func serveJSON(rw http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != http.MethodHead {
+		rw.Write(body)
+	}
+}
@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+)
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     []string
+		query    url.Values
+		want     []string
+		wantNext string
+		wantOk   bool
+	}{
+		{
+			name:   "all",
+			list:   []string{"c", "a", "b"},
+			query:  url.Values{},
+			want:   []string{"a", "b", "c"},
+			wantOk: true,
+		},
+		{
+			name:     "first page",
+			list:     []string{"c", "a", "b"},
+			query:    url.Values{"n": {"2"}},
+			want:     []string{"a", "b"},
+			wantNext: "b",
+			wantOk:   true,
+		},
+		{
+			name:   "last page",
+			list:   []string{"c", "a", "b"},
+			query:  url.Values{"n": {"2"}, "last": {"b"}},
+			want:   []string{"c"},
+			wantOk: true,
+		},
+		{
+			name:   "last not in list",
+			list:   []string{"a", "c"},
+			query:  url.Values{"last": {"b"}},
+			want:   []string{"c"},
+			wantOk: true,
+		},
+		{
+			name:   "invalid n",
+			list:   []string{"a"},
+			query:  url.Values{"n": {"x"}},
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotNext, gotOk := paginate(tt.list, tt.query)
+			if gotOk != tt.wantOk {
+				t.Fatalf("paginate() gotOk = %v, want %v", gotOk, tt.wantOk)
+			}
+			if !tt.wantOk {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paginate() got = %v, want %v", got, tt.want)
+			}
+			if gotNext != tt.wantNext {
+				t.Errorf("paginate() gotNext = %v, want %v", gotNext, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestCatalogHandlers(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	for _, ref := range []struct{ image, tag string }{
+		{"org/app", "v1"},
+		{"org/app", "latest"},
+		{"library/busybox", "latest"},
+	} {
+		_, _, _, err = c.PutManifestContent(ctx, "registry.test", ref.image, ref.tag, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gw, err := NewGateway(
+		WithCache(c),
+		WithCachedCatalog(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string
+		wantLink bool
+	}{
+		{
+			name:     "catalog",
+			path:     "/v2/_catalog",
+			wantCode: http.StatusOK,
+			want:     `{"repositories":["registry.test/library/busybox","registry.test/org/app"]}`,
+		},
+		{
+			name:     "catalog page",
+			path:     "/v2/_catalog?n=1",
+			wantCode: http.StatusOK,
+			want:     `{"repositories":["registry.test/library/busybox"]}`,
+			wantLink: true,
+		},
+		{
+			name:     "tags list",
+			path:     "/v2/registry.test/org/app/tags/list",
+			wantCode: http.StatusOK,
+			want:     `{"name":"registry.test/org/app","tags":["latest","v1"]}`,
+		},
+		{
+			name:     "tags list of an uncached repository",
+			path:     "/v2/registry.test/org/missing/tags/list",
+			wantCode: http.StatusNotFound,
+			want:     "NAME_UNKNOWN",
+		},
+		{
+			name:     "invalid page size",
+			path:     "/v2/registry.test/org/app/tags/list?n=x",
+			wantCode: http.StatusBadRequest,
+			want:     "PAGINATION_NUMBER_INVALID",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			gw.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rw.Code != tt.wantCode {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, rw.Code, rw.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				if !strings.Contains(rw.Body.String(), tt.want) {
+					t.Errorf("GET %s body = %s, want %s", tt.path, rw.Body.String(), tt.want)
+				}
+				return
+			}
+			if !json.Valid(rw.Body.Bytes()) || rw.Body.String() != tt.want {
+				t.Errorf("GET %s body = %s, want %s", tt.path, rw.Body.String(), tt.want)
+			}
+			if gotLink := rw.Header().Get("Link") != ""; gotLink != tt.wantLink {
+				t.Errorf("GET %s Link = %q", tt.path, rw.Header().Get("Link"))
+			}
+		})
+	}
+}
+
+func TestCatalogScopedToken(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	for _, repo := range []struct{ host, image string }{
+		{"registry.test", "org/app"},
+		{"registry.test", "library/busybox"},
+		{"other.test", "org/app"},
+	} {
+		_, _, _, err = c.PutManifestContent(ctx, repo.host, repo.image, "latest", manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gw, err := NewGateway(
+		WithCache(c),
+		WithCachedCatalog(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		attribute token.Attribute
+		want      string
+	}{
+		{
+			name: "unrestricted",
+			want: `{"repositories":["other.test/org/app","registry.test/library/busybox","registry.test/org/app"]}`,
+		},
+		{
+			name:      "host",
+			attribute: token.Attribute{Host: "registry.test"},
+			want:      `{"repositories":["registry.test/library/busybox","registry.test/org/app"]}`,
+		},
+		{
+			name:      "host and image",
+			attribute: token.Attribute{Host: "registry.test", Image: "org/app"},
+			want:      `{"repositories":["registry.test/org/app"]}`,
+		},
+		{
+			name:      "image",
+			attribute: token.Attribute{Image: "org/app"},
+			want:      `{"repositories":["other.test/org/app","registry.test/org/app"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			gw.catalog(rw, httptest.NewRequest(http.MethodGet, "/v2/_catalog", nil), &token.Token{Attribute: tt.attribute})
+			if rw.Code != http.StatusOK || rw.Body.String() != tt.want {
+				t.Errorf("catalog = %d %s, want %s", rw.Code, rw.Body.String(), tt.want)
+			}
+		})
+	}
+}
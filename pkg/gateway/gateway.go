@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/throttled"
 	"github.com/OpenCIDN/OpenCIDN/internal/utils"
 	"github.com/OpenCIDN/OpenCIDN/pkg/blobs"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
 	"github.com/OpenCIDN/OpenCIDN/pkg/manifests"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
 	"github.com/docker/distribution/registry/api/errcode"
@@ -32,6 +34,7 @@ type Gateway struct {
 	modify          func(info *ImageInfo) *ImageInfo
 	logger          *slog.Logger
 	disableTagsList bool
+	cachedCatalog   bool
 
 	authenticator *token.Authenticator
 
@@ -40,6 +43,7 @@ type Gateway struct {
 
 	blobs     *blobs.Blobs
 	manifests *manifests.Manifests
+	cache     *cache.Cache
 }
 
 type Option func(c *Gateway)
@@ -56,6 +60,14 @@ func WithDisableTagsList(b bool) Option {
 	}
 }
 
+// WithCachedCatalog serves the catalog and tags list from what is already
+// in the cache instead of asking the upstream registry.
+func WithCachedCatalog(b bool) Option {
+	return func(c *Gateway) {
+		c.cachedCatalog = b
+	}
+}
+
 func WithLogger(logger *slog.Logger) Option {
 	return func(c *Gateway) {
 		c.logger = logger
@@ -98,6 +110,12 @@ func WithManifests(a *manifests.Manifests) Option {
 	}
 }
 
+func WithCache(a *cache.Cache) Option {
+	return func(c *Gateway) {
+		c.cache = a
+	}
+}
+
 func NewGateway(opts ...Option) (*Gateway, error) {
 	c := &Gateway{
 		logger:     slog.Default(),
@@ -108,6 +126,10 @@ func NewGateway(opts ...Option) (*Gateway, error) {
 		opt(c)
 	}
 
+	if c.cachedCatalog && c.cache == nil {
+		return nil, fmt.Errorf("cached catalog requires a cache")
+	}
+
 	return c, nil
 }
 
@@ -123,7 +145,7 @@ func (c *Gateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if oriPath == catalog {
+	if oriPath == catalog && !c.cachedCatalog {
 		utils.ServeError(rw, r, errcode.ErrorCodeUnsupported, 0)
 		return
 	}
@@ -163,6 +185,11 @@ func (c *Gateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if oriPath == catalog {
+		c.catalog(rw, r, &t)
+		return
+	}
+
 	info, ok := parseOriginPathInfo(oriPath)
 	if !ok {
 		utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
@@ -214,6 +241,11 @@ func (c *Gateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c.cachedCatalog && info.TagsList {
+		c.tagsList(rw, r, info)
+		return
+	}
+
 	if info.Blobs != "" {
 		c.blob(rw, r, info, &t, authData)
 		return
@@ -223,6 +255,11 @@ func (c *Gateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		c.manifest(rw, r, info, &t)
 		return
 	}
+
+	if info.Referrers != "" {
+		c.referrers(rw, r, info, &t)
+		return
+	}
 	c.forward(rw, r, info, &t)
 }
 
@@ -267,6 +304,8 @@ func (c *Gateway) forward(rw http.ResponseWriter, r *http.Request, info *PathInf
 	}
 
 	resp.Header.Del("Docker-Ratelimit-Source")
+	resp.Header.Del("Ratelimit-Limit")
+	resp.Header.Del("Ratelimit-Remaining")
 
 	if resp.StatusCode == http.StatusOK {
 		oldLink := resp.Header.Get("Link")
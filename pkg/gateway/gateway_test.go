@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/registrytest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/blobs"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/manifests"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+)
+
+func TestGatewayPull(t *testing.T) {
+	registry := registrytest.NewRegistry(t)
+	config := []byte(`{}`)
+	layer := []byte("layer")
+	configDigest := registry.PutBlob(config)
+	layerDigest := registry.PutBlob(layer)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + configDigest + `","size":2},"layers":[{"digest":"` + layerDigest + `","size":5}]}`)
+	manifestDigest := registry.PutManifest("library/busybox", "latest", manifest)
+
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifests.NewManifests(manifests.WithCache(c), manifests.WithClient(registry.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := blobs.NewBlobs(blobs.WithCache(c), blobs.WithClient(registry.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw, err := NewGateway(
+		WithClient(registry.Client()),
+		WithDefaultRegistry(registry.Host()),
+		WithManifests(m),
+		WithBlobs(b),
+		WithCache(c),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		want       []byte
+		wantDigest string
+	}{
+		{path: "/v2/library/busybox/manifests/latest", want: manifest, wantDigest: manifestDigest},
+		{path: "/v2/library/busybox/manifests/" + manifestDigest, want: manifest, wantDigest: manifestDigest},
+		{path: "/v2/library/busybox/blobs/" + configDigest, want: config},
+		{path: "/v2/library/busybox/blobs/" + layerDigest, want: layer},
+	}
+	// The second round is served from the cache.
+	for round := 0; round < 2; round++ {
+		requests := registry.Requests()
+		for _, tt := range tests {
+			resp, err := srv.Client().Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET %s = %d %s", tt.path, resp.StatusCode, body)
+			}
+			if string(body) != string(tt.want) {
+				t.Errorf("GET %s = %s, want %s", tt.path, body, tt.want)
+			}
+			if got := resp.Header.Get("Docker-Content-Digest"); tt.wantDigest != "" && got != tt.wantDigest {
+				t.Errorf("GET %s digest = %s, want %s", tt.path, got, tt.wantDigest)
+			}
+		}
+		if round == 1 && registry.Requests() != requests {
+			t.Errorf("upstream requests = %d while cached, want %d", registry.Requests(), requests)
+		}
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/v2/library/busybox/manifests/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("GET missing manifest = %d, want an error", resp.StatusCode)
+	}
+}
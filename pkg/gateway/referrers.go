@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/spec"
+	"github.com/OpenCIDN/OpenCIDN/internal/utils"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+var errOffline = errors.New("offline")
+
+// referrers serves the referrers of a manifest from the upstream, falling
+// back to the referrers tag schema for registries without the API, and to
+// the cached referrers when the upstream is unavailable or the token is
+// offline.
+func (c *Gateway) referrers(rw http.ResponseWriter, r *http.Request, info *PathInfo, t *token.Token) {
+	artifactType := r.URL.Query().Get("artifactType")
+
+	var descriptors []spec.Descriptor
+	var filtered bool
+	err := errOffline
+	if !t.Offline {
+		descriptors, filtered, err = spec.Referrers(r.Context(), c.httpClient, info.Host, info.Image, info.Referrers, artifactType)
+	}
+	if err != nil {
+		if errors.Is(err, spec.ErrDenied) || c.cache == nil {
+			c.logger.Warn("failed to get referrers", "host", info.Host, "image", info.Image, "digest", info.Referrers, "error", err)
+			if errors.Is(err, spec.ErrDenied) {
+				utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
+			} else {
+				utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+			}
+			return
+		}
+
+		c.logger.Warn("serve cached referrers", "host", info.Host, "image", info.Image, "digest", info.Referrers, "error", err)
+		descriptors, err = c.cache.Referrers(r.Context(), info.Host, info.Image, info.Referrers)
+		if err != nil {
+			c.logger.Warn("failed to get cached referrers", "host", info.Host, "image", info.Image, "digest", info.Referrers, "error", err)
+			utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+			return
+		}
+		filtered = false
+	}
+
+	if artifactType != "" && !filtered {
+		descriptors = spec.FilterArtifactType(descriptors, artifactType)
+	}
+
+	body, err := json.Marshal(spec.NewIndex(descriptors))
+	if err != nil {
+		utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
+		return
+	}
+
+	header := rw.Header()
+	header.Set("Content-Type", spec.MediaTypeImageIndex)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if artifactType != "" {
+		header.Set("OCI-Filters-Applied", "artifactType")
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		rw.Write(body)
+	}
+}
@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/spec"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReferrers(t *testing.T) {
+	subject := digest.FromString("image").String()
+	signature := spec.Descriptor{
+		MediaType:    "application/vnd.oci.image.manifest.v1+json",
+		Digest:       digest.FromString("signature").String(),
+		Size:         1,
+		ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json",
+	}
+	sbom := spec.Descriptor{
+		MediaType:    "application/vnd.oci.image.manifest.v1+json",
+		Digest:       digest.FromString("sbom").String(),
+		Size:         1,
+		ArtifactType: "application/spdx+json",
+	}
+
+	// The upstream has no referrers API, only the referrers tag schema.
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/org/app/manifests/"+strings.Replace(subject, ":", "-", 1) {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", spec.MediaTypeImageIndex)
+		json.NewEncoder(rw).Encode(spec.NewIndex([]spec.Descriptor{signature, sbom}))
+	}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "https://")
+
+	gw, err := NewGateway(
+		WithClient(upstream.Client()),
+		WithPathInfoModifyFunc(func(info *ImageInfo) *ImageInfo {
+			info.Host = host
+			return info
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []spec.Descriptor
+	}{
+		{
+			name: "tag schema",
+			path: "/v2/registry.test/org/app/referrers/" + subject,
+			want: []spec.Descriptor{signature, sbom},
+		},
+		{
+			name: "artifact type",
+			path: "/v2/registry.test/org/app/referrers/" + subject + "?artifactType=application/spdx%2Bjson",
+			want: []spec.Descriptor{sbom},
+		},
+		{
+			name: "none",
+			path: "/v2/registry.test/org/app/referrers/" + digest.FromString("other").String(),
+			want: []spec.Descriptor{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serveReferrers(t, gw, tt.path)
+			if len(got.Manifests) != len(tt.want) {
+				t.Fatalf("referrers = %v, want %v", got.Manifests, tt.want)
+			}
+			for i := range tt.want {
+				if got.Manifests[i].Digest != tt.want[i].Digest {
+					t.Errorf("referrers = %v, want %v", got.Manifests, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReferrersCached(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream is unavailable.
+	var requests atomic.Int64
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "https://")
+
+	subject := digest.FromString("image").String()
+	signature := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.dev.cosign.artifact.sig.v1+json"},"layers":[],"subject":{"digest":"` + subject + `"}}`)
+	_, signatureDigest, _, err := c.PutManifestContent(ctx, host, "org/app", digest.FromBytes(signature).String(), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw, err := NewGateway(
+		WithClient(upstream.Client()),
+		WithCache(c),
+		WithPathInfoModifyFunc(func(info *ImageInfo) *ImageInfo {
+			info.Host = host
+			return info
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := serveReferrers(t, gw, "/v2/registry.test/org/app/referrers/"+subject)
+	if len(got.Manifests) != 1 || got.Manifests[0].Digest != signatureDigest {
+		t.Errorf("cached referrers = %v, want %s", got.Manifests, signatureDigest)
+	}
+
+	// An offline token never reaches the upstream.
+	requests.Store(0)
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v2/registry.test/org/app/referrers/"+subject, nil)
+	gw.referrers(rw, r, &PathInfo{Host: host, Image: "org/app", Referrers: subject}, &token.Token{Attribute: token.Attribute{Offline: true}})
+	if rw.Code != http.StatusOK {
+		t.Fatalf("offline referrers = %d %s", rw.Code, rw.Body.String())
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("upstream requests = %d while offline, want 0", n)
+	}
+}
+
+func serveReferrers(t *testing.T, gw *Gateway, path string) spec.Index {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	gw.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", path, rw.Code, rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != spec.MediaTypeImageIndex {
+		t.Errorf("Content-Type = %q, want %q", ct, spec.MediaTypeImageIndex)
+	}
+
+	var index spec.Index
+	err := json.Unmarshal(rw.Body.Bytes(), &index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/OpenCIDN/OpenCIDN/internal/format"
+	"github.com/opencontainers/go-digest"
 )
 
 func addPrefixToImageForPagination(oldLink string, host string) string {
@@ -30,6 +31,7 @@ type PathInfo struct {
 	Manifests         string
 	IsDigestManifests bool
 	Blobs             string
+	Referrers         string
 }
 
 func (p PathInfo) Path() (string, error) {
@@ -42,6 +44,9 @@ func (p PathInfo) Path() (string, error) {
 	if p.Blobs != "" {
 		return prefix + p.Image + "/blobs/" + p.Blobs, nil
 	}
+	if p.Referrers != "" {
+		return prefix + p.Image + "/referrers/" + p.Referrers, nil
+	}
 	return "", fmt.Errorf("unknow kind %#v", p)
 }
 
@@ -94,10 +99,20 @@ func parseOriginPathInfo(path string) (*PathInfo, bool) {
 		info.TagsList = tails[len(tails)-1] == "list"
 	case "manifests":
 		info.Manifests = tails[len(tails)-1]
-		info.IsDigestManifests = strings.HasPrefix(info.Manifests, "sha256:")
+		info.IsDigestManifests = strings.Contains(info.Manifests, ":")
+		if info.IsDigestManifests {
+			if _, err := digest.Parse(info.Manifests); err != nil {
+				return nil, false
+			}
+		}
 	case "blobs":
 		info.Blobs = tails[len(tails)-1]
-		if len(info.Blobs) != 7+64 {
+		if _, err := digest.Parse(info.Blobs); err != nil {
+			return nil, false
+		}
+	case "referrers":
+		info.Referrers = tails[len(tails)-1]
+		if _, err := digest.Parse(info.Referrers); err != nil {
 			return nil, false
 		}
 	}
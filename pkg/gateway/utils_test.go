@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -39,6 +40,58 @@ func TestParseOriginPathInfo(t *testing.T) {
 			},
 			wantOk: true,
 		},
+		{
+			args: args{
+				path: "/v2/docker.io/library/busybox/blobs/sha512:" + strings.Repeat("a", 128),
+			},
+			want: &PathInfo{
+				Host:  "docker.io",
+				Image: "library/busybox",
+				Blobs: "sha512:" + strings.Repeat("a", 128),
+			},
+			wantOk: true,
+		},
+		{
+			args: args{
+				path: "/v2/docker.io/library/busybox/manifests/sha512:" + strings.Repeat("a", 128),
+			},
+			want: &PathInfo{
+				Host:              "docker.io",
+				Image:             "library/busybox",
+				Manifests:         "sha512:" + strings.Repeat("a", 128),
+				IsDigestManifests: true,
+			},
+			wantOk: true,
+		},
+		{
+			args: args{
+				path: "/v2/docker.io/library/busybox/blobs/sha512:" + strings.Repeat("a", 64),
+			},
+			wantOk: false,
+		},
+		{
+			args: args{
+				path: "/v2/docker.io/library/busybox/blobs/md5:" + strings.Repeat("a", 32),
+			},
+			wantOk: false,
+		},
+		{
+			args: args{
+				path: "/v2/ghcr.io/org/app/referrers/sha256:" + strings.Repeat("a", 64),
+			},
+			want: &PathInfo{
+				Host:      "ghcr.io",
+				Image:     "org/app",
+				Referrers: "sha256:" + strings.Repeat("a", 64),
+			},
+			wantOk: true,
+		},
+		{
+			args: args{
+				path: "/v2/ghcr.io/org/app/referrers/latest",
+			},
+			wantOk: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,483 @@
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/sets"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+)
+
+// GC removes blobs no longer referenced by any manifest revision in the cache.
+type GC struct {
+	manifestCache *cache.Cache
+	caches        []*cache.Cache
+
+	minAge          time.Duration
+	maxSize         int64
+	evictReferenced bool
+	dryRun          bool
+
+	policies []Policy
+
+	logger *slog.Logger
+}
+
+type Option func(g *GC)
+
+// WithManifestCache sets the cache holding the repositories tree, by default
+// the first blob cache.
+func WithManifestCache(cache *cache.Cache) Option {
+	return func(g *GC) {
+		g.manifestCache = cache
+	}
+}
+
+// WithCaches sets the caches whose blobs are swept.
+func WithCaches(caches ...*cache.Cache) Option {
+	return func(g *GC) {
+		g.caches = caches
+	}
+}
+
+// WithMinAge protects blobs written or served more recently than minAge, so
+// uploads racing with the mark phase survive.
+func WithMinAge(minAge time.Duration) Option {
+	return func(g *GC) {
+		g.minAge = minAge
+	}
+}
+
+// WithMaxSize keeps unreferenced blobs, most recently used first, as long as
+// the cache stays under maxSize bytes. Zero sweeps every unreferenced blob.
+func WithMaxSize(maxSize int64) Option {
+	return func(g *GC) {
+		g.maxSize = maxSize
+	}
+}
+
+// WithEvictReferenced also evicts the least recently used referenced blobs
+// while the cache is over its max size. Manifests are never evicted, evicted
+// layers are fetched from upstream again on the next pull.
+func WithEvictReferenced(evictReferenced bool) Option {
+	return func(g *GC) {
+		g.evictReferenced = evictReferenced
+	}
+}
+
+func WithDryRun(dryRun bool) Option {
+	return func(g *GC) {
+		g.dryRun = dryRun
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(g *GC) {
+		g.logger = logger
+	}
+}
+
+func NewGC(opts ...Option) (*GC, error) {
+	g := &GC{
+		logger: slog.Default(),
+		minAge: time.Hour,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if len(g.caches) == 0 {
+		return nil, fmt.Errorf("at least one cache must be provided")
+	}
+
+	if g.manifestCache == nil {
+		g.manifestCache = g.caches[0]
+	}
+	return g, nil
+}
+
+// Report summarizes one collection over a cache.
+type Report struct {
+	DryRun bool `json:"dryRun"`
+
+	Blobs           int   `json:"blobs"`
+	Size            int64 `json:"size"`
+	ReferencedBlobs int   `json:"referencedBlobs"`
+	ReferencedSize  int64 `json:"referencedSize"`
+	SweptBlobs      int   `json:"sweptBlobs"`
+	SweptSize       int64 `json:"sweptSize"`
+	EvictedBlobs    int   `json:"evictedBlobs,omitempty"`
+	EvictedSize     int64 `json:"evictedSize,omitempty"`
+
+	// SharedBlobs are layers referenced by more than one repository, stored
+	// once instead of DedupSavedSize more bytes.
+	SharedBlobs    int   `json:"sharedBlobs,omitempty"`
+	DedupSavedSize int64 `json:"dedupSavedSize,omitempty"`
+
+	Swept   []string `json:"swept,omitempty"`
+	Evicted []string `json:"evicted,omitempty"`
+}
+
+// Result summarizes one collection.
+type Result struct {
+	DryRun bool `json:"dryRun"`
+
+	ExpiredTags       []string `json:"expiredTags,omitempty"`
+	OrphanedRevisions []string `json:"orphanedRevisions,omitempty"`
+	UnlinkedLayers    int      `json:"unlinkedLayers,omitempty"`
+
+	Caches []Report `json:"caches"`
+}
+
+// Run applies the retention policies, marks the blobs reachable from the
+// remaining manifest revisions and sweeps the rest of every cache.
+func (g *GC) Run(ctx context.Context) (Result, error) {
+	result := Result{
+		DryRun: g.dryRun,
+	}
+
+	expiredTags, orphaned, err := g.retain(ctx)
+	if err != nil {
+		return result, fmt.Errorf("retain: %w", err)
+	}
+	result.ExpiredTags = expiredTags
+	result.OrphanedRevisions = orphaned.List()
+	sort.Strings(result.OrphanedRevisions)
+
+	referenced, manifests, layers, err := g.mark(ctx, orphaned)
+	if err != nil {
+		return result, fmt.Errorf("mark: %w", err)
+	}
+
+	unlinked, err := g.unlinkLayers(ctx, layers)
+	if err != nil {
+		return result, fmt.Errorf("unlink layers: %w", err)
+	}
+	result.UnlinkedLayers = unlinked
+
+	repos := map[string]int{}
+	for _, set := range layers {
+		for _, blob := range set.List() {
+			repos[blob]++
+		}
+	}
+
+	var saved int64
+	result.Caches = make([]Report, 0, len(g.caches))
+	for _, c := range g.caches {
+		report, err := g.sweep(ctx, c, referenced, manifests, repos)
+		if err != nil {
+			return result, fmt.Errorf("sweep: %w", err)
+		}
+		saved += report.DedupSavedSize
+		result.Caches = append(result.Caches, report)
+	}
+	metrics.BlobDedupSavedBytes.Set(float64(saved))
+	return result, nil
+}
+
+// mark returns every blob referenced from revisions other than the orphaned
+// ones, the subset of them being manifests, and the layers each repository
+// references.
+func (g *GC) mark(ctx context.Context, orphaned *sets.Set[string]) (*sets.Set[string], *sets.Set[string], map[string]*sets.Set[string], error) {
+	referenced := sets.NewSet[string]()
+	manifests := sets.NewSet[string]()
+	revisions := map[string][]string{}
+	roots := sets.NewSet[string]()
+	children := map[string][]reference{}
+
+	var pending []string
+	err := g.manifestCache.WalkManifestRevisions(ctx, func(repo, blob string) bool {
+		if orphaned.Contains(repo + "@" + blob) {
+			return true
+		}
+		revisions[repo] = append(revisions[repo], blob)
+		roots.Add(blob)
+		if !referenced.Contains(blob) {
+			referenced.Add(blob)
+			manifests.Add(blob)
+			pending = append(pending, blob)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for len(pending) != 0 {
+		blob := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		// Without the manifest its blobs would look unreferenced, so nothing
+		// can be swept safely. Only the pulled platforms of an index are
+		// stored, a child never stored has no blobs to keep.
+		content, err := g.manifestCache.GetBlobContent(ctx, blob)
+		if err != nil {
+			if !roots.Contains(blob) && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, nil, nil, fmt.Errorf("get manifest %s: %w", blob, err)
+		}
+
+		refs := manifestReferences(content)
+		children[blob] = refs
+		for _, ref := range refs {
+			if referenced.Contains(ref.Digest) {
+				continue
+			}
+			referenced.Add(ref.Digest)
+			if ref.manifest {
+				manifests.Add(ref.Digest)
+				pending = append(pending, ref.Digest)
+			}
+		}
+	}
+
+	layers := map[string]*sets.Set[string]{}
+	for repo, revs := range revisions {
+		set := sets.NewSet[string]()
+		seen := sets.NewSet[string]()
+		for len(revs) != 0 {
+			blob := revs[len(revs)-1]
+			revs = revs[:len(revs)-1]
+			if seen.Contains(blob) {
+				continue
+			}
+			seen.Add(blob)
+			for _, ref := range children[blob] {
+				if ref.manifest {
+					revs = append(revs, ref.Digest)
+				} else {
+					set.Add(ref.Digest)
+				}
+			}
+		}
+		layers[repo] = set
+	}
+
+	return referenced, manifests, layers, nil
+}
+
+// unlinkLayers removes the layer links of blobs no longer referenced by the
+// manifests of their repository.
+func (g *GC) unlinkLayers(ctx context.Context, layers map[string]*sets.Set[string]) (int, error) {
+	type link struct {
+		repo, blob string
+	}
+	var stale []link
+	err := g.manifestCache.WalkLayers(ctx, func(repo, blob string) bool {
+		set, ok := layers[repo]
+		if !ok || !set.Contains(blob) {
+			stale = append(stale, link{repo, blob})
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	unlinked := 0
+	for _, l := range stale {
+		host, image, ok := strings.Cut(l.repo, "/")
+		if !ok {
+			continue
+		}
+		if !g.dryRun {
+			err := g.manifestCache.DeleteLayerLink(ctx, host, image, l.blob)
+			if err != nil {
+				g.logger.Warn("failed to delete layer link", "repo", l.repo, "digest", l.blob, "error", err)
+				continue
+			}
+		}
+		g.logger.Info("unlink layer", "repo", l.repo, "digest", l.blob, "dryRun", g.dryRun)
+		unlinked++
+	}
+	return unlinked, nil
+}
+
+type blobStat struct {
+	blob     string
+	size     int64
+	lastUsed time.Time
+}
+
+func (g *GC) sweep(ctx context.Context, c *cache.Cache, referenced, manifests *sets.Set[string], repos map[string]int) (Report, error) {
+	report := Report{
+		DryRun: g.dryRun,
+	}
+
+	accessed := map[string]time.Time{}
+	err := c.WalkBlobAccess(ctx, func(blob string, t time.Time) bool {
+		accessed[blob] = t
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	var candidates []blobStat
+	var evictable []blobStat
+	err = c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		report.Blobs++
+		report.Size += info.Size()
+
+		stat := blobStat{
+			blob:     blob,
+			size:     info.Size(),
+			lastUsed: info.ModTime(),
+		}
+		if t, ok := accessed[blob]; ok && t.After(stat.lastUsed) {
+			stat.lastUsed = t
+		}
+		recent := now.Sub(stat.lastUsed) < g.minAge
+
+		if referenced.Contains(blob) {
+			report.ReferencedBlobs++
+			report.ReferencedSize += info.Size()
+			if n := repos[blob]; n > 1 {
+				report.SharedBlobs++
+				report.DedupSavedSize += int64(n-1) * info.Size()
+			}
+			if !recent && !manifests.Contains(blob) {
+				evictable = append(evictable, stat)
+			}
+			return true
+		}
+
+		if !recent {
+			candidates = append(candidates, stat)
+		}
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+
+	size := report.Size
+	for _, stat := range g.leastRecentlyUsed(candidates, size) {
+		if !g.delete(ctx, c, stat, "sweep blob") {
+			continue
+		}
+		size -= stat.size
+		report.SweptBlobs++
+		report.SweptSize += stat.size
+		report.Swept = append(report.Swept, stat.blob)
+	}
+
+	if g.evictReferenced && g.maxSize > 0 {
+		for _, stat := range g.leastRecentlyUsed(evictable, size) {
+			if !g.delete(ctx, c, stat, "evict blob") {
+				continue
+			}
+			size -= stat.size
+			report.EvictedBlobs++
+			report.EvictedSize += stat.size
+			report.Evicted = append(report.Evicted, stat.blob)
+		}
+	}
+
+	return report, nil
+}
+
+// leastRecentlyUsed returns the stats to remove, coldest first, to bring size
+// under the max size, or all of them without a max size.
+func (g *GC) leastRecentlyUsed(stats []blobStat, size int64) []blobStat {
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].lastUsed.Before(stats[j].lastUsed)
+	})
+
+	if g.maxSize <= 0 {
+		return stats
+	}
+	for i, stat := range stats {
+		if size <= g.maxSize {
+			return stats[:i]
+		}
+		size -= stat.size
+	}
+	return stats
+}
+
+func (g *GC) delete(ctx context.Context, c *cache.Cache, stat blobStat, msg string) bool {
+	if !g.dryRun {
+		err := c.DeleteBlob(ctx, stat.blob)
+		if err != nil {
+			g.logger.Warn("failed to delete blob", "digest", stat.blob, "error", err)
+			return false
+		}
+		metrics.GCSweptBlobsTotal.Inc()
+		metrics.GCSweptBytesTotal.Add(float64(stat.size))
+	}
+
+	g.logger.Info(msg, "digest", stat.blob, "size", stat.size, "lastUsed", stat.lastUsed, "dryRun", g.dryRun)
+	return true
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+type reference struct {
+	descriptor
+	manifest bool
+	// subject is set for the manifest a referrer points to, which is not
+	// part of the referrer.
+	subject bool
+}
+
+// manifestReferences returns the blobs and child manifests a manifest, an
+// index or a legacy schema 1 manifest points to.
+func manifestReferences(content []byte) []reference {
+	var m struct {
+		Config    *descriptor  `json:"config"`
+		Layers    []descriptor `json:"layers"`
+		Blobs     []descriptor `json:"blobs"`
+		Manifests []descriptor `json:"manifests"`
+		Subject   *descriptor  `json:"subject"`
+		FSLayers  []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"`
+	}
+	err := json.Unmarshal(content, &m)
+	if err != nil {
+		return nil
+	}
+
+	var refs []reference
+	add := func(d descriptor, manifest bool) {
+		if strings.Contains(d.Digest, ":") {
+			refs = append(refs, reference{descriptor: d, manifest: manifest})
+		}
+	}
+
+	if m.Config != nil {
+		add(*m.Config, false)
+	}
+	for _, d := range m.Layers {
+		add(d, false)
+	}
+	for _, d := range m.Blobs {
+		add(d, false)
+	}
+	for _, d := range m.Manifests {
+		add(d, true)
+	}
+	if m.Subject != nil && strings.Contains(m.Subject.Digest, ":") {
+		refs = append(refs, reference{descriptor: *m.Subject, manifest: true, subject: true})
+	}
+	for _, l := range m.FSLayers {
+		add(descriptor{Digest: l.BlobSum}, false)
+	}
+	return refs
+}
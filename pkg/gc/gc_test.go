@@ -0,0 +1,245 @@
+package gc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestManifestReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []reference
+	}{
+		{
+			name:    "image manifest",
+			content: `{"schemaVersion":2,"config":{"digest":"sha256:c"},"layers":[{"digest":"sha256:l1"},{"digest":"sha256:l2"}]}`,
+			want: []reference{
+				{descriptor: descriptor{Digest: "sha256:c"}},
+				{descriptor: descriptor{Digest: "sha256:l1"}},
+				{descriptor: descriptor{Digest: "sha256:l2"}},
+			},
+		},
+		{
+			name:    "index",
+			content: `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:m"}]}`,
+			want: []reference{
+				{descriptor: descriptor{MediaType: "application/vnd.oci.image.manifest.v1+json", Digest: "sha256:m"}, manifest: true},
+			},
+		},
+		{
+			name:    "schema 1",
+			content: `{"schemaVersion":1,"fsLayers":[{"blobSum":"sha256:l"}]}`,
+			want: []reference{
+				{descriptor: descriptor{Digest: "sha256:l"}},
+			},
+		},
+		{
+			name:    "invalid",
+			content: `not json`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := manifestReferences([]byte(tt.content))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("manifestReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	stats := []blobStat{
+		{blob: "hot", size: 10, lastUsed: now},
+		{blob: "cold", size: 10, lastUsed: now.Add(-2 * time.Hour)},
+		{blob: "warm", size: 10, lastUsed: now.Add(-time.Hour)},
+	}
+	tests := []struct {
+		name    string
+		maxSize int64
+		size    int64
+		want    []string
+	}{
+		{
+			name: "no max size",
+			size: 30,
+			want: []string{"cold", "warm", "hot"},
+		},
+		{
+			name:    "under max size",
+			maxSize: 40,
+			size:    30,
+			want:    []string{},
+		},
+		{
+			name:    "over max size",
+			maxSize: 15,
+			size:    30,
+			want:    []string{"cold", "warm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GC{maxSize: tt.maxSize}
+			got := []string{}
+			for _, stat := range g.leastRecentlyUsed(append([]blobStat(nil), stats...), tt.size) {
+				got = append(got, stat.blob)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("leastRecentlyUsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDedup(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := []byte("shared layer")
+	layerDigest := digest.FromBytes(layer).String()
+	_, err = c.PutBlobContent(ctx, layerDigest, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, image := range []string{"library/busybox", "library/alpine", "library/ubuntu"} {
+		content := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layerDigest + `"}],"annotations":{"image":"` + image + `"}}`)
+		_, _, _, err := c.PutManifestContent(ctx, "docker.io", image, "latest", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A stale link left behind by a manifest no longer cached.
+	stale := digest.FromString("stale").String()
+	err = c.PutContent(ctx, "/docker/registry/v2/repositories/docker.io/library/busybox/_layers/sha256/"+stale[len("sha256:"):]+"/link", []byte(stale))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewGC(WithCaches(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := g.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.UnlinkedLayers != 1 {
+		t.Errorf("UnlinkedLayers = %d, want 1", result.UnlinkedLayers)
+	}
+	report := result.Caches[0]
+	if report.SharedBlobs != 1 {
+		t.Errorf("SharedBlobs = %d, want 1", report.SharedBlobs)
+	}
+	if want := int64(2 * len(layer)); report.DedupSavedSize != want {
+		t.Errorf("DedupSavedSize = %d, want %d", report.DedupSavedSize, want)
+	}
+}
+
+func TestRunManifestReadError(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := []byte("layer")
+	layerDigest := digest.FromBytes(layer).String()
+	unreferenced := []byte("unreferenced")
+	unreferencedDigest := digest.FromBytes(unreferenced).String()
+	for blob, content := range map[string][]byte{layerDigest: layer, unreferencedDigest: unreferenced} {
+		_, err = c.PutBlobContent(ctx, blob, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layerDigest + `"}]}`)
+	_, manifestDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The revision is linked but its manifest can not be read.
+	err = c.DeleteBlob(ctx, manifestDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewGC(WithCaches(c), WithMinAge(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Run(ctx)
+	if err == nil {
+		t.Fatal("Run() error = nil, want the manifest read error")
+	}
+
+	for _, blob := range []string{layerDigest, unreferencedDigest} {
+		if _, err := c.StatBlob(ctx, blob); err != nil {
+			t.Errorf("blob %s swept after a failed mark: %v", blob, err)
+		}
+	}
+}
+
+func TestRunPartialIndex(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := []byte("layer")
+	layerDigest := digest.FromBytes(layer).String()
+	unreferenced := []byte("unreferenced")
+	unreferencedDigest := digest.FromBytes(unreferenced).String()
+	for blob, content := range map[string][]byte{layerDigest: layer, unreferencedDigest: unreferenced} {
+		_, err = c.PutBlobContent(ctx, blob, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the amd64 platform of the index was pulled.
+	amd64 := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layerDigest + `"}]}`)
+	_, amd64Digest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", digest.FromBytes(amd64).String(), amd64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64Digest := digest.FromString("arm64").String()
+	index := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + amd64Digest + `"},{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + arm64Digest + `"}]}`)
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewGC(WithCaches(c), WithMinAge(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want the uncached child skipped", err)
+	}
+
+	if _, err := c.StatBlob(ctx, layerDigest); err != nil {
+		t.Errorf("layer of the cached child swept: %v", err)
+	}
+	if _, err := c.StatBlob(ctx, unreferencedDigest); err == nil {
+		t.Errorf("unreferenced blob kept")
+	}
+}
@@ -0,0 +1,291 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/sets"
+	"github.com/wzshiming/hostmatcher"
+)
+
+// Policy decides which cached tags of the repositories it matches are kept.
+// A tag is kept when it satisfies any of the set rules, a policy without
+// rules keeps every tag.
+type Policy struct {
+	// Match is a "host/image" glob, like docker.io/library/*.
+	Match   string
+	matcher hostmatcher.Matcher
+
+	// KeepLast keeps the most recently used tags.
+	KeepLast int
+	// KeepTags keeps the tags matching the regexp.
+	KeepTags *regexp.Regexp
+	// MaxIdle keeps the tags used within the duration.
+	MaxIdle time.Duration
+}
+
+// ParsePolicy parses a policy like
+// "docker.io/library/* keep-last=10 keep-tags=^v[0-9.]+$ max-idle=720h".
+func ParsePolicy(s string) (Policy, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Policy{}, fmt.Errorf("empty retention policy")
+	}
+
+	p := Policy{
+		Match:   fields[0],
+		matcher: hostmatcher.NewMatcher([]string{fields[0]}),
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid retention rule %q", field)
+		}
+		switch key {
+		case "keep-last":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Policy{}, fmt.Errorf("invalid keep-last %q", value)
+			}
+			p.KeepLast = n
+		case "keep-tags":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid keep-tags %q: %w", value, err)
+			}
+			p.KeepTags = re
+		case "max-idle":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid max-idle %q: %w", value, err)
+			}
+			p.MaxIdle = d
+		default:
+			return Policy{}, fmt.Errorf("unknown retention rule %q", key)
+		}
+	}
+	return p, nil
+}
+
+func (p *Policy) empty() bool {
+	return p.KeepLast == 0 && p.KeepTags == nil && p.MaxIdle == 0
+}
+
+// tagStat is a tag and when it was last used: served, as recorded by the
+// access time of its manifest, or moved to another manifest.
+type tagStat struct {
+	tag  string
+	used time.Time
+}
+
+// expired returns the tags the policy does not keep.
+func (p *Policy) expired(tags []tagStat, now time.Time) []string {
+	if p.empty() {
+		return nil
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].used.After(tags[j].used)
+	})
+
+	var expired []string
+	for i, t := range tags {
+		if i < p.KeepLast {
+			continue
+		}
+		if p.KeepTags != nil && p.KeepTags.MatchString(t.tag) {
+			continue
+		}
+		if p.MaxIdle > 0 && now.Sub(t.used) < p.MaxIdle {
+			continue
+		}
+		expired = append(expired, t.tag)
+	}
+	return expired
+}
+
+// WithPolicies applies retention policies to the cached tags before marking,
+// the first policy matching a repository applies.
+func WithPolicies(policies ...Policy) Option {
+	return func(g *GC) {
+		g.policies = policies
+	}
+}
+
+func (g *GC) policy(repo string) *Policy {
+	for i := range g.policies {
+		if g.policies[i].matcher.Match(repo) {
+			return &g.policies[i]
+		}
+	}
+	return nil
+}
+
+// retain removes the tags expired by the policies, and the revision links of
+// the manifests, with the child manifests of indexes, that no other tag of the
+// repository reaches. It returns the expired tags and orphaned revisions as
+// "host/image:tag" and "host/image@digest". Nothing is removed if a manifest
+// can not be read.
+func (g *GC) retain(ctx context.Context) ([]string, *sets.Set[string], error) {
+	orphaned := sets.NewSet[string]()
+	if len(g.policies) == 0 {
+		return nil, orphaned, nil
+	}
+
+	repos := map[string][]tagStat{}
+	err := g.manifestCache.WalkManifestTags(ctx, func(repo, tag string, info fs.FileInfo) bool {
+		if g.policy(repo) == nil {
+			return true
+		}
+		repos[repo] = append(repos[repo], tagStat{
+			tag:  tag,
+			used: info.ModTime(),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type expiredTag struct {
+		repo, host, image, tag string
+	}
+	var expire []expiredTag
+	type orphanedRevision struct {
+		repo, host, image, blob string
+	}
+	var orphan []orphanedRevision
+
+	now := time.Now()
+repos:
+	for repo, tags := range repos {
+		host, image, ok := strings.Cut(repo, "/")
+		if !ok {
+			continue
+		}
+
+		// A tag that can not be resolved could share its manifests with the
+		// expired ones, the repository is left as it is.
+		digests := map[string]string{}
+		for i, t := range tags {
+			digest, err := g.manifestCache.DigestManifest(ctx, host, image, t.tag)
+			if err != nil {
+				g.logger.Warn("failed to get tag digest, skip repository", "repo", repo, "tag", t.tag, "error", err)
+				continue repos
+			}
+			digests[t.tag] = digest
+
+			accessed, err := g.manifestCache.BlobAccessed(ctx, digest)
+			if err == nil && accessed.After(t.used) {
+				tags[i].used = accessed
+			}
+		}
+
+		expired := g.policy(repo).expired(tags, now)
+		if len(expired) == 0 {
+			continue
+		}
+
+		expiredSet := sets.NewSet(expired...)
+		var keptRoots, expiredRoots []string
+		for tag, digest := range digests {
+			if expiredSet.Contains(tag) {
+				expiredRoots = append(expiredRoots, digest)
+			} else {
+				keptRoots = append(keptRoots, digest)
+			}
+		}
+
+		kept, err := g.manifestClosure(ctx, host, image, keptRoots)
+		if err != nil {
+			return nil, nil, fmt.Errorf("repository %s: %w", repo, err)
+		}
+		unreachable, err := g.manifestClosure(ctx, host, image, expiredRoots)
+		if err != nil {
+			return nil, nil, fmt.Errorf("repository %s: %w", repo, err)
+		}
+
+		for _, tag := range expired {
+			expire = append(expire, expiredTag{repo, host, image, tag})
+		}
+		for _, blob := range unreachable.List() {
+			if !kept.Contains(blob) {
+				orphan = append(orphan, orphanedRevision{repo, host, image, blob})
+			}
+		}
+	}
+
+	var expiredTags []string
+	for _, t := range expire {
+		if !g.dryRun {
+			err := g.manifestCache.DeleteManifestTag(ctx, t.host, t.image, t.tag)
+			if err != nil {
+				g.logger.Warn("failed to delete tag", "repo", t.repo, "tag", t.tag, "error", err)
+				continue
+			}
+		}
+		g.logger.Info("expire tag", "repo", t.repo, "tag", t.tag, "dryRun", g.dryRun)
+		expiredTags = append(expiredTags, t.repo+":"+t.tag)
+	}
+
+	for _, r := range orphan {
+		if !g.dryRun {
+			err := g.manifestCache.DeleteManifestRevision(ctx, r.host, r.image, r.blob)
+			if err != nil {
+				g.logger.Warn("failed to delete revision", "repo", r.repo, "digest", r.blob, "error", err)
+				continue
+			}
+		}
+		g.logger.Info("remove orphaned revision", "repo", r.repo, "digest", r.blob, "dryRun", g.dryRun)
+		orphaned.Add(r.repo + "@" + r.blob)
+	}
+
+	sort.Strings(expiredTags)
+	return expiredTags, orphaned, nil
+}
+
+// manifestClosure returns the manifests roots are, the child manifests they
+// reach through indexes, and the manifests converted from them.
+func (g *GC) manifestClosure(ctx context.Context, host, image string, roots []string) (*sets.Set[string], error) {
+	closure := sets.NewSet[string]()
+	pending := append([]string(nil), roots...)
+	for len(pending) != 0 {
+		blob := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if closure.Contains(blob) {
+			continue
+		}
+
+		// Only the pulled platforms of an index are stored, a child never
+		// stored has no revision to keep or orphan.
+		content, err := g.manifestCache.GetBlobContent(ctx, blob)
+		if err != nil {
+			if !slices.Contains(roots, blob) && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("get manifest %s: %w", blob, err)
+		}
+		closure.Add(blob)
+		for _, ref := range manifestReferences(content) {
+			if ref.manifest && !ref.subject {
+				pending = append(pending, ref.Digest)
+			}
+		}
+
+		converted, err := g.manifestCache.ManifestConversion(ctx, host, image, blob)
+		if err == nil {
+			pending = append(pending, converted)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("get manifest conversion %s: %w", blob, err)
+		}
+	}
+	return closure, nil
+}
@@ -0,0 +1,208 @@
+package gc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestPolicyExpired(t *testing.T) {
+	now := time.Now()
+	tags := []tagStat{
+		{tag: "v1", used: now.Add(-40 * 24 * time.Hour)},
+		{tag: "v2", used: now.Add(-35 * 24 * time.Hour)},
+		{tag: "dev-1", used: now.Add(-31 * 24 * time.Hour)},
+		{tag: "dev-2", used: now.Add(-24 * time.Hour)},
+		{tag: "latest", used: now},
+	}
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{
+			policy: "docker.io/library/*",
+		},
+		{
+			policy: "docker.io/library/* keep-last=2",
+			want:   []string{"dev-1", "v2", "v1"},
+		},
+		{
+			policy: "docker.io/library/* keep-tags=^v[0-9]+$",
+			want:   []string{"latest", "dev-2", "dev-1"},
+		},
+		{
+			policy: "docker.io/library/* max-idle=720h",
+			want:   []string{"dev-1", "v2", "v1"},
+		},
+		{
+			policy: "docker.io/library/* keep-last=1 keep-tags=^v max-idle=720h",
+			want:   []string{"dev-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			p, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+			got := p.expired(append([]tagStat(nil), tags...), now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	for _, s := range []string{"", "docker.io/* keep-last", "docker.io/* keep-last=x", "docker.io/* keep-tags=(", "docker.io/* max-size=1"} {
+		_, err := ParsePolicy(s)
+		if err == nil {
+			t.Errorf("ParsePolicy(%q) expected error", s)
+		}
+	}
+}
+
+func TestRetainManifestClosure(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(tagOrBlob string, content string) string {
+		t.Helper()
+		if tagOrBlob == "" {
+			tagOrBlob = digest.FromString(content).String()
+		}
+		_, blob, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", tagOrBlob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+	image := func(arch string) string {
+		return put("", `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[],"annotations":{"arch":"`+arch+`"}}`)
+	}
+	index := func(tag string, children ...string) string {
+		content := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[`
+		for i, child := range children {
+			if i != 0 {
+				content += ","
+			}
+			content += `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + child + `","size":` + strconv.Itoa(i) + `}`
+		}
+		return put(tag, content+`]}`)
+	}
+
+	amd64 := image("amd64")
+	arm64 := image("arm64")
+	s390x := image("s390x")
+	old := index("old", amd64, s390x)
+	time.Sleep(10 * time.Millisecond)
+	current := index("new", arm64, s390x)
+
+	// The manifests converted from the indexes, which no tag links.
+	convert := func(blob string) string {
+		t.Helper()
+		converted := put("", `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[],"annotations":{"from":"`+blob+`"}}`)
+		err := c.LinkManifestConversion(ctx, "docker.io", "library/busybox", blob, converted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return converted
+	}
+	oldConverted := convert(old)
+	currentConverted := convert(current)
+
+	p, err := ParsePolicy("docker.io/library/* keep-last=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGC(WithCaches(c), WithPolicies(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := g.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"docker.io/library/busybox:old"}; !reflect.DeepEqual(result.ExpiredTags, want) {
+		t.Errorf("ExpiredTags = %v, want %v", result.ExpiredTags, want)
+	}
+	want := []string{"docker.io/library/busybox@" + old, "docker.io/library/busybox@" + amd64, "docker.io/library/busybox@" + oldConverted}
+	sort.Strings(want)
+	if !reflect.DeepEqual(result.OrphanedRevisions, want) {
+		t.Errorf("OrphanedRevisions = %v, want %v", result.OrphanedRevisions, want)
+	}
+	if ok, _ := c.StatManifest(ctx, "docker.io", "library/busybox", s390x); !ok {
+		t.Errorf("revision %s shared with a kept tag was removed", s390x)
+	}
+	if ok, _ := c.StatManifest(ctx, "docker.io", "library/busybox", currentConverted); !ok {
+		t.Errorf("revision %s converted from a kept tag was removed", currentConverted)
+	}
+	if _, err := c.ManifestConversion(ctx, "docker.io", "library/busybox", old); err == nil {
+		t.Errorf("conversion link of the orphaned revision %s was kept", old)
+	}
+}
+
+func TestRetainServedTag(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()), cache.WithAccessFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(tagOrBlob string, content string) string {
+		t.Helper()
+		if tagOrBlob == "" {
+			tagOrBlob = digest.FromString(content).String()
+		}
+		_, blob, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", tagOrBlob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+
+	// The pinned tag is an index with only one of its platforms cached.
+	amd64 := put("", `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`)
+	arm64 := digest.FromString("arm64").String()
+	pinned := put("v1.2.3", `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"`+amd64+`"},{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"`+arm64+`"}]}`)
+	put("old", `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[],"annotations":{"tag":"old"}}`)
+
+	// Neither tag moved within max-idle, but the pinned one is still pulled.
+	time.Sleep(100 * time.Millisecond)
+	c.TouchBlob(pinned)
+	err = c.FlushBlobAccess(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ParsePolicy("docker.io/library/* max-idle=50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGC(WithCaches(c), WithPolicies(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := g.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"docker.io/library/busybox:old"}; !reflect.DeepEqual(result.ExpiredTags, want) {
+		t.Errorf("ExpiredTags = %v, want %v", result.ExpiredTags, want)
+	}
+	if ok, _ := c.StatManifest(ctx, "docker.io", "library/busybox", amd64); !ok {
+		t.Errorf("revision %s of the served tag was removed", amd64)
+	}
+}
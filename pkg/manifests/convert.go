@@ -0,0 +1,377 @@
+package manifests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// errNotCached is returned converting an index whose children are not cached
+// yet.
+var errNotCached = errors.New("not cached yet")
+
+// counterparts maps the media types of manifests between the OCI and the
+// Docker schema2 formats.
+var counterparts = map[string]string{
+	mediaTypeOCIIndex:       mediaTypeDockerList,
+	mediaTypeDockerList:     mediaTypeOCIIndex,
+	mediaTypeOCIManifest:    mediaTypeDockerManifest,
+	mediaTypeDockerManifest: mediaTypeOCIManifest,
+}
+
+// ociToDocker maps the media types of the blobs of OCI manifests to Docker
+// schema2, dockerToOCI is the reverse.
+var (
+	ociToDocker = map[string]string{
+		"application/vnd.oci.image.config.v1+json":                     "application/vnd.docker.container.image.v1+json",
+		"application/vnd.oci.image.layer.v1.tar+gzip":                  "application/vnd.docker.image.rootfs.diff.tar.gzip",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip": "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip",
+	}
+	dockerToOCI = map[string]string{}
+)
+
+func init() {
+	for k, v := range ociToDocker {
+		dockerToOCI[v] = k
+	}
+}
+
+// WithConvert serves manifests converted between the OCI and the Docker
+// schema2 formats to clients that do not accept the stored one. The
+// converted manifests have their own digest and are cached as revisions.
+func WithConvert(convert bool) Option {
+	return func(c *Manifests) {
+		c.convert = convert
+	}
+}
+
+// parseAccept returns the media types of the Accept headers, nil when any
+// media type is accepted.
+func parseAccept(header http.Header) []string {
+	var accepts []string
+	for _, value := range header.Values("Accept") {
+		for _, item := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+			if err != nil {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+					continue
+				}
+			}
+			if mediaType == "*/*" || mediaType == "application/*" {
+				return nil
+			}
+			accepts = append(accepts, mediaType)
+		}
+	}
+	return accepts
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// needsConversion reports whether the client only accepts the counterpart of
+// the media type of the manifest of the tag. Manifests requested by digest
+// are served as they are.
+func (c *Manifests) needsConversion(r *http.Request, info *PathInfo, mediaType string) bool {
+	if !c.convert || info.IsDigestManifests {
+		return false
+	}
+	accepts := parseAccept(r.Header)
+	if len(accepts) == 0 || contains(accepts, mediaType) {
+		return false
+	}
+	target, ok := counterparts[mediaType]
+	return ok && contains(accepts, target)
+}
+
+type conversionKey struct {
+	Host   string
+	Image  string
+	Digest string
+}
+
+// convertManifest returns the counterpart of the manifest, storing it and
+// the converted children of an index as revisions so they can be pulled by
+// their digest. The revisions are linked to the manifests they are converted
+// from, the gc collects them along with those.
+func (c *Manifests) convertManifest(ctx context.Context, info *PathInfo, content []byte, manifestDigest, mediaType string) ([]byte, string, string, error) {
+	key := conversionKey{Host: info.Host, Image: info.Image, Digest: manifestDigest}
+	convertedDigest, ok := c.conversions.Get(key)
+	if !ok {
+		convertedDigest, _ = c.cache.ManifestConversion(ctx, info.Host, info.Image, manifestDigest)
+	}
+	if convertedDigest != "" {
+		converted, _, convertedType, err := c.cache.GetManifestContent(ctx, info.Host, info.Image, convertedDigest)
+		if err == nil {
+			c.conversions.SetWithTTL(key, convertedDigest, c.manifestCacheDuration)
+			return converted, convertedDigest, convertedType, nil
+		}
+		c.conversions.Remove(key)
+	}
+
+	target := counterparts[mediaType]
+	var converted []byte
+	var partial bool
+	var err error
+	switch mediaType {
+	case mediaTypeOCIIndex, mediaTypeDockerList:
+		converted, partial, err = convertIndex(content, target, func(d descriptor) (descriptor, error) {
+			return c.convertChild(ctx, info, d)
+		})
+	default:
+		converted, err = convertImageManifest(content, target)
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if partial {
+		// Converted again on every pull until all the children are cached.
+		convertedDigest, err = c.putConverted(ctx, info, "", converted)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return converted, convertedDigest, target, nil
+	}
+
+	convertedDigest, err = c.putConverted(ctx, info, manifestDigest, converted)
+	if err != nil {
+		return nil, "", "", err
+	}
+	c.conversions.SetWithTTL(key, convertedDigest, c.manifestCacheDuration)
+	return converted, convertedDigest, target, nil
+}
+
+// convertChild converts a manifest of an index. A manifest not cached yet is
+// cached in the background, not within the request, and left out of the
+// index until it is.
+func (c *Manifests) convertChild(ctx context.Context, info *PathInfo, d descriptor) (descriptor, error) {
+	child := &PathInfo{
+		Host:              info.Host,
+		Image:             info.Image,
+		Manifests:         d.Digest,
+		IsDigestManifests: true,
+	}
+	content, _, _, err := c.cache.GetManifestContent(ctx, child.Host, child.Image, child.Manifests)
+	if err != nil {
+		c.cacheChild(ctx, child)
+		return descriptor{}, fmt.Errorf("manifest %s: %w", d.Digest, errNotCached)
+	}
+
+	target, ok := counterparts[d.MediaType]
+	if !ok {
+		return descriptor{}, fmt.Errorf("unsupported manifest media type %q", d.MediaType)
+	}
+	converted, err := convertImageManifest(content, target)
+	if err != nil {
+		return descriptor{}, err
+	}
+	convertedDigest, err := c.putConverted(ctx, info, d.Digest, converted)
+	if err != nil {
+		return descriptor{}, err
+	}
+
+	d.MediaType = target
+	d.Digest = convertedDigest
+	d.Size = int64(len(converted))
+	return d, nil
+}
+
+// cacheChild queues the sync of a manifest of an index without waiting for it.
+func (c *Manifests) cacheChild(ctx context.Context, child *PathInfo) {
+	if c.queueClient == nil {
+		c.queue.AddWeight(*child, 0)
+		return
+	}
+	_, err := c.queueClient.Create(context.WithoutCancel(ctx), formatPathInfo(child), 0, model.MessageAttr{
+		Kind:  model.KindManifest,
+		Host:  child.Host,
+		Image: child.Image,
+	})
+	if err != nil {
+		c.logger.Warn("failed to create queue message", "error", err)
+	}
+}
+
+// putConverted stores the converted manifest as a revision, linked to the
+// manifest it is converted from unless manifestDigest is empty.
+func (c *Manifests) putConverted(ctx context.Context, info *PathInfo, manifestDigest string, converted []byte) (string, error) {
+	convertedDigest := digest.FromBytes(converted).String()
+	exist, _ := c.cache.StatManifest(ctx, info.Host, info.Image, convertedDigest)
+	if !exist {
+		_, _, _, err := c.cache.PutManifestContent(ctx, info.Host, info.Image, convertedDigest, converted)
+		if err != nil {
+			return "", err
+		}
+	}
+	if manifestDigest == "" {
+		return convertedDigest, nil
+	}
+	err := c.cache.LinkManifestConversion(ctx, info.Host, info.Image, manifestDigest, convertedDigest)
+	if err != nil {
+		return "", err
+	}
+	return convertedDigest, nil
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *platform         `json:"platform,omitempty"`
+}
+
+type platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	Features     []string `json:"features,omitempty"`
+}
+
+type imageManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Subject       *descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type imageIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []descriptor      `json:"manifests"`
+	Subject       *descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// convertImageManifest converts an image manifest to the target media type,
+// the config and layers are the same blobs. Artifacts like signatures have no
+// Docker schema2 counterpart.
+func convertImageManifest(content []byte, target string) ([]byte, error) {
+	var m imageManifest
+	err := json.Unmarshal(content, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := dockerToOCI
+	if target == mediaTypeDockerManifest {
+		if m.ArtifactType != "" || m.Subject != nil {
+			return nil, fmt.Errorf("artifact manifests can not be converted to %s", target)
+		}
+		mapping = ociToDocker
+		m.Annotations = nil
+	}
+
+	m.MediaType = target
+	m.Config, err = convertDescriptor(m.Config, mapping, target)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range m.Layers {
+		m.Layers[i], err = convertDescriptor(l, mapping, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.MarshalIndent(m, "", "   ")
+}
+
+func convertDescriptor(d descriptor, mapping map[string]string, target string) (descriptor, error) {
+	mediaType, ok := mapping[d.MediaType]
+	if !ok {
+		return descriptor{}, fmt.Errorf("media type %q has no counterpart in %s", d.MediaType, target)
+	}
+	d.MediaType = mediaType
+	if target == mediaTypeDockerManifest {
+		d.Annotations = nil
+	}
+	return d, nil
+}
+
+// convertIndex converts an index to the target media type with the children
+// converted by convertChild. Attestations and other children without a
+// platform are dropped from Docker manifest lists, the children not cached
+// yet are dropped too and reported by partial. Every child is tried even
+// after one failed, so all the missing ones are requested at once.
+func convertIndex(content []byte, target string, convertChild func(d descriptor) (descriptor, error)) (_ []byte, partial bool, _ error) {
+	var m imageIndex
+	err := json.Unmarshal(content, &m)
+	if err != nil {
+		return nil, false, err
+	}
+
+	toDocker := target == mediaTypeDockerList
+	if toDocker {
+		if m.ArtifactType != "" || m.Subject != nil {
+			return nil, false, fmt.Errorf("artifact indexes can not be converted to %s", target)
+		}
+		m.Annotations = nil
+	}
+
+	var errs []error
+	manifests := make([]descriptor, 0, len(m.Manifests))
+	for _, d := range m.Manifests {
+		if toDocker && (d.Platform == nil || d.Platform.OS == "unknown") {
+			continue
+		}
+		d, err := convertChild(d)
+		if err != nil {
+			if errors.Is(err, errNotCached) {
+				partial = true
+				continue
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if toDocker {
+			d.Annotations = nil
+		}
+		manifests = append(manifests, d)
+	}
+	if len(errs) != 0 {
+		return nil, false, errors.Join(errs...)
+	}
+	if len(manifests) == 0 {
+		if partial {
+			return nil, false, fmt.Errorf("no manifests to convert to %s: %w", target, errNotCached)
+		}
+		return nil, false, fmt.Errorf("no manifests to convert to %s", target)
+	}
+
+	m.MediaType = target
+	m.Manifests = manifests
+	converted, err := json.MarshalIndent(m, "", "   ")
+	return converted, partial, err
+}
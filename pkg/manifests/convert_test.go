@@ -0,0 +1,245 @@
+package manifests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/queuetest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   []string
+	}{
+		{
+			accept: nil,
+			want:   nil,
+		},
+		{
+			accept: []string{mediaTypeDockerManifest + ", " + mediaTypeDockerList + ";q=0.9"},
+			want:   []string{mediaTypeDockerManifest, mediaTypeDockerList},
+		},
+		{
+			accept: []string{mediaTypeDockerManifest, mediaTypeOCIIndex + ";q=0"},
+			want:   []string{mediaTypeDockerManifest},
+		},
+		{
+			accept: []string{mediaTypeDockerManifest, "*/*"},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for _, a := range tt.accept {
+			header.Add("Accept", a)
+		}
+		got := parseAccept(header)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAccept(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestConvertImageManifest(t *testing.T) {
+	oci := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromString("config").String() + `","size":1},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"` + digest.FromString("layer").String() + `","size":2}],"annotations":{"org.opencontainers.image.created":"now"}}`)
+
+	docker, err := convertImageManifest(oci, mediaTypeDockerManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m imageManifest
+	err = json.Unmarshal(docker, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeDockerManifest,
+		Config:        descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Digest: digest.FromString("config").String(), Size: 1},
+		Layers:        []descriptor{{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: digest.FromString("layer").String(), Size: 2}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("convertImageManifest() = %+v, want %+v", m, want)
+	}
+
+	back, err := convertImageManifest(docker, mediaTypeOCIManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(back, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaType != mediaTypeOCIManifest || m.Config.MediaType != "application/vnd.oci.image.config.v1+json" || m.Layers[0].MediaType != "application/vnd.oci.image.layer.v1.tar+gzip" {
+		t.Errorf("convertImageManifest() back to OCI = %+v", m)
+	}
+
+	signature := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.dev.cosign.artifact.sig.v1+json","digest":"` + digest.FromString("config").String() + `","size":1},"layers":[]}`)
+	_, err = convertImageManifest(signature, mediaTypeDockerManifest)
+	if err == nil {
+		t.Errorf("convertImageManifest() of a signature succeeded, want error")
+	}
+}
+
+func TestServeConverted(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromString("config").String() + `","size":1},"layers":[]}`)
+	_, childDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", digest.FromBytes(child).String(), child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := digest.FromString("attestation").String()
+	index := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + childDigest + `","size":` + strconv.Itoa(len(child)) + `,"platform":{"architecture":"amd64","os":"linux"}},{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + attestation + `","size":1,"platform":{"architecture":"unknown","os":"unknown"}}]}`)
+	_, indexDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManifests(WithCache(c), WithOffline(true), WithConvert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(manifest, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v2/library/busybox/manifests/"+manifest, nil)
+		r.Header.Set("Accept", accept)
+		rw := httptest.NewRecorder()
+		m.Serve(rw, r, &PathInfo{
+			Host:              "docker.io",
+			Image:             "library/busybox",
+			Manifests:         manifest,
+			IsDigestManifests: manifest != "latest",
+		}, &token.Token{})
+		return rw
+	}
+
+	rw := serve("latest", mediaTypeOCIIndex+","+mediaTypeOCIManifest)
+	if got := rw.Header().Get("Docker-Content-Digest"); got != indexDigest {
+		t.Errorf("compatible digest = %s, want the stored %s", got, indexDigest)
+	}
+
+	rw = serve("latest", mediaTypeDockerList+","+mediaTypeDockerManifest)
+	if got := rw.Header().Get("Content-Type"); got != mediaTypeDockerList {
+		t.Fatalf("converted Content-Type = %s, want %s", got, mediaTypeDockerList)
+	}
+	listDigest := rw.Header().Get("Docker-Content-Digest")
+	if listDigest == indexDigest || listDigest != digest.FromBytes(rw.Body.Bytes()).String() {
+		t.Errorf("converted digest = %s, want the digest of the converted body", listDigest)
+	}
+	if got, _ := c.ManifestConversion(ctx, "docker.io", "library/busybox", indexDigest); got != listDigest {
+		t.Errorf("conversion link = %s, want %s", got, listDigest)
+	}
+	var list imageIndex
+	err = json.Unmarshal(rw.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Manifests) != 1 || list.Manifests[0].MediaType != mediaTypeDockerManifest {
+		t.Fatalf("converted manifests = %+v, want one Docker manifest", list.Manifests)
+	}
+
+	// The converted manifests are pulled by their digest.
+	rw = serve(list.Manifests[0].Digest, mediaTypeDockerManifest)
+	if rw.Code != http.StatusOK || rw.Header().Get("Content-Type") != mediaTypeDockerManifest {
+		t.Errorf("converted child = %d %s", rw.Code, rw.Header().Get("Content-Type"))
+	}
+	rw = serve(listDigest, mediaTypeDockerList)
+	if rw.Code != http.StatusOK || rw.Header().Get("Content-Type") != mediaTypeDockerList {
+		t.Errorf("converted list = %d %s", rw.Code, rw.Header().Get("Content-Type"))
+	}
+}
+
+func TestServeConvertedMissingChildren(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromString("config").String() + `","size":1},"layers":[]}`)
+	_, amd64, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", digest.FromBytes(child).String(), child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64 := digest.FromString("arm64").String()
+	s390x := digest.FromString("s390x").String()
+	index := func(children ...string) []byte {
+		var manifests []string
+		for _, child := range children {
+			manifests = append(manifests, `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"`+child+`","size":1,"platform":{"architecture":"amd64","os":"linux"}}`)
+		}
+		return []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` + strings.Join(manifests, ",") + `]}`)
+	}
+	_, indexDigest, _, err := c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", index(amd64, arm64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", "s390x", index(s390x))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := queuetest.NewQueue(t)
+	m, err := NewManifests(WithCache(c), WithOffline(true), WithConvert(true), WithQueueClient(queue.MessageClient()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(tag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v2/library/busybox/manifests/"+tag, nil)
+		r.Header.Set("Accept", mediaTypeDockerList+","+mediaTypeDockerManifest)
+		rw := httptest.NewRecorder()
+		m.Serve(rw, r, &PathInfo{Host: "docker.io", Image: "library/busybox", Manifests: tag}, &token.Token{})
+		return rw
+	}
+
+	// The cached children are served while the others are cached in the
+	// background.
+	rw := serve("latest")
+	if got := rw.Header().Get("Content-Type"); got != mediaTypeDockerList {
+		t.Fatalf("Content-Type = %s, want %s", got, mediaTypeDockerList)
+	}
+	if got := rw.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Vary = %q, want Accept", got)
+	}
+	var list imageIndex
+	err = json.Unmarshal(rw.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Manifests) != 1 || list.Manifests[0].MediaType != mediaTypeDockerManifest {
+		t.Errorf("converted manifests = %+v, want the cached one", list.Manifests)
+	}
+	if got, _ := c.ManifestConversion(ctx, "docker.io", "library/busybox", indexDigest); got != "" {
+		t.Errorf("partial conversion linked to %s", got)
+	}
+
+	// Nothing acceptable is cached yet.
+	rw = serve("s390x")
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rw.Code, http.StatusNotFound)
+	}
+
+	var got []string
+	for _, msg := range queue.Messages() {
+		got = append(got, msg.Content)
+	}
+	want := []string{"docker.io/library/busybox@" + arm64, "docker.io/library/busybox@" + s390x}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("queued = %v, want %v", got, want)
+	}
+}
@@ -16,11 +16,16 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/internal/queue"
 	"github.com/OpenCIDN/OpenCIDN/internal/utils"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
 	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/wzshiming/imc"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Manifests struct {
@@ -33,6 +38,12 @@ type Manifests struct {
 
 	manifestCacheDuration time.Duration
 	manifestCache         *manifestCache
+	manifestMaxStale      time.Duration
+
+	offline bool
+
+	convert     bool
+	conversions *imc.Cache[conversionKey, string]
 
 	acceptsItems []string
 	acceptsStr   string
@@ -58,6 +69,23 @@ func WithManifestCacheDuration(manifestCacheDuration time.Duration) Option {
 	}
 }
 
+// WithManifestMaxStale bounds how old a cached tag may be before a request
+// waits for upstream instead of being served while it refreshes in the background.
+// Zero means cached tags are always served immediately.
+func WithManifestMaxStale(manifestMaxStale time.Duration) Option {
+	return func(c *Manifests) {
+		c.manifestMaxStale = manifestMaxStale
+	}
+}
+
+// WithOffline never contacts upstream for manifests that are already cached,
+// serving tags from their last known digest.
+func WithOffline(offline bool) Option {
+	return func(c *Manifests) {
+		c.offline = offline
+	}
+}
+
 func WithLogger(logger *slog.Logger) Option {
 	return func(c *Manifests) {
 		c.logger = logger
@@ -114,6 +142,13 @@ func NewManifests(opts ...Option) (*Manifests, error) {
 	c.manifestCache = newManifestCache(c.manifestCacheDuration)
 	c.manifestCache.Start(ctx, c.logger)
 
+	if c.convert {
+		c.conversions = imc.NewCache[conversionKey, string]()
+		go c.conversions.RunEvict(ctx, func(key conversionKey, value string) bool {
+			return true
+		})
+	}
+
 	for i := 0; i <= c.concurrency; i++ {
 		go c.worker(ctx)
 	}
@@ -137,8 +172,7 @@ func (c *Manifests) worker(ctx context.Context) {
 }
 
 func formatPathInfo(info *PathInfo) string {
-	isHash := strings.HasPrefix(info.Manifests, "sha256:")
-	if isHash {
+	if info.IsDigestManifests {
 		return fmt.Sprintf("%s/%s@%s", info.Host, info.Image, info.Manifests)
 	}
 	return fmt.Sprintf("%s/%s:%s", info.Host, info.Image, info.Manifests)
@@ -147,15 +181,29 @@ func formatPathInfo(info *PathInfo) string {
 func (c *Manifests) Serve(rw http.ResponseWriter, r *http.Request, info *PathInfo, t *token.Token) {
 	ctx := r.Context()
 
+	if c.convert {
+		// The manifest of a tag is served in the media type the client accepts.
+		rw.Header().Set("Vary", "Accept")
+	}
+
+	if c.offline || t.Offline {
+		if c.serveOfflineManifest(rw, r, info) {
+			return
+		}
+	}
+
 	done := c.tryFirstServeCachedManifest(rw, r, info, t)
 	if done {
 		return
 	}
 
 	ok, _ := c.cache.StatManifest(r.Context(), info.Host, info.Image, info.Manifests)
+	if ok && c.isTooStale(ctx, info) {
+		ok = false
+	}
 	if ok {
 		if c.queueClient != nil {
-			_, err := c.queueClient.Create(context.Background(), formatPathInfo(info), 0, model.MessageAttr{
+			_, err := c.queueClient.Create(context.WithoutCancel(ctx), formatPathInfo(info), 0, model.MessageAttr{
 				Kind:  model.KindManifest,
 				Host:  info.Host,
 				Image: info.Image,
@@ -186,6 +234,9 @@ func (c *Manifests) Serve(rw http.ResponseWriter, r *http.Request, info *PathInf
 				} else if strings.Contains(errStr, "status code 401") {
 					utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
 					return
+				} else if strings.Contains(errStr, "status code 429") {
+					utils.ServeError(rw, r, errcode.ErrorCodeTooManyRequests, 0)
+					return
 				} else if strings.Contains(errStr, "unsupported target response") {
 					utils.ServeError(rw, r, errcode.ErrorCodeDenied, 0)
 					return
@@ -218,7 +269,31 @@ func (c *Manifests) Serve(rw http.ResponseWriter, r *http.Request, info *PathInf
 	utils.ServeError(rw, r, errcode.ErrorCodeUnknown, 0)
 }
 
-func (c *Manifests) waitingQueue(ctx context.Context, msg string, weight int, info *PathInfo) error {
+func (c *Manifests) isTooStale(ctx context.Context, info *PathInfo) bool {
+	if c.manifestMaxStale <= 0 || info.IsDigestManifests {
+		return false
+	}
+
+	checked, err := c.cache.ManifestTagChecked(ctx, info.Host, info.Image, info.Manifests)
+	if err != nil {
+		return true
+	}
+
+	age := time.Since(checked)
+	if age <= c.manifestMaxStale {
+		return false
+	}
+
+	c.logger.Info("manifest too stale", "host", info.Host, "image", info.Image, "manifest", info.Manifests, "age", age)
+	return true
+}
+
+func (c *Manifests) waitingQueue(ctx context.Context, msg string, weight int, info *PathInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "manifests.waitingQueue", attribute.String("message.content", msg))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -302,6 +377,9 @@ func (c *Manifests) cacheManifest(info *PathInfo) (int, error) {
 		switch resp.StatusCode {
 		case http.StatusUnauthorized, http.StatusForbidden:
 			return 0, errcode.ErrorCodeDenied
+		case http.StatusTooManyRequests:
+			c.logger.Warn("upstream rate limited", "url", u.String(), "retryAfter", resp.Header.Get("Retry-After"))
+			return http.StatusTooManyRequests, errcode.ErrorCodeTooManyRequests
 		}
 		if resp.StatusCode < http.StatusOK ||
 			(resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest) {
@@ -348,6 +426,9 @@ func (c *Manifests) cacheManifest(info *PathInfo) (int, error) {
 	case http.StatusUnauthorized, http.StatusForbidden:
 		c.logger.Error("upstream denied", "statusCode", resp.StatusCode, "url", u.String(), "response", dumpResponse(resp))
 		return 0, errcode.ErrorCodeDenied
+	case http.StatusTooManyRequests:
+		c.logger.Warn("upstream rate limited", "url", u.String(), "retryAfter", resp.Header.Get("Retry-After"))
+		return http.StatusTooManyRequests, errcode.ErrorCodeTooManyRequests
 	}
 	if resp.StatusCode < http.StatusOK ||
 		(resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest) {
@@ -396,7 +477,7 @@ func (c *Manifests) tryFirstServeCachedManifest(rw http.ResponseWriter, r *http.
 			return true
 		}
 
-		if val.MediaType == "" || val.Length == "" {
+		if val.MediaType == "" || val.Length == "" || c.needsConversion(r, info, val.MediaType) {
 			if c.serveCachedManifest(rw, r, info, true, "hit and mark") {
 				return true
 			}
@@ -405,6 +486,7 @@ func (c *Manifests) tryFirstServeCachedManifest(rw http.ResponseWriter, r *http.
 		}
 
 		if r.Method == http.MethodHead {
+			metrics.ManifestCacheTotal.WithLabelValues("memory", "hit").Inc()
 			rw.Header().Set("Docker-Content-Digest", val.Digest)
 			rw.Header().Set("Content-Type", val.MediaType)
 			rw.Header().Set("Content-Length", val.Length)
@@ -412,6 +494,7 @@ func (c *Manifests) tryFirstServeCachedManifest(rw http.ResponseWriter, r *http.
 		}
 
 		if len(val.Body) != 0 {
+			metrics.ManifestCacheTotal.WithLabelValues("memory", "hit").Inc()
 			rw.Header().Set("Docker-Content-Digest", val.Digest)
 			rw.Header().Set("Content-Type", val.MediaType)
 			rw.Header().Set("Content-Length", val.Length)
@@ -437,6 +520,27 @@ func (c *Manifests) tryFirstServeCachedManifest(rw http.ResponseWriter, r *http.
 	return false
 }
 
+// staleWarning marks a tag served from the cache without checking upstream.
+const staleWarning = `110 - "Response is Stale"`
+
+func (c *Manifests) serveOfflineManifest(rw http.ResponseWriter, r *http.Request, info *PathInfo) (done bool) {
+	if info.IsDigestManifests {
+		return c.serveCachedManifest(rw, r, info, true, "offline")
+	}
+
+	ok, _ := c.cache.StatManifest(r.Context(), info.Host, info.Image, info.Manifests)
+	if !ok {
+		return false
+	}
+
+	rw.Header().Set("Warning", staleWarning)
+	if c.serveCachedManifest(rw, r, info, true, "offline") {
+		return true
+	}
+	rw.Header().Del("Warning")
+	return false
+}
+
 func (c *Manifests) missServeCachedManifest(rw http.ResponseWriter, r *http.Request, info *PathInfo) (done bool) {
 	val, ok := c.manifestCache.Get(info)
 	if ok {
@@ -445,11 +549,12 @@ func (c *Manifests) missServeCachedManifest(rw http.ResponseWriter, r *http.Requ
 			return true
 		}
 
-		if val.MediaType == "" || val.Length == "" {
+		if val.MediaType == "" || val.Length == "" || c.needsConversion(r, info, val.MediaType) {
 			return c.serveCachedManifest(rw, r, info, true, "miss and mark")
 		}
 
 		if r.Method == http.MethodHead {
+			metrics.ManifestCacheTotal.WithLabelValues("memory", "hit").Inc()
 			rw.Header().Set("Docker-Content-Digest", val.Digest)
 			rw.Header().Set("Content-Type", val.MediaType)
 			rw.Header().Set("Content-Length", val.Length)
@@ -457,6 +562,7 @@ func (c *Manifests) missServeCachedManifest(rw http.ResponseWriter, r *http.Requ
 		}
 
 		if len(val.Body) != 0 {
+			metrics.ManifestCacheTotal.WithLabelValues("memory", "hit").Inc()
 			rw.Header().Set("Docker-Content-Digest", val.Digest)
 			rw.Header().Set("Content-Type", val.MediaType)
 			rw.Header().Set("Content-Length", val.Length)
@@ -476,8 +582,12 @@ func (c *Manifests) serveCachedManifest(rw http.ResponseWriter, r *http.Request,
 	content, digest, mediaType, err := c.cache.GetManifestContent(ctx, info.Host, info.Image, info.Manifests)
 	if err != nil {
 		c.logger.Warn("manifest missed", "phase", phase, "host", info.Host, "image", info.Image, "manifest", info.Manifests, "error", err)
+		metrics.ManifestCacheTotal.WithLabelValues(phase, "miss").Inc()
 		return false
 	}
+	metrics.ManifestCacheTotal.WithLabelValues(phase, "hit").Inc()
+	// The gc tells the tags still pulled from the idle ones by it.
+	c.cache.TouchBlob(digest)
 
 	c.logger.Info("manifest hit", "phase", phase, "host", info.Host, "image", info.Image, "manifest", info.Manifests, "digest", digest)
 
@@ -491,6 +601,19 @@ func (c *Manifests) serveCachedManifest(rw http.ResponseWriter, r *http.Request,
 		})
 	}
 
+	if c.needsConversion(r, info, mediaType) {
+		converted, convertedDigest, convertedType, err := c.convertManifest(ctx, info, content, digest, mediaType)
+		if err != nil {
+			// The client accepts none of the stored media type.
+			c.logger.Warn("failed to convert manifest", "host", info.Host, "image", info.Image, "manifest", info.Manifests, "mediaType", mediaType, "error", err)
+			utils.ServeError(rw, r, v2.ErrorCodeManifestUnknown.WithDetail(err.Error()), 0)
+			return true
+		}
+		metrics.ManifestConvertedTotal.WithLabelValues(convertedType).Inc()
+		content, digest, mediaType = converted, convertedDigest, convertedType
+		length = strconv.FormatInt(int64(len(content)), 10)
+	}
+
 	rw.Header().Set("Docker-Content-Digest", digest)
 	rw.Header().Set("Content-Type", mediaType)
 	rw.Header().Set("Content-Length", length)
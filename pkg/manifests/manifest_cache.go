@@ -3,8 +3,10 @@ package manifests
 import (
 	"context"
 	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/wzshiming/imc"
 )
 
@@ -77,17 +79,22 @@ func (m *manifestCache) Get(info *PathInfo) (cacheValue, bool) {
 }
 
 func (m *manifestCache) PutError(info *PathInfo, err error, sc int) {
+	duration := m.duration
+	if sc == http.StatusTooManyRequests && duration > transport.MaxRateLimitDelay {
+		// Let the manifest be retried once the upstream quota may have recovered.
+		duration = transport.MaxRateLimitDelay
+	}
 	key := manifestCacheKey(info)
 	if !info.IsDigestManifests {
 		m.tag.SetWithTTL(key, cacheTagValue{
 			Error:      err,
 			StatusCode: sc,
-		}, m.duration)
+		}, duration)
 	} else {
 		m.digest.SetWithTTL(key, cacheDigestValue{
 			Error:      err,
 			StatusCode: sc,
-		}, m.duration)
+		}, duration)
 	}
 }
 
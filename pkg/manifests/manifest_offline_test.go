@@ -0,0 +1,105 @@
+package manifests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestServeOfflineManifest(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream is unreachable.
+	var requests atomic.Int32
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "https://")
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	_, manifestDigest, _, err := c.PutManifestContent(ctx, host, "library/busybox", "latest", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		offline      bool
+		token        token.Token
+		manifest     string
+		wantCode     int
+		wantWarning  bool
+		wantUpstream bool
+	}{
+		{
+			name:        "cached tag",
+			offline:     true,
+			manifest:    "latest",
+			wantCode:    http.StatusOK,
+			wantWarning: true,
+		},
+		{
+			name:        "cached tag with an offline token",
+			token:       token.Token{Attribute: token.Attribute{Offline: true}},
+			manifest:    "latest",
+			wantCode:    http.StatusOK,
+			wantWarning: true,
+		},
+		{
+			name:     "cached digest",
+			offline:  true,
+			manifest: manifestDigest,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "never seen",
+			offline:      true,
+			manifest:     digest.FromString("missing").String(),
+			wantUpstream: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewManifests(WithCache(c), WithClient(upstream.Client()), WithOffline(tt.offline))
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests.Store(0)
+
+			rw := httptest.NewRecorder()
+			m.Serve(rw, httptest.NewRequest(http.MethodGet, "/v2/library/busybox/manifests/"+tt.manifest, nil), &PathInfo{
+				Host:              host,
+				Image:             "library/busybox",
+				Manifests:         tt.manifest,
+				IsDigestManifests: strings.Contains(tt.manifest, ":"),
+			}, &tt.token)
+
+			if tt.wantCode != 0 && rw.Code != tt.wantCode {
+				t.Fatalf("Serve() = %d %s, want %d", rw.Code, rw.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode == 0 && rw.Code == http.StatusOK {
+				t.Fatalf("Serve() = %d, want an error", rw.Code)
+			}
+			if got := rw.Header().Get("Warning") != ""; got != tt.wantWarning {
+				t.Errorf("Warning = %q, want set %v", rw.Header().Get("Warning"), tt.wantWarning)
+			}
+			if got := requests.Load() != 0; got != tt.wantUpstream {
+				t.Errorf("upstream requests = %d, want any %v", requests.Load(), tt.wantUpstream)
+			}
+		})
+	}
+}
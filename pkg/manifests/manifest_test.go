@@ -0,0 +1,74 @@
+package manifests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/registrytest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/token"
+)
+
+func TestServeManifest(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	manifestDigest := registry.PutManifest("library/busybox", "latest", manifest)
+
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManifests(WithCache(c), WithClient(registry.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, ref string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		m.Serve(rw, httptest.NewRequest(method, "/v2/library/busybox/manifests/"+ref, nil), &PathInfo{
+			Host:              registry.Host(),
+			Image:             "library/busybox",
+			Manifests:         ref,
+			IsDigestManifests: strings.Contains(ref, ":"),
+		}, &token.Token{})
+		return rw
+	}
+
+	rw := serve(http.MethodGet, "latest")
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Serve() = %d %s, want %d", rw.Code, rw.Body.String(), http.StatusOK)
+	}
+	if got := rw.Header().Get("Docker-Content-Digest"); got != manifestDigest {
+		t.Errorf("Docker-Content-Digest = %q, want %q", got, manifestDigest)
+	}
+	if rw.Body.String() != string(manifest) {
+		t.Errorf("Serve() body = %s, want %s", rw.Body.String(), manifest)
+	}
+
+	_, _, _, err = c.GetManifestContent(ctx, registry.Host(), "library/busybox", "latest")
+	if err != nil {
+		t.Errorf("manifest not cached: %v", err)
+	}
+
+	// Served from the cache from now on.
+	requests := registry.Requests()
+	for _, ref := range []string{"latest", manifestDigest} {
+		rw = serve(http.MethodHead, ref)
+		if rw.Code != http.StatusOK {
+			t.Errorf("Serve(HEAD %s) = %d, want %d", ref, rw.Code, http.StatusOK)
+		}
+	}
+	if got := registry.Requests(); got != requests {
+		t.Errorf("upstream requests = %d, want %d", got, requests)
+	}
+
+	rw = serve(http.MethodGet, "missing")
+	if rw.Code == http.StatusOK {
+		t.Errorf("Serve(missing) = %d, want an error", rw.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "opencidn"
+
+var (
+	ManifestCacheTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "manifest",
+		Name:      "cache_total",
+		Help:      "Manifest cache lookups by phase and result.",
+	}, []string{"phase", "result"})
+
+	ManifestConvertedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "manifest",
+		Name:      "converted_total",
+		Help:      "Manifests served converted to the format accepted by the client, by converted media type.",
+	}, []string{"media_type"})
+
+	BlobCacheTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "cache_total",
+		Help:      "Blob cache lookups by phase and result.",
+	}, []string{"phase", "result"})
+
+	BlobServeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "serve_total",
+		Help:      "Cached blobs served by mode (redirect, big_redirect, direct).",
+	}, []string{"mode"})
+
+	BlobQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "queue_depth",
+		Help:      "Number of blobs waiting in each download group queue.",
+	}, []string{"group"})
+
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to upstream registries by host and status code.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"host", "code"})
+
+	RunnerSyncedBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runner",
+		Name:      "synced_bytes_total",
+		Help:      "Bytes synced from upstream by the runner.",
+	}, []string{"kind"})
+
+	RunnerHeartbeatFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runner",
+		Name:      "heartbeat_failures_total",
+		Help:      "Heartbeats the runner failed to deliver to the queue.",
+	})
+
+	RunnerPartialReplicasTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runner",
+		Name:      "partial_replicas_total",
+		Help:      "Blobs the runner wrote to only some of its storages.",
+	})
+
+	RunnerTagWatchSyncsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runner",
+		Name:      "tag_watch_syncs_total",
+		Help:      "Watched tags found with a new upstream digest and queued for a deep sync.",
+	})
+
+	QueueMessages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "messages",
+		Help:      "Queue messages by status.",
+	}, []string{"status"})
+
+	TokenRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "token_requests_total",
+		Help:      "Token requests by result.",
+	}, []string{"result"})
+
+	GCSweptBlobsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "swept_blobs_total",
+		Help:      "Unreferenced blobs deleted by garbage collection.",
+	})
+
+	GCSweptBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "swept_bytes_total",
+		Help:      "Bytes of unreferenced blobs deleted by garbage collection.",
+	})
+
+	BlobScrubbedBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "scrubbed_bytes_total",
+		Help:      "Bytes of stored blobs re-hashed by the scrubber.",
+	})
+
+	BlobCorruptedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "corrupted_total",
+		Help:      "Stored blobs found not matching their digest and quarantined.",
+	})
+
+	BlobUnreferencedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "unreferenced_total",
+		Help:      "Cached blobs denied under repositories not referencing them.",
+	})
+
+	BlobDedupSavedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "blob",
+		Name:      "dedup_saved_bytes",
+		Help:      "Bytes saved by sharing blobs across repositories, as of the last gc.",
+	})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Run serves the metrics endpoint on address until ctx is done.
+func Run(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return server.Run(ctx, address, mux, nil, "", "", "")
+}
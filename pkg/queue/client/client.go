@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"github.com/OpenCIDN/OpenCIDN/pkg/warmup"
 )
 
 type MessageRequest struct {
@@ -18,6 +20,8 @@ type MessageRequest struct {
 	Priority int    `json:"priority"`
 
 	Data model.MessageAttr `json:"data,omitempty"`
+
+	Renew bool `json:"renew,omitempty"`
 }
 
 type MessageResponse struct {
@@ -51,6 +55,16 @@ type CancelRequest struct {
 	Lease string `json:"lease"`
 }
 
+type WarmupRequest struct {
+	Images   []string `json:"images"`
+	Priority int      `json:"priority"`
+}
+
+type WarmupResponse struct {
+	Messages []MessageResponse `json:"messages"`
+	Progress warmup.Progress   `json:"progress"`
+}
+
 type MessageClient struct {
 	httpClient *http.Client
 	baseURL    string
@@ -66,7 +80,19 @@ func NewMessageClient(httpClient *http.Client, baseURL string, adminToken string
 }
 
 func (c *MessageClient) Create(ctx context.Context, content string, priority int, data model.MessageAttr) (MessageResponse, error) {
-	messageRequest := MessageRequest{Content: content, Priority: priority, Data: data}
+	return c.create(ctx, MessageRequest{Content: content, Priority: priority, Data: data})
+}
+
+// Renew is like Create, but replaces a completed or failed message with the
+// same content, so the content is processed again.
+func (c *MessageClient) Renew(ctx context.Context, content string, priority int, data model.MessageAttr) (MessageResponse, error) {
+	return c.create(ctx, MessageRequest{Content: content, Priority: priority, Data: data, Renew: true})
+}
+
+func (c *MessageClient) create(ctx context.Context, messageRequest MessageRequest) (MessageResponse, error) {
+	if messageRequest.Data.TraceParent == "" {
+		messageRequest.Data.TraceParent = tracing.TraceParent(ctx)
+	}
 	body, err := json.Marshal(messageRequest)
 	if err != nil {
 		return MessageResponse{}, err
@@ -80,6 +106,7 @@ func (c *MessageClient) Create(ctx context.Context, content string, priority int
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -99,6 +126,40 @@ func (c *MessageClient) Create(ctx context.Context, content string, priority int
 	return messageResponse, nil
 }
 
+func (c *MessageClient) Warmup(ctx context.Context, warmupRequest WarmupRequest) (WarmupResponse, error) {
+	body, err := json.Marshal(warmupRequest)
+	if err != nil {
+		return WarmupResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+"/warmup", bytes.NewBuffer(body))
+	if err != nil {
+		return WarmupResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return WarmupResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return WarmupResponse{}, handleErrorResponse(resp)
+	}
+
+	var warmupResponse WarmupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&warmupResponse); err != nil {
+		return WarmupResponse{}, err
+	}
+
+	return warmupResponse, nil
+}
+
 func (c *MessageClient) List(ctx context.Context) ([]MessageResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/messages", nil)
 	if err != nil {
@@ -107,6 +168,7 @@ func (c *MessageClient) List(ctx context.Context) ([]MessageResponse, error) {
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -135,6 +197,7 @@ func (c *MessageClient) WatchList(ctx context.Context) (chan MessageResponse, er
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -193,6 +256,7 @@ func (c *MessageClient) Get(ctx context.Context, messageID int64) (MessageRespon
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -220,6 +284,7 @@ func (c *MessageClient) Watch(ctx context.Context, messageID int64) (chan Messag
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -285,6 +350,7 @@ func (c *MessageClient) Consume(ctx context.Context, messageID int64, lease stri
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -318,6 +384,7 @@ func (c *MessageClient) Heartbeat(ctx context.Context, messageID int64, heartbea
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -346,6 +413,7 @@ func (c *MessageClient) Complete(ctx context.Context, messageID int64, completed
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -374,6 +442,7 @@ func (c *MessageClient) Failed(ctx context.Context, messageID int64, failedReque
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -402,6 +471,7 @@ func (c *MessageClient) Cancel(ctx context.Context, messageID int64, cancelReque
 	if c.adminToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.adminToken)
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+)
+
+type TagWatchRequest struct {
+	Repository string             `json:"repository"`
+	Spec       model.TagWatchSpec `json:"spec"`
+}
+
+type TagWatchResponse struct {
+	TagWatchID int64                `json:"id"`
+	Repository string               `json:"repository"`
+	Spec       model.TagWatchSpec   `json:"spec"`
+	Status     model.TagWatchStatus `json:"status"`
+}
+
+type TagWatchStatusRequest struct {
+	Status model.TagWatchStatus `json:"status"`
+}
+
+func (c *MessageClient) CreateTagWatch(ctx context.Context, tagWatchRequest TagWatchRequest) (TagWatchResponse, error) {
+	body, err := json.Marshal(tagWatchRequest)
+	if err != nil {
+		return TagWatchResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+"/tagwatches", bytes.NewBuffer(body))
+	if err != nil {
+		return TagWatchResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return TagWatchResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return TagWatchResponse{}, handleErrorResponse(resp)
+	}
+
+	var tagWatchResponse TagWatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tagWatchResponse); err != nil {
+		return TagWatchResponse{}, err
+	}
+
+	return tagWatchResponse, nil
+}
+
+func (c *MessageClient) ListTagWatches(ctx context.Context) ([]TagWatchResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/tagwatches", nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleErrorResponse(resp)
+	}
+
+	var tagWatches []TagWatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tagWatches); err != nil {
+		return nil, err
+	}
+
+	return tagWatches, nil
+}
+
+func (c *MessageClient) UpdateTagWatchStatus(ctx context.Context, tagWatchID int64, statusRequest TagWatchStatusRequest) error {
+	body, err := json.Marshal(statusRequest)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.baseURL+"/tagwatches/"+strconv.FormatInt(tagWatchID, 10)+"/status", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return handleErrorResponse(resp)
+	}
+
+	return nil
+}
+
+func (c *MessageClient) DeleteTagWatch(ctx context.Context, tagWatchID int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/tagwatches/"+strconv.FormatInt(tagWatchID, 10), nil)
+	if err != nil {
+		return err
+	}
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return handleErrorResponse(resp)
+	}
+
+	return nil
+}
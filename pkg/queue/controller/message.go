@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/service"
 	"github.com/emicklei/go-restful/v3"
@@ -21,6 +22,10 @@ type MessageRequest struct {
 	Priority int    `json:"priority"`
 
 	Data model.MessageAttr `json:"data,omitempty"`
+
+	// Renew replaces a completed or failed message with the same content
+	// by a new one, instead of returning it.
+	Renew bool `json:"renew,omitempty"`
 }
 
 type MessageResponse struct {
@@ -157,6 +162,16 @@ func (mc *MessageController) RegisterRoutes(ws *restful.WebService) {
 		Returns(http.StatusCreated, "Message created successfully.", MessageResponse{}).
 		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
 
+	ws.Route(ws.PUT("/warmup").To(mc.Warmup).
+		Doc("Create deep manifest messages fetching images and all their blobs.").
+		Operation("warmup").
+		Produces(restful.MIME_JSON).
+		Consumes(restful.MIME_JSON, "text/plain", "application/yaml").
+		Reads(WarmupRequest{}).
+		Writes(WarmupResponse{}).
+		Returns(http.StatusOK, "Messages created successfully.", WarmupResponse{}).
+		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
+
 	ws.Route(ws.GET("/messages").To(mc.List).
 		Doc("List all messages.").
 		Operation("listMessages").
@@ -290,6 +305,15 @@ func (mc *MessageController) Schedule(ctx context.Context, logger *slog.Logger)
 			if err != nil {
 				logger.Error("CleanUp", "error", err)
 			}
+
+			counts, err := mc.messageService.CountByStatus(ctx)
+			if err != nil {
+				logger.Error("CountByStatus", "error", err)
+			} else {
+				for _, status := range []model.MessageStatus{model.StatusPending, model.StatusProcessing, model.StatusCompleted, model.StatusFailed} {
+					metrics.QueueMessages.WithLabelValues(status.String()).Set(float64(counts[status]))
+				}
+			}
 		}
 	}
 }
@@ -301,7 +325,25 @@ func (mc *MessageController) Create(req *restful.Request, resp *restful.Response
 		return
 	}
 
-	message, err := mc.messageService.GetByContent(req.Request.Context(), messageRequest.Content)
+	data, status, err := mc.create(req.Request.Context(), messageRequest)
+	if err != nil {
+		resp.WriteHeaderAndEntity(status, *err)
+		return
+	}
+	resp.WriteHeaderAndEntity(status, data)
+}
+
+// create returns the message with the same content if there is one, raising
+// its priority while it is pending, or creates it.
+func (mc *MessageController) create(ctx context.Context, messageRequest MessageRequest) (MessageResponse, int, *Error) {
+	message, err := mc.messageService.GetByContent(ctx, messageRequest.Content)
+	if err == nil && messageRequest.Renew &&
+		(message.Status == model.StatusCompleted || message.Status == model.StatusFailed) {
+		if err := mc.messageService.DeleteByID(ctx, message.MessageID); err != nil {
+			return MessageResponse{}, http.StatusInternalServerError, &Error{Code: "MessageDeleteError", Message: "Failed to renew message: " + err.Error()}
+		}
+		err = sql.ErrNoRows
+	}
 	if err == nil {
 		data := MessageResponse{
 			MessageID:     message.MessageID,
@@ -313,20 +355,17 @@ func (mc *MessageController) Create(req *restful.Request, resp *restful.Response
 		}
 
 		if message.Status == model.StatusPending && messageRequest.Priority > message.Priority {
-			if err := mc.messageService.UpdatePriorityByID(req.Request.Context(), message.MessageID, messageRequest.Priority); err != nil {
-				resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "MessageUpdateError", Message: "Failed to update message priority: " + err.Error()})
-				return
+			if err := mc.messageService.UpdatePriorityByID(ctx, message.MessageID, messageRequest.Priority); err != nil {
+				return MessageResponse{}, http.StatusInternalServerError, &Error{Code: "MessageUpdateError", Message: "Failed to update message priority: " + err.Error()}
 			}
 			data.Priority = messageRequest.Priority
 			mc.appendWatchListChannels(data)
 		}
-		resp.WriteHeaderAndEntity(http.StatusOK, data)
-		return
+		return data, http.StatusOK, nil
 	}
 
 	if !errors.Is(err, sql.ErrNoRows) {
-		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "MessageRetrievalError", Message: "Failed to retrieve message: " + err.Error()})
-		return
+		return MessageResponse{}, http.StatusInternalServerError, &Error{Code: "MessageRetrievalError", Message: "Failed to retrieve message: " + err.Error()}
 	}
 
 	newMessage := model.Message{
@@ -334,10 +373,9 @@ func (mc *MessageController) Create(req *restful.Request, resp *restful.Response
 		Priority: messageRequest.Priority,
 		Data:     messageRequest.Data,
 	}
-	messageID, err := mc.messageService.Create(req.Request.Context(), newMessage)
+	messageID, err := mc.messageService.Create(ctx, newMessage)
 	if err != nil {
-		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "MessageCreationError", Message: "Failed to create message: " + err.Error()})
-		return
+		return MessageResponse{}, http.StatusInternalServerError, &Error{Code: "MessageCreationError", Message: "Failed to create message: " + err.Error()}
 	}
 
 	data := MessageResponse{
@@ -348,7 +386,7 @@ func (mc *MessageController) Create(req *restful.Request, resp *restful.Response
 	}
 
 	mc.appendWatchListChannels(data)
-	resp.WriteHeaderAndEntity(http.StatusCreated, data)
+	return data, http.StatusCreated, nil
 }
 
 func (mc *MessageController) List(req *restful.Request, resp *restful.Response) {
@@ -589,6 +627,8 @@ func (mc *MessageController) Complete(req *restful.Request, resp *restful.Respon
 	mc.appendWatchChannel(messageID, data)
 	mc.appendWatchListChannels(data)
 
+	mc.followDeep(req.Request.Context(), curr)
+
 	resp.WriteHeader(http.StatusNoContent)
 }
 
@@ -635,6 +675,8 @@ func (mc *MessageController) Failed(req *restful.Request, resp *restful.Response
 	mc.appendWatchChannel(messageID, data)
 	mc.appendWatchListChannels(data)
 
+	mc.followDeep(req.Request.Context(), curr)
+
 	resp.WriteHeader(http.StatusNoContent)
 }
 
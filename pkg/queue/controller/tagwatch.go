@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/service"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tagwatch"
+	"github.com/OpenCIDN/OpenCIDN/pkg/warmup"
+	"github.com/emicklei/go-restful/v3"
+)
+
+type TagWatchRequest struct {
+	Repository string             `json:"repository"`
+	Spec       model.TagWatchSpec `json:"spec"`
+}
+
+type TagWatchResponse struct {
+	TagWatchID int64                `json:"id"`
+	Repository string               `json:"repository"`
+	Spec       model.TagWatchSpec   `json:"spec"`
+	Status     model.TagWatchStatus `json:"status"`
+}
+
+type TagWatchStatusRequest struct {
+	Status model.TagWatchStatus `json:"status"`
+}
+
+type TagWatchController struct {
+	tagWatchService *service.TagWatchService
+}
+
+func NewTagWatchController(tagWatchService *service.TagWatchService) *TagWatchController {
+	return &TagWatchController{
+		tagWatchService: tagWatchService,
+	}
+}
+
+func (tc *TagWatchController) RegisterRoutes(ws *restful.WebService) {
+	ws.Route(ws.PUT("/tagwatches").To(tc.Create).
+		Doc("Create a new tag watch.").
+		Operation("createTagWatch").
+		Produces(restful.MIME_JSON).
+		Consumes(restful.MIME_JSON).
+		Reads(TagWatchRequest{}).
+		Writes(TagWatchResponse{}).
+		Returns(http.StatusCreated, "Tag watch created successfully.", TagWatchResponse{}).
+		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
+
+	ws.Route(ws.GET("/tagwatches").To(tc.List).
+		Doc("List all tag watches.").
+		Operation("listTagWatches").
+		Produces(restful.MIME_JSON).
+		Writes([]TagWatchResponse{}).
+		Returns(http.StatusOK, "Tag watches retrieved successfully.", []TagWatchResponse{}).
+		Returns(http.StatusInternalServerError, "Failed to retrieve tag watches.", Error{}))
+
+	ws.Route(ws.GET("/tagwatches/{tag_watch_id}").To(tc.Get).
+		Doc("Retrieve a tag watch by ID.").
+		Operation("getTagWatch").
+		Param(ws.PathParameter("tag_watch_id", "tag watch ID").DataType("integer")).
+		Produces(restful.MIME_JSON).
+		Writes(TagWatchResponse{}).
+		Returns(http.StatusOK, "Tag watch found.", TagWatchResponse{}).
+		Returns(http.StatusNotFound, "Tag watch not found.", Error{}).
+		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
+
+	ws.Route(ws.PATCH("/tagwatches/{tag_watch_id}").To(tc.Update).
+		Doc("Update the spec of a tag watch by ID.").
+		Operation("updateTagWatch").
+		Produces(restful.MIME_JSON).
+		Consumes(restful.MIME_JSON).
+		Param(ws.PathParameter("tag_watch_id", "tag watch ID").DataType("integer")).
+		Reads(TagWatchRequest{}).
+		Writes(TagWatchResponse{}).
+		Returns(http.StatusOK, "Tag watch updated successfully.", TagWatchResponse{}).
+		Returns(http.StatusNotFound, "Tag watch not found.", Error{}).
+		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
+
+	ws.Route(ws.PATCH("/tagwatches/{tag_watch_id}/status").To(tc.UpdateStatus).
+		Doc("Set the status of a tag watch by ID.").
+		Operation("updateTagWatchStatus").
+		Produces(restful.MIME_JSON).
+		Consumes(restful.MIME_JSON).
+		Param(ws.PathParameter("tag_watch_id", "tag watch ID").DataType("integer")).
+		Reads(TagWatchStatusRequest{}).
+		Writes(Error{}).
+		Returns(http.StatusNoContent, "Tag watch status updated successfully.", nil).
+		Returns(http.StatusNotFound, "Tag watch not found.", Error{}).
+		Returns(http.StatusBadRequest, "Invalid request format.", Error{}))
+
+	ws.Route(ws.DELETE("/tagwatches/{tag_watch_id}").To(tc.Delete).
+		Doc("Delete a tag watch by ID.").
+		Operation("deleteTagWatch").
+		Param(ws.PathParameter("tag_watch_id", "tag watch ID").DataType("integer")).
+		Writes(Error{}).
+		Returns(http.StatusNoContent, "Tag watch deleted successfully.", nil).
+		Returns(http.StatusNotFound, "Tag watch not found.", Error{}))
+}
+
+func validateTagWatch(tagWatchRequest *TagWatchRequest) *Error {
+	ref, err := warmup.ParseReference(tagWatchRequest.Repository)
+	if err != nil {
+		return &Error{Code: "TagWatchRequestError", Message: err.Error()}
+	}
+	tagWatchRequest.Repository = ref.Host + "/" + ref.Image
+
+	_, err = tagwatch.NewMatcher(tagWatchRequest.Spec.Tags)
+	if err != nil {
+		return &Error{Code: "TagWatchRequestError", Message: err.Error()}
+	}
+
+	if tagWatchRequest.Spec.Interval != "" {
+		interval, err := time.ParseDuration(tagWatchRequest.Spec.Interval)
+		if err != nil || interval < time.Minute {
+			return &Error{Code: "TagWatchRequestError", Message: "Interval must be a duration of at least 1m."}
+		}
+	}
+	return nil
+}
+
+func (tc *TagWatchController) Create(req *restful.Request, resp *restful.Response) {
+	var tagWatchRequest TagWatchRequest
+	if err := req.ReadEntity(&tagWatchRequest); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "TagWatchRequestError", Message: "Failed to read tag watch request: " + err.Error()})
+		return
+	}
+
+	if err := validateTagWatch(&tagWatchRequest); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, *err)
+		return
+	}
+
+	tagWatchID, err := tc.tagWatchService.Create(req.Request.Context(), model.TagWatch{
+		Repository: tagWatchRequest.Repository,
+		Spec:       tagWatchRequest.Spec,
+	})
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "TagWatchCreationError", Message: "Failed to create tag watch: " + err.Error()})
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusCreated, TagWatchResponse{
+		TagWatchID: tagWatchID,
+		Repository: tagWatchRequest.Repository,
+		Spec:       tagWatchRequest.Spec,
+	})
+}
+
+func (tc *TagWatchController) List(req *restful.Request, resp *restful.Response) {
+	tagWatches, err := tc.tagWatchService.List(req.Request.Context())
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "TagWatchListError", Message: "Failed to retrieve tag watches: " + err.Error()})
+		return
+	}
+
+	tagWatchResponses := make([]TagWatchResponse, 0, len(tagWatches))
+	for _, tagWatch := range tagWatches {
+		tagWatchResponses = append(tagWatchResponses, TagWatchResponse{
+			TagWatchID: tagWatch.TagWatchID,
+			Repository: tagWatch.Repository,
+			Spec:       tagWatch.Spec,
+			Status:     tagWatch.Status,
+		})
+	}
+	resp.WriteHeaderAndEntity(http.StatusOK, tagWatchResponses)
+}
+
+func (tc *TagWatchController) Get(req *restful.Request, resp *restful.Response) {
+	tagWatchID, err := strconv.ParseInt(req.PathParameter("tag_watch_id"), 10, 64)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "InvalidIDError", Message: "Invalid tag watch ID: " + err.Error()})
+		return
+	}
+
+	tagWatch, err := tc.tagWatchService.GetByID(req.Request.Context(), tagWatchID)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, Error{Code: "TagWatchNotFoundError", Message: "Tag watch not found: " + err.Error()})
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, TagWatchResponse{
+		TagWatchID: tagWatch.TagWatchID,
+		Repository: tagWatch.Repository,
+		Spec:       tagWatch.Spec,
+		Status:     tagWatch.Status,
+	})
+}
+
+func (tc *TagWatchController) Update(req *restful.Request, resp *restful.Response) {
+	tagWatchID, err := strconv.ParseInt(req.PathParameter("tag_watch_id"), 10, 64)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "InvalidIDError", Message: "Invalid tag watch ID: " + err.Error()})
+		return
+	}
+
+	var tagWatchRequest TagWatchRequest
+	if err := req.ReadEntity(&tagWatchRequest); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "TagWatchRequestError", Message: "Failed to read tag watch request: " + err.Error()})
+		return
+	}
+
+	tagWatch, err := tc.tagWatchService.GetByID(req.Request.Context(), tagWatchID)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, Error{Code: "TagWatchNotFoundError", Message: "Tag watch not found: " + err.Error()})
+		return
+	}
+
+	// The repository of a watch is fixed, its digests belong to it.
+	tagWatchRequest.Repository = tagWatch.Repository
+	if err := validateTagWatch(&tagWatchRequest); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, *err)
+		return
+	}
+
+	err = tc.tagWatchService.UpdateSpecByID(req.Request.Context(), tagWatchID, tagWatchRequest.Spec)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "TagWatchUpdateError", Message: "Failed to update tag watch: " + err.Error()})
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, TagWatchResponse{
+		TagWatchID: tagWatch.TagWatchID,
+		Repository: tagWatch.Repository,
+		Spec:       tagWatchRequest.Spec,
+		Status:     tagWatch.Status,
+	})
+}
+
+func (tc *TagWatchController) UpdateStatus(req *restful.Request, resp *restful.Response) {
+	tagWatchID, err := strconv.ParseInt(req.PathParameter("tag_watch_id"), 10, 64)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "InvalidIDError", Message: "Invalid tag watch ID: " + err.Error()})
+		return
+	}
+
+	var statusRequest TagWatchStatusRequest
+	if err := req.ReadEntity(&statusRequest); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "TagWatchStatusRequestError", Message: "Failed to read tag watch status request: " + err.Error()})
+		return
+	}
+
+	_, err = tc.tagWatchService.GetByID(req.Request.Context(), tagWatchID)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, Error{Code: "TagWatchNotFoundError", Message: "Tag watch not found: " + err.Error()})
+		return
+	}
+
+	err = tc.tagWatchService.UpdateStatusByID(req.Request.Context(), tagWatchID, statusRequest.Status)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, Error{Code: "TagWatchUpdateError", Message: "Failed to update tag watch status: " + err.Error()})
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (tc *TagWatchController) Delete(req *restful.Request, resp *restful.Response) {
+	tagWatchID, err := strconv.ParseInt(req.PathParameter("tag_watch_id"), 10, 64)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "InvalidIDError", Message: "Invalid tag watch ID: " + err.Error()})
+		return
+	}
+
+	err = tc.tagWatchService.DeleteByID(req.Request.Context(), tagWatchID)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, Error{Code: "TagWatchNotFoundError", Message: "Tag watch not found: " + err.Error()})
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
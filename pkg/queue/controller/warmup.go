@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/warmup"
+	"github.com/emicklei/go-restful/v3"
+)
+
+type WarmupRequest struct {
+	Images   []string `json:"images"`
+	Priority int      `json:"priority"`
+}
+
+type WarmupResponse struct {
+	Messages []MessageResponse `json:"messages"`
+	Progress warmup.Progress   `json:"progress"`
+}
+
+// Warmup creates a deep manifest message for every image, so runners fetch
+// the images with all their blobs before any client pulls them. Besides
+// JSON, the body may be a plain list of images or Kubernetes manifests.
+func (mc *MessageController) Warmup(req *restful.Request, resp *restful.Response) {
+	var warmupRequest WarmupRequest
+	if strings.HasPrefix(req.Request.Header.Get("Content-Type"), restful.MIME_JSON) {
+		if err := req.ReadEntity(&warmupRequest); err != nil {
+			resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "WarmupRequestError", Message: "Failed to read warmup request: " + err.Error()})
+			return
+		}
+	} else {
+		images, err := warmup.ParseImages(io.LimitReader(req.Request.Body, 4<<20))
+		if err != nil {
+			resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "WarmupRequestError", Message: "Failed to read warmup request: " + err.Error()})
+			return
+		}
+		warmupRequest.Images = images
+	}
+
+	if len(warmupRequest.Images) == 0 {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "WarmupRequestError", Message: "Images cannot be empty."})
+		return
+	}
+
+	refs := make([]warmup.Reference, 0, len(warmupRequest.Images))
+	for _, image := range warmupRequest.Images {
+		ref, err := warmup.ParseReference(image)
+		if err != nil {
+			resp.WriteHeaderAndEntity(http.StatusBadRequest, Error{Code: "WarmupRequestError", Message: err.Error()})
+			return
+		}
+		refs = append(refs, ref)
+	}
+
+	var warmupResponse WarmupResponse
+	for _, ref := range refs {
+		data, status, err := mc.createDeep(req.Request.Context(), MessageRequest{
+			Content:  ref.String(),
+			Priority: warmupRequest.Priority,
+			Data: model.MessageAttr{
+				Kind:  model.KindManifest,
+				Host:  ref.Host,
+				Image: ref.Image,
+				Deep:  true,
+			},
+		})
+		if err != nil {
+			resp.WriteHeaderAndEntity(status, *err)
+			return
+		}
+		warmupResponse.Messages = append(warmupResponse.Messages, data)
+		warmupResponse.Progress.Add(data.Status, data.Data)
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, warmupResponse)
+}
+
+// createDeep creates a deep message, making sure a deep sync follows when
+// the message with the same content is finished or shallow: a finished one
+// is renewed, a pending shallow one is made deep and a processing shallow
+// one is flagged to be followed by a deep message once finished.
+func (mc *MessageController) createDeep(ctx context.Context, messageRequest MessageRequest) (MessageResponse, int, *Error) {
+	messageRequest.Data.Deep = true
+	messageRequest.Renew = true
+	data, status, err := mc.create(ctx, messageRequest)
+	if err != nil || data.Data.Deep {
+		return data, status, err
+	}
+
+	if mc.messageService.Deepen(ctx, data.MessageID) == nil {
+		data.Status = model.StatusPending
+		data.Data.Deep = true
+		mc.appendWatchChannel(data.MessageID, data)
+		mc.appendWatchListChannels(data)
+		return data, status, nil
+	}
+	if mc.messageService.FollowDeep(ctx, data.MessageID) == nil {
+		data.Status = model.StatusProcessing
+		data.Data.FollowDeep = true
+		return data, status, nil
+	}
+
+	// It finished meanwhile.
+	return mc.create(ctx, messageRequest)
+}
+
+// followDeep creates the deep message requested while the finished message
+// was processed shallow.
+func (mc *MessageController) followDeep(ctx context.Context, message model.Message) {
+	if !message.Data.FollowDeep {
+		return
+	}
+	_, _, err := mc.create(ctx, MessageRequest{
+		Content:  message.Content,
+		Priority: message.Priority,
+		Data: model.MessageAttr{
+			Kind:     message.Data.Kind,
+			Host:     message.Data.Host,
+			Image:    message.Data.Image,
+			Deep:     true,
+			Referrer: message.Data.Referrer,
+		},
+		Renew: true,
+	})
+	if err != nil {
+		slog.Warn("failed to create deep message", "content", message.Content, "error", err.Message)
+	}
+}
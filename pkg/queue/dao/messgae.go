@@ -111,6 +111,30 @@ func (m *Message) UpdatePriorityByID(ctx context.Context, id int64, priority int
 	return nil
 }
 
+const setDataFlagByIDSQL = `
+UPDATE messages SET data = JSON_SET(data, ?, true) WHERE id = ? AND status = ? AND delete_at IS NULL
+`
+
+// Deepen makes a pending message a deep one.
+func (m *Message) Deepen(ctx context.Context, id int64) (int64, error) {
+	db := GetDB(ctx)
+	results, err := db.ExecContext(ctx, setDataFlagByIDSQL, "$.deep", id, model.StatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deepen message: %w", err)
+	}
+	return results.RowsAffected()
+}
+
+// FollowDeep flags a processing message to be followed by a deep one.
+func (m *Message) FollowDeep(ctx context.Context, id int64) (int64, error) {
+	db := GetDB(ctx)
+	results, err := db.ExecContext(ctx, setDataFlagByIDSQL, "$.followDeep", id, model.StatusProcessing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set follow deep: %w", err)
+	}
+	return results.RowsAffected()
+}
+
 const deleteMessageByIDSQL = `
 UPDATE messages SET delete_at = NOW() WHERE id = ? AND delete_at IS NULL
 `
@@ -152,6 +176,35 @@ func (m *Message) List(ctx context.Context) ([]model.Message, error) {
 	return messages, nil
 }
 
+const countByStatusSQL = `
+SELECT status, COUNT(*) FROM messages WHERE delete_at IS NULL GROUP BY status
+`
+
+func (m *Message) CountByStatus(ctx context.Context) (map[model.MessageStatus]int64, error) {
+	db := GetDB(ctx)
+	rows, err := db.QueryContext(ctx, countByStatusSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[model.MessageStatus]int64{}
+	for rows.Next() {
+		var status model.MessageStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan message count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return counts, nil
+}
+
 const cleanUpSQL = `
 DELETE FROM messages WHERE delete_at IS NOT NULL AND delete_at < NOW() - INTERVAL 8 HOUR
 `
@@ -239,8 +292,12 @@ func (m *Message) Consume(ctx context.Context, id int64, lease string) (int64, e
 	return results.RowsAffected()
 }
 
+// followDeepPatch keeps the followDeep flag of the stored data when the
+// data is replaced, it may be set while the message is processed.
+const followDeepPatch = `JSON_MERGE_PATCH(?, JSON_OBJECT('followDeep', JSON_EXTRACT(data, '$.followDeep')))`
+
 const heartbeatSQL = `
-UPDATE messages SET last_heartbeat = NOW(), data = ? WHERE id = ? AND lease = ? AND status = ? AND delete_at IS NULL
+UPDATE messages SET last_heartbeat = NOW(), data = ` + followDeepPatch + ` WHERE id = ? AND lease = ? AND status = ? AND delete_at IS NULL
 `
 
 func (m *Message) Heartbeat(ctx context.Context, id int64, data model.MessageAttr, lease string) (int64, error) {
@@ -266,7 +323,7 @@ func (m *Message) Complete(ctx context.Context, id int64, lease string) (int64,
 }
 
 const setFailedSQL = `
-UPDATE messages SET status = ?, lease = ?, data = ? WHERE id = ? AND lease = ? AND status = ? AND delete_at IS NULL
+UPDATE messages SET status = ?, lease = ?, data = ` + followDeepPatch + ` WHERE id = ? AND lease = ? AND status = ? AND delete_at IS NULL
 `
 
 func (m *Message) Failed(ctx context.Context, id int64, lease string, data model.MessageAttr) (int64, error) {
@@ -0,0 +1,133 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+)
+
+type TagWatch struct{}
+
+func NewTagWatch() *TagWatch {
+	return &TagWatch{}
+}
+
+const tagWatchTableSQL = `
+CREATE TABLE IF NOT EXISTS tag_watches (
+    id SERIAL PRIMARY KEY,
+    repository VARCHAR(255) NOT NULL,
+    spec JSON NOT NULL,
+    status JSON NOT NULL,
+    create_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    delete_at TIMESTAMP
+) ENGINE=InnoDB AUTO_INCREMENT=10000 CHARSET=utf8mb4;
+`
+
+func (w *TagWatch) InitTable(ctx context.Context) error {
+	db := GetDB(ctx)
+	_, err := db.ExecContext(ctx, tagWatchTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create tag_watches table: %w", err)
+	}
+	return nil
+}
+
+const createTagWatchSQL = `
+INSERT INTO tag_watches (repository, spec, status) VALUES (?, ?, ?)
+`
+
+func (w *TagWatch) Create(ctx context.Context, tagWatch model.TagWatch) (int64, error) {
+	db := GetDB(ctx)
+	result, err := db.ExecContext(ctx, createTagWatchSQL, tagWatch.Repository, tagWatch.Spec, tagWatch.Status)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create tag watch: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+const getTagWatchByIDSQL = `
+SELECT id, repository, spec, status FROM tag_watches WHERE id = ? AND delete_at IS NULL
+`
+
+func (w *TagWatch) GetByID(ctx context.Context, id int64) (model.TagWatch, error) {
+	db := GetDB(ctx)
+	var tagWatch model.TagWatch
+	err := db.QueryRowContext(ctx, getTagWatchByIDSQL, id).Scan(&tagWatch.TagWatchID, &tagWatch.Repository, &tagWatch.Spec, &tagWatch.Status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return model.TagWatch{}, fmt.Errorf("tag watch not found: %w", err)
+		}
+		return model.TagWatch{}, fmt.Errorf("failed to get tag watch: %w", err)
+	}
+	return tagWatch, nil
+}
+
+const updateTagWatchSpecByIDSQL = `
+UPDATE tag_watches SET spec = ? WHERE id = ? AND delete_at IS NULL
+`
+
+func (w *TagWatch) UpdateSpecByID(ctx context.Context, id int64, spec model.TagWatchSpec) error {
+	db := GetDB(ctx)
+	_, err := db.ExecContext(ctx, updateTagWatchSpecByIDSQL, spec, id)
+	if err != nil {
+		return fmt.Errorf("failed to update tag watch spec: %w", err)
+	}
+	return nil
+}
+
+const updateTagWatchStatusByIDSQL = `
+UPDATE tag_watches SET status = ? WHERE id = ? AND delete_at IS NULL
+`
+
+func (w *TagWatch) UpdateStatusByID(ctx context.Context, id int64, status model.TagWatchStatus) error {
+	db := GetDB(ctx)
+	_, err := db.ExecContext(ctx, updateTagWatchStatusByIDSQL, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update tag watch status: %w", err)
+	}
+	return nil
+}
+
+const deleteTagWatchByIDSQL = `
+UPDATE tag_watches SET delete_at = NOW() WHERE id = ? AND delete_at IS NULL
+`
+
+func (w *TagWatch) DeleteByID(ctx context.Context, id int64) (int64, error) {
+	db := GetDB(ctx)
+	result, err := db.ExecContext(ctx, deleteTagWatchByIDSQL, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tag watch: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+const getTagWatchesSQL = `
+SELECT id, repository, spec, status FROM tag_watches WHERE delete_at IS NULL
+`
+
+func (w *TagWatch) List(ctx context.Context) ([]model.TagWatch, error) {
+	db := GetDB(ctx)
+	rows, err := db.QueryContext(ctx, getTagWatchesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tag watches: %w", err)
+	}
+	defer rows.Close()
+
+	var tagWatches []model.TagWatch
+	for rows.Next() {
+		var tagWatch model.TagWatch
+		if err := rows.Scan(&tagWatch.TagWatchID, &tagWatch.Repository, &tagWatch.Spec, &tagWatch.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan tag watch: %w", err)
+		}
+		tagWatches = append(tagWatches, tagWatch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred during rows iteration: %w", err)
+	}
+
+	return tagWatches, nil
+}
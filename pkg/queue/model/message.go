@@ -2,6 +2,7 @@ package model
 
 import (
 	"database/sql/driver"
+	"strconv"
 	"time"
 )
 
@@ -15,6 +16,22 @@ const (
 	StatusCleanup    MessageStatus = 90
 )
 
+func (s MessageStatus) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusProcessing:
+		return "processing"
+	case StatusCompleted:
+		return "completed"
+	case StatusFailed:
+		return "failed"
+	case StatusCleanup:
+		return "cleanup"
+	}
+	return strconv.FormatUint(uint64(s), 10)
+}
+
 type Message struct {
 	MessageID     int64
 	Content       string
@@ -40,7 +57,18 @@ type MessageAttr struct {
 	Progress int64  `json:"progress,omitempty"`
 	Size     int64  `json:"size,omitempty"`
 
+	Replicas       int `json:"replicas,omitempty"`
+	FailedReplicas int `json:"failedReplicas,omitempty"`
+
 	Deep bool `json:"deep,omitempty"`
+	// Referrer is set on the syncs of referrers, which do not follow
+	// referrers of their own.
+	Referrer bool `json:"referrer,omitempty"`
+	// FollowDeep is set on a shallow message a deep sync is requested for
+	// while it is processed, the deep message is created once it finished.
+	FollowDeep bool `json:"followDeep,omitempty"`
+
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 func (n *MessageAttr) Scan(value any) error {
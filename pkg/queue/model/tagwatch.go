@@ -0,0 +1,56 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// TagWatch is a repository whose tags are checked upstream periodically,
+// new digests are synced deeply into the cache.
+type TagWatch struct {
+	TagWatchID int64
+	Repository string
+	Spec       TagWatchSpec
+	Status     TagWatchStatus
+}
+
+type TagWatchSpec struct {
+	// Tags are globs like "1.*" or semver ranges like ">=1.25 <2" or "^3.19",
+	// a tag matching any of them is watched.
+	Tags []string `json:"tags"`
+
+	// Interval between checks, like "1h".
+	Interval string `json:"interval,omitempty"`
+
+	Priority int `json:"priority,omitempty"`
+}
+
+type TagWatchStatus struct {
+	Digests   map[string]string `json:"digests,omitempty"`
+	LastCheck time.Time         `json:"lastCheck,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func (n *TagWatchSpec) Scan(value any) error {
+	if value == nil {
+		return nil
+	}
+	*n = unmarshal[TagWatchSpec](asString(value))
+	return nil
+}
+
+func (n TagWatchSpec) Value() (driver.Value, error) {
+	return marshal(n), nil
+}
+
+func (n *TagWatchStatus) Scan(value any) error {
+	if value == nil {
+		return nil
+	}
+	*n = unmarshal[TagWatchStatus](asString(value))
+	return nil
+}
+
+func (n TagWatchStatus) Value() (driver.Value, error) {
+	return marshal(n), nil
+}
@@ -19,11 +19,14 @@ type QueueManager struct {
 	adminToken string
 	db         *sql.DB
 
-	MessageDAO *dao.Message
+	MessageDAO  *dao.Message
+	TagWatchDAO *dao.TagWatch
 
-	MessageService *service.MessageService
+	MessageService  *service.MessageService
+	TagWatchService *service.TagWatchService
 
-	MessageController *controller.MessageController
+	MessageController  *controller.MessageController
+	TagWatchController *controller.TagWatchController
 
 	allowAnonymousRead bool
 }
@@ -40,13 +43,18 @@ func NewQueueManager(adminToken string, allowAnonymousRead bool, db *sql.DB) *Qu
 func (m *QueueManager) InitTable(ctx context.Context) {
 	ctx = dao.WithDB(ctx, m.db)
 	m.MessageDAO.InitTable(ctx)
+	m.TagWatchDAO.InitTable(ctx)
 }
 
 func (m *QueueManager) Register(container *restful.Container) {
 	m.MessageDAO = dao.NewMessage()
+	m.TagWatchDAO = dao.NewTagWatch()
 
 	m.MessageService = service.NewMessageService(m.db, m.MessageDAO)
+	m.TagWatchService = service.NewTagWatchService(m.db, m.TagWatchDAO)
+
 	m.MessageController = controller.NewMessageController(m.MessageService)
+	m.TagWatchController = controller.NewTagWatchController(m.TagWatchService)
 
 	ws := new(restful.WebService)
 	ws.Path("/apis/v1/")
@@ -74,6 +82,7 @@ func (m *QueueManager) Register(container *restful.Container) {
 		})
 	}
 	m.MessageController.RegisterRoutes(ws)
+	m.TagWatchController.RegisterRoutes(ws)
 
 	container.Add(ws)
 
@@ -46,6 +46,30 @@ func (s *MessageService) UpdatePriorityByID(ctx context.Context, id int64, prior
 	return s.messageDao.UpdatePriorityByID(ctx, id, priority)
 }
 
+func (s *MessageService) Deepen(ctx context.Context, id int64) error {
+	ctx = dao.WithDB(ctx, s.db)
+	rowsAffected, err := s.messageDao.Deepen(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows affected when deepening message with id %d", id)
+	}
+	return nil
+}
+
+func (s *MessageService) FollowDeep(ctx context.Context, id int64) error {
+	ctx = dao.WithDB(ctx, s.db)
+	rowsAffected, err := s.messageDao.FollowDeep(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows affected when following message with id %d", id)
+	}
+	return nil
+}
+
 func (s *MessageService) DeleteByID(ctx context.Context, id int64) error {
 	ctx = dao.WithDB(ctx, s.db)
 	return s.messageDao.DeleteByID(ctx, id)
@@ -118,6 +142,11 @@ func (s *MessageService) Cancel(ctx context.Context, id int64, lease string) err
 	return nil
 }
 
+func (s *MessageService) CountByStatus(ctx context.Context) (map[model.MessageStatus]int64, error) {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.messageDao.CountByStatus(ctx)
+}
+
 func (s *MessageService) CleanUp(ctx context.Context) error {
 	ctx = dao.WithDB(ctx, s.db)
 	return s.messageDao.CleanUp(ctx)
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/dao"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+)
+
+type TagWatchService struct {
+	db          *sql.DB
+	tagWatchDao *dao.TagWatch
+}
+
+func NewTagWatchService(db *sql.DB, tagWatchDao *dao.TagWatch) *TagWatchService {
+	return &TagWatchService{
+		db:          db,
+		tagWatchDao: tagWatchDao,
+	}
+}
+
+func (s *TagWatchService) Create(ctx context.Context, tagWatch model.TagWatch) (int64, error) {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.tagWatchDao.Create(ctx, tagWatch)
+}
+
+func (s *TagWatchService) GetByID(ctx context.Context, id int64) (model.TagWatch, error) {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.tagWatchDao.GetByID(ctx, id)
+}
+
+func (s *TagWatchService) List(ctx context.Context) ([]model.TagWatch, error) {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.tagWatchDao.List(ctx)
+}
+
+func (s *TagWatchService) UpdateSpecByID(ctx context.Context, id int64, spec model.TagWatchSpec) error {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.tagWatchDao.UpdateSpecByID(ctx, id, spec)
+}
+
+func (s *TagWatchService) UpdateStatusByID(ctx context.Context, id int64, status model.TagWatchStatus) error {
+	ctx = dao.WithDB(ctx, s.db)
+	return s.tagWatchDao.UpdateStatusByID(ctx, id, status)
+}
+
+func (s *TagWatchService) DeleteByID(ctx context.Context, id int64) error {
+	ctx = dao.WithDB(ctx, s.db)
+	rowsAffected, err := s.tagWatchDao.DeleteByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no rows affected when deleting tag watch with id %d", id)
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/sets"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+)
+
+const (
+	KindBlob     = "blob"
+	KindRevision = "revision"
+	KindTag      = "tag"
+)
+
+// Replica compares caches expected to hold the same content, like the
+// storages a runner writes to, and copies what one of them is missing.
+type Replica struct {
+	caches []*cache.Cache
+	logger *slog.Logger
+}
+
+type Option func(r *Replica)
+
+// WithCaches sets the replicas, they are identified by their position in
+// the reports.
+func WithCaches(caches ...*cache.Cache) Option {
+	return func(r *Replica) {
+		r.caches = caches
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Replica) {
+		r.logger = logger
+	}
+}
+
+func NewReplica(opts ...Option) (*Replica, error) {
+	r := &Replica{
+		logger: slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if len(r.caches) < 2 {
+		return nil, fmt.Errorf("at least two caches must be provided")
+	}
+	return r, nil
+}
+
+// Divergence is an object not the same on every replica.
+type Divergence struct {
+	Kind string `json:"kind"`
+	// Name is the digest of a blob, "host/image@digest" for a revision or
+	// "host/image:tag" for a tag.
+	Name string `json:"name"`
+	// Expected is the size of a blob or the digest a tag points to, as held
+	// by the Source replica.
+	Expected string `json:"expected,omitempty"`
+	Source   int    `json:"source"`
+
+	Missing    []int `json:"missing,omitempty"`
+	Mismatched []int `json:"mismatched,omitempty"`
+
+	Repaired bool   `json:"repaired,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report summarizes one verification over the replicas.
+type Report struct {
+	Blobs     int `json:"blobs"`
+	Revisions int `json:"revisions"`
+	Tags      int `json:"tags"`
+
+	Divergent []Divergence `json:"divergent,omitempty"`
+	Repaired  int          `json:"repaired,omitempty"`
+	Failed    int          `json:"failed,omitempty"`
+}
+
+type tagLink struct {
+	digest   string
+	resolved time.Time
+}
+
+// inventory is the content of one replica.
+type inventory struct {
+	blobs     map[string]int64
+	revisions *sets.Set[string]
+	tags      map[string]tagLink
+}
+
+func (r *Replica) inventory(ctx context.Context, c *cache.Cache) (*inventory, error) {
+	inv := &inventory{
+		blobs:     map[string]int64{},
+		revisions: sets.NewSet[string](),
+		tags:      map[string]tagLink{},
+	}
+
+	err := c.WalkBlobs(ctx, func(blob string, info fs.FileInfo) bool {
+		inv.blobs[blob] = info.Size()
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk blobs: %w", err)
+	}
+
+	err = c.WalkManifestRevisions(ctx, func(repo, blob string) bool {
+		inv.revisions.Add(repo + "@" + blob)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk manifest revisions: %w", err)
+	}
+
+	type tagInfo struct {
+		repo, tag string
+		resolved  time.Time
+	}
+	var tags []tagInfo
+	err = c.WalkManifestTags(ctx, func(repo, tag string, info fs.FileInfo) bool {
+		tags = append(tags, tagInfo{repo, tag, info.ModTime()})
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk manifest tags: %w", err)
+	}
+	for _, t := range tags {
+		host, image, ok := strings.Cut(t.repo, "/")
+		if !ok {
+			continue
+		}
+		digest, err := c.DigestManifest(ctx, host, image, t.tag)
+		if err != nil {
+			r.logger.Warn("failed to get tag digest", "repo", t.repo, "tag", t.tag, "error", err)
+			continue
+		}
+		inv.tags[t.repo+":"+t.tag] = tagLink{
+			digest:   digest,
+			resolved: t.resolved,
+		}
+	}
+	return inv, nil
+}
+
+// Verify compares the blobs, manifest revisions and tags of the replicas.
+func (r *Replica) Verify(ctx context.Context) (*Report, error) {
+	invs := make([]*inventory, 0, len(r.caches))
+	for i, c := range r.caches {
+		inv, err := r.inventory(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("storage %d: %w", i, err)
+		}
+		invs = append(invs, inv)
+	}
+	return compare(invs), nil
+}
+
+// Repair verifies the replicas and copies every divergent object from its
+// source replica to the replicas missing it or holding another version.
+func (r *Replica) Repair(ctx context.Context) (*Report, error) {
+	report, err := r.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Divergent {
+		d := &report.Divergent[i]
+		err := r.repair(ctx, d)
+		if err != nil {
+			r.logger.Error("failed to repair", "kind", d.Kind, "name", d.Name, "error", err)
+			d.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		r.logger.Info("repaired", "kind", d.Kind, "name", d.Name, "source", d.Source, "missing", d.Missing, "mismatched", d.Mismatched)
+		d.Repaired = true
+		report.Repaired++
+	}
+	return report, nil
+}
+
+func (r *Replica) repair(ctx context.Context, d *Divergence) error {
+	src := r.caches[d.Source]
+	var errs []error
+	targets := append(append([]int{}, d.Missing...), d.Mismatched...)
+	for _, i := range targets {
+		dst := r.caches[i]
+		var err error
+		switch d.Kind {
+		case KindBlob:
+			err = copyBlob(ctx, src, dst, d.Name)
+		case KindRevision:
+			err = copyRevision(ctx, src, dst, d.Name)
+		case KindTag:
+			err = copyTag(ctx, src, dst, d.Name, d.Expected)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("storage %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func copyBlob(ctx context.Context, src, dst *cache.Cache, blob string) error {
+	r, err := src.GetBlob(ctx, blob)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// PutBlob checks the digest, a corrupted source is never replicated.
+	_, err = dst.PutBlob(ctx, blob, r)
+	return err
+}
+
+func copyRevision(ctx context.Context, src, dst *cache.Cache, name string) error {
+	repo, digest, _ := strings.Cut(name, "@")
+	host, image, _ := strings.Cut(repo, "/")
+	content, _, _, err := src.GetManifestContent(ctx, host, image, digest)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = dst.PutManifestContent(ctx, host, image, digest, content)
+	return err
+}
+
+func copyTag(ctx context.Context, src, dst *cache.Cache, name, digest string) error {
+	i := strings.LastIndex(name, ":")
+	repo, tag := name[:i], name[i+1:]
+	host, image, _ := strings.Cut(repo, "/")
+	if _, err := dst.StatBlob(ctx, digest); err != nil {
+		err = copyBlob(ctx, src, dst, digest)
+		if err != nil {
+			return err
+		}
+	}
+	return dst.RelinkManifest(ctx, host, image, tag, digest)
+}
+
+func compare(invs []*inventory) *Report {
+	report := &Report{}
+
+	blobs := sets.NewSet[string]()
+	revisions := sets.NewSet[string]()
+	tags := sets.NewSet[string]()
+	for _, inv := range invs {
+		for blob := range inv.blobs {
+			blobs.Add(blob)
+		}
+		revisions.Add(inv.revisions.List()...)
+		for tag := range inv.tags {
+			tags.Add(tag)
+		}
+	}
+	report.Blobs = blobs.Size()
+	report.Revisions = revisions.Size()
+	report.Tags = tags.Size()
+
+	for _, blob := range sorted(blobs) {
+		counts := map[int64]int{}
+		for _, inv := range invs {
+			if size, ok := inv.blobs[blob]; ok {
+				counts[size]++
+			}
+		}
+		// Trust the size most replicas agree on, then the largest since a
+		// diverged copy is usually a truncated one.
+		var expected int64 = -1
+		for size, n := range counts {
+			if expected < 0 || n > counts[expected] || (n == counts[expected] && size > expected) {
+				expected = size
+			}
+		}
+
+		d := Divergence{
+			Kind:     KindBlob,
+			Name:     blob,
+			Expected: fmt.Sprint(expected),
+			Source:   -1,
+		}
+		for i, inv := range invs {
+			size, ok := inv.blobs[blob]
+			switch {
+			case !ok:
+				d.Missing = append(d.Missing, i)
+			case size != expected:
+				d.Mismatched = append(d.Mismatched, i)
+			case d.Source < 0:
+				d.Source = i
+			}
+		}
+		if len(d.Missing) != 0 || len(d.Mismatched) != 0 {
+			report.Divergent = append(report.Divergent, d)
+		}
+	}
+
+	for _, rev := range sorted(revisions) {
+		d := Divergence{
+			Kind:   KindRevision,
+			Name:   rev,
+			Source: -1,
+		}
+		for i, inv := range invs {
+			switch {
+			case !inv.revisions.Contains(rev):
+				d.Missing = append(d.Missing, i)
+			case d.Source < 0:
+				d.Source = i
+			}
+		}
+		if len(d.Missing) != 0 {
+			report.Divergent = append(report.Divergent, d)
+		}
+	}
+
+	for _, tag := range sorted(tags) {
+		// The most recently resolved link is the current one.
+		d := Divergence{
+			Kind:   KindTag,
+			Name:   tag,
+			Source: -1,
+		}
+		var latest time.Time
+		for i, inv := range invs {
+			link, ok := inv.tags[tag]
+			if ok && (d.Source < 0 || link.resolved.After(latest)) {
+				d.Source = i
+				d.Expected = link.digest
+				latest = link.resolved
+			}
+		}
+		for i, inv := range invs {
+			link, ok := inv.tags[tag]
+			switch {
+			case !ok:
+				d.Missing = append(d.Missing, i)
+			case link.digest != d.Expected:
+				d.Mismatched = append(d.Mismatched, i)
+			}
+		}
+		if len(d.Missing) != 0 || len(d.Mismatched) != 0 {
+			report.Divergent = append(report.Divergent, d)
+		}
+	}
+
+	return report
+}
+
+func sorted(s *sets.Set[string]) []string {
+	list := s.List()
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,84 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+)
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+
+	var caches []*cache.Cache
+	for i := 0; i < 3; i++ {
+		c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		caches = append(caches, c)
+	}
+
+	layer := []byte("layer")
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+
+	for _, c := range caches[:2] {
+		_, err := c.PutBlob(ctx, layerDigest, bytes.NewReader(layer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, err = c.PutManifestContent(ctx, "docker.io", "library/busybox", "latest", manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A truncated copy left by a failed write.
+	err := caches[2].PutContent(ctx, "/docker/registry/v2/blobs/sha256/"+layerDigest[7:9]+"/"+layerDigest[7:]+"/data", layer[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReplica(WithCaches(caches...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := r.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Divergence{}
+	for _, d := range report.Divergent {
+		got[d.Kind+" "+d.Name] = d
+	}
+	if d := got[KindBlob+" "+layerDigest]; len(d.Mismatched) != 1 || d.Mismatched[0] != 2 {
+		t.Errorf("layer divergence = %+v, want mismatched on storage 2", d)
+	}
+	if d := got[KindTag+" docker.io/library/busybox:latest"]; len(d.Missing) != 1 || d.Missing[0] != 2 {
+		t.Errorf("tag divergence = %+v, want missing on storage 2", d)
+	}
+	if len(report.Divergent) != 4 {
+		t.Errorf("divergent = %+v, want layer, manifest blob, revision and tag", report.Divergent)
+	}
+
+	report, err = r.Repair(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 0 || report.Repaired != len(report.Divergent) {
+		t.Errorf("repair = %+v, want all repaired", report)
+	}
+
+	report, err = r.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Divergent) != 0 {
+		t.Errorf("divergent after repair = %+v, want none", report.Divergent)
+	}
+}
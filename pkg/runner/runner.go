@@ -7,14 +7,17 @@ import (
 	"log/slog"
 	"math/rand/v2"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/internal/spec"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 )
 
 type Runner struct {
@@ -38,6 +41,12 @@ type Runner struct {
 
 	filterPlatform func(pf spec.Platform) bool
 
+	rateLimits *transport.RateLimits
+
+	tagWatchInterval time.Duration
+
+	referrers bool
+
 	logger *slog.Logger
 }
 
@@ -92,6 +101,12 @@ func WithManifestCache(cache *cache.Cache) Option {
 	}
 }
 
+func WithRateLimits(rateLimits *transport.RateLimits) Option {
+	return func(c *Runner) {
+		c.rateLimits = rateLimits
+	}
+}
+
 func WithResumeSize(resumeSize int) Option {
 	return func(c *Runner) {
 		c.resumeSize = resumeSize
@@ -154,6 +169,10 @@ func (r *Runner) sync(ctx context.Context) {
 
 	go r.watch(watchCtx)
 
+	if r.tagWatchInterval > 0 {
+		go r.runTagWatch(ctx)
+	}
+
 	wg := sync.WaitGroup{}
 
 	wg.Add(4)
@@ -224,6 +243,30 @@ func (r *Runner) runWatch(ctx context.Context) error {
 
 var errWait = fmt.Errorf("no message received and no errors occurred")
 
+// rateLimited reports whether work for host is held back until its upstream quota recovers.
+// Messages are left pending however long that takes, instead of failing on the 429.
+func (r *Runner) rateLimited(host string) bool {
+	return r.rateLimits != nil && !r.rateLimits.Until(host).IsZero()
+}
+
+// isRateLimited reports whether err is the upstream, or the transport for an
+// exhausted host, answering 429.
+func isRateLimited(err error) bool {
+	return strings.Contains(err.Error(), "status code 429")
+}
+
+// rateLimitRetry fires when the earliest rate limited host becomes available again.
+func (r *Runner) rateLimitRetry() <-chan time.Time {
+	if r.rateLimits == nil {
+		return nil
+	}
+	next := r.rateLimits.Next()
+	if next.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(next))
+}
+
 func (r *Runner) heartbeat(ctx context.Context, messageID int64, gotSize, progress *atomic.Int64, errCh chan error) error {
 	ticker := time.NewTicker(time.Millisecond * time.Duration(100+rand.Int32N(900)))
 	defer ticker.Stop()
@@ -250,6 +293,7 @@ func (r *Runner) heartbeat(ctx context.Context, messageID int64, gotSize, progre
 			})
 
 			if err != nil {
+				metrics.RunnerHeartbeatFailuresTotal.Inc()
 				r.logger.Error("Heartbeat", "error", err)
 			}
 
@@ -268,7 +312,28 @@ func (r *Runner) heartbeat(ctx context.Context, messageID int64, gotSize, progre
 				})
 			}
 
-			if errors.Is(err, context.Canceled) {
+			var partial *partialReplicaError
+			if errors.As(err, &partial) {
+				metrics.RunnerPartialReplicasTotal.Inc()
+				r.logger.Warn("partial replica", "messageID", messageID, "error", err)
+				_ = r.queueClient.Heartbeat(ctx, messageID, client.HeartbeatRequest{
+					Lease: r.lease,
+					Data: model.MessageAttr{
+						Size:           gotSize.Load(),
+						Progress:       progress.Load(),
+						Error:          err.Error(),
+						Replicas:       partial.replicas,
+						FailedReplicas: partial.failed,
+					},
+				})
+				return r.queueClient.Complete(ctx, messageID, client.CompletedRequest{
+					Lease: r.lease,
+				})
+			}
+
+			// Rate limited messages go back to pending, they are held back
+			// until the quota of their host recovers.
+			if errors.Is(err, context.Canceled) || (r.rateLimits != nil && isRateLimited(err)) {
 				err0 := r.queueClient.Cancel(ctx, messageID, client.CancelRequest{
 					Lease: r.lease,
 				})
@@ -14,10 +14,13 @@ import (
 	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
 	"github.com/wzshiming/httpseek"
-	"github.com/wzshiming/sss"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (r *Runner) runBlobSync(ctx context.Context) {
@@ -34,6 +37,7 @@ func (r *Runner) runBlobSync(ctx context.Context) {
 			} else {
 				select {
 				case <-r.syncBlobCh:
+				case <-r.rateLimitRetry():
 				case <-ctx.Done():
 					return
 				}
@@ -48,7 +52,7 @@ func (r *Runner) getBlobPending() []client.MessageResponse {
 
 	var pendingMessages []client.MessageResponse
 	for _, msg := range r.blobPending {
-		if msg.Status == model.StatusPending {
+		if msg.Status == model.StatusPending && !r.rateLimited(msg.Data.Host) {
 			pendingMessages = append(pendingMessages, msg)
 		}
 	}
@@ -160,7 +164,7 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 	if r.resumeSize != 0 && size > int64(r.resumeSize) {
 		var offset int64 = math.MaxInt
 
-		rbws := []sss.FileWriter{}
+		rbws := []storage.FileWriter{}
 		for _, cache := range subCaches {
 			f, err := cache.BlobWriter(ctx, blob, true)
 			if err == nil {
@@ -231,14 +235,19 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 		}
 
 		var errs []error
-		for _, c := range rbws {
+		failed := make([]bool, len(subCaches))
+		for i, c := range rbws {
 			err := c.Commit(ctx)
 			if err != nil {
 				errs = append(errs, err)
+				failed[i] = true
 			}
 		}
 
-		for _, cache := range subCaches {
+		for i, cache := range subCaches {
+			if failed[i] {
+				continue
+			}
 			fi, err := cache.StatBlob(ctx, blob)
 			if err != nil {
 				errs = append(errs, err)
@@ -254,7 +263,7 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 			}
 		}
 
-		return errors.Join(errs...)
+		return replicaErrors(len(caches), errs)
 	}
 
 	resp, err := r.httpClient.Do(req)
@@ -283,7 +292,7 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 	if len(subCaches) == 1 {
 		n, err := subCaches[0].PutBlob(ctx, blob, body)
 		if err != nil {
-			return fmt.Errorf("put blob failed: %w", err)
+			return replicaErrors(len(caches), []error{fmt.Errorf("put blob failed: %w", err)})
 		}
 
 		r.logger.Info("finish sync blob", "digest", blob, "size", n)
@@ -293,6 +302,8 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 	var writers []io.Writer
 	var closers []io.Closer
 	var wg sync.WaitGroup
+	var errsMut sync.Mutex
+	var errs []error
 
 	for _, ca := range subCaches {
 		pr, pw := io.Pipe()
@@ -304,6 +315,9 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 			_, err := cache.PutBlob(ctx, blob, pr)
 			if err != nil {
 				r.logger.Error("put blob failed", "digest", blob, "error", err)
+				errsMut.Lock()
+				errs = append(errs, fmt.Errorf("put blob failed: %w", err))
+				errsMut.Unlock()
 				io.Copy(io.Discard, pr)
 				return
 			}
@@ -320,11 +334,57 @@ func (r *Runner) blob(ctx context.Context, host, name, blob string, size int64,
 
 	wg.Wait()
 
+	if len(errs) != 0 {
+		return replicaErrors(len(caches), errs)
+	}
+
 	r.logger.Info("finish sync blob", "digest", blob, "size", n)
 	return nil
 }
 
-func (r *Runner) blobSync(ctx context.Context, resp client.MessageResponse) error {
+// partialReplicaError reports a blob stored by some of the caches only, the
+// message completes and the other caches are left to repair.
+type partialReplicaError struct {
+	replicas int
+	failed   int
+	err      error
+}
+
+func (e *partialReplicaError) Error() string {
+	return fmt.Sprintf("%d of %d replicas failed: %v", e.failed, e.replicas, e.err)
+}
+
+func (e *partialReplicaError) Unwrap() error {
+	return e.err
+}
+
+// replicaErrors joins the errors of writing a blob to replicas caches, as a
+// partialReplicaError when at least one of them holds the blob.
+func replicaErrors(replicas int, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	if len(errs) >= replicas {
+		return err
+	}
+	return &partialReplicaError{
+		replicas: replicas,
+		failed:   len(errs),
+		err:      err,
+	}
+}
+
+func (r *Runner) blobSync(ctx context.Context, resp client.MessageResponse) (err error) {
+	ctx, span := tracing.Start(tracing.WithTraceParent(ctx, resp.Data.TraceParent), "runner.blobSync",
+		attribute.Int64("message.id", resp.MessageID),
+		attribute.String("message.content", resp.Content),
+		attribute.Int64("blob.size", resp.Data.Size),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	var errCh = make(chan error, 1)
 
 	var gotSize, progress atomic.Int64
@@ -341,10 +401,13 @@ type readerCounter struct {
 	counter *atomic.Int64
 }
 
+var syncedBlobBytes = metrics.RunnerSyncedBytesTotal.WithLabelValues(model.KindBlob)
+
 func (r *readerCounter) Read(b []byte) (int, error) {
 	n, err := r.r.Read(b)
 
 	r.counter.Add(int64(n))
+	syncedBlobBytes.Add(float64(n))
 	return n, err
 }
 
@@ -16,8 +16,12 @@ import (
 
 	"github.com/OpenCIDN/OpenCIDN/internal/spec"
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
 	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (r *Runner) runManifestSync(ctx context.Context, deep bool) {
@@ -34,6 +38,7 @@ func (r *Runner) runManifestSync(ctx context.Context, deep bool) {
 			} else {
 				select {
 				case <-r.syncManifestCh:
+				case <-r.rateLimitRetry():
 				case <-ctx.Done():
 					return
 				}
@@ -48,7 +53,7 @@ func (r *Runner) getManifestPending(deep bool) []client.MessageResponse {
 
 	var pendingMessages []client.MessageResponse
 	for _, msg := range r.manifestPending {
-		if msg.Status == model.StatusPending && msg.Data.Deep == deep {
+		if msg.Status == model.StatusPending && msg.Data.Deep == deep && !r.rateLimited(msg.Data.Host) {
 			pendingMessages = append(pendingMessages, msg)
 		}
 	}
@@ -97,7 +102,16 @@ func (r *Runner) runOnceManifestSync(ctx context.Context, deep bool) error {
 	return r.manifestSync(ctx, resp)
 }
 
-func (r *Runner) manifestSync(ctx context.Context, resp client.MessageResponse) error {
+func (r *Runner) manifestSync(ctx context.Context, resp client.MessageResponse) (err error) {
+	ctx, span := tracing.Start(tracing.WithTraceParent(ctx, resp.Data.TraceParent), "runner.manifestSync",
+		attribute.Int64("message.id", resp.MessageID),
+		attribute.String("message.content", resp.Content),
+		attribute.Bool("message.deep", resp.Data.Deep),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	var fullImage string
 	var tagOrBlob string
 	if i := strings.Index(resp.Content, "@"); i > 0 {
@@ -132,7 +146,7 @@ func (r *Runner) manifestSync(ctx context.Context, resp client.MessageResponse)
 	var errCh = make(chan error, 1)
 	var gotSize, progress atomic.Int64
 	go func() {
-		errCh <- r.manifest(ctx, resp.MessageID, host, image, tagOrBlob, resp.Data.Deep, resp.Priority, &gotSize, &progress)
+		errCh <- r.manifest(ctx, resp.MessageID, host, image, tagOrBlob, resp.Data.Deep, r.referrers && !resp.Data.Referrer, resp.Priority, &gotSize, &progress)
 	}()
 
 	return r.heartbeat(ctx, resp.MessageID, &gotSize, &progress, errCh)
@@ -140,7 +154,7 @@ func (r *Runner) manifestSync(ctx context.Context, resp client.MessageResponse)
 
 var acceptsStr = "application/vnd.oci.image.index.v1+json,application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.oci.image.manifest.v1+json,application/vnd.docker.distribution.manifest.v2+json"
 
-func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tagOrBlob string, deep bool, priority int, gotSize, progress *atomic.Int64) error {
+func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tagOrBlob string, deep, referrers bool, priority int, gotSize, progress *atomic.Int64) error {
 
 	u := &url.URL{
 		Scheme: "https",
@@ -158,7 +172,7 @@ func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tag
 
 	var subCaches []*cache.Cache
 
-	if strings.HasPrefix(tagOrBlob, "sha256:") {
+	if strings.Contains(tagOrBlob, ":") {
 		for _, cache := range caches {
 			exist, _ := cache.StatManifest(ctx, host, image, tagOrBlob)
 			if !exist {
@@ -209,29 +223,38 @@ func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tag
 		}
 	}
 
+	var body []byte
 	if len(subCaches) == 0 {
-		r.logger.Info("skip manifest by cache", "host", host, "image", image, "tagOrBlob", tagOrBlob)
-		return nil
+		if !deep {
+			r.logger.Info("skip manifest by cache", "host", host, "image", image, "tagOrBlob", tagOrBlob)
+			return nil
+		}
+		// A manifest cached by a shallow sync may miss its blobs, queue them
+		// from the cached manifest.
+		body, _, _, _ = caches[0].GetManifestContent(ctx, host, image, tagOrBlob)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", acceptsStr)
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	if body == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", acceptsStr)
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to get manifest: status code %d", resp.StatusCode)
-	}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to get manifest: status code %d", resp.StatusCode)
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		metrics.RunnerSyncedBytesTotal.WithLabelValues(model.KindManifest).Add(float64(len(body)))
 	}
 
 	_ = r.queueClient.Heartbeat(ctx, messageID, client.HeartbeatRequest{
@@ -307,16 +330,23 @@ func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tag
 					r.logger.Error("PutManifest", "error", err)
 				}
 			}
+
+			if referrers {
+				r.syncReferrers(ctx, host, image, manifestDigest(tagOrBlob, body), priority)
+			}
 			return nil
 		}
 	}
 	{
 		m := spec.ManifestLayers{}
 		json.Unmarshal(body, &m)
-		if len(m.Layers) != 0 {
+		// Artifacts like signatures may keep their content in blobs, or only
+		// in the config.
+		layers := append(m.Layers, m.Blobs...)
+		if len(layers) != 0 || m.Config.Digest != "" {
 			wg := sync.WaitGroup{}
 
-			for _, l := range m.Layers {
+			for _, l := range layers {
 				gotSize.Add(l.Size)
 
 				r.logger.Info("Create blob", "msg", l.Digest)
@@ -348,35 +378,35 @@ func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tag
 				}()
 			}
 
-			l := m.Config
-
-			gotSize.Add(l.Size)
+			if l := m.Config; l.Digest != "" {
+				gotSize.Add(l.Size)
 
-			r.logger.Info("Create config blob", "msg", l.Digest)
-			mr, err := r.queueClient.Create(ctx, l.Digest, priority, model.MessageAttr{
-				Kind:  model.KindBlob,
-				Host:  host,
-				Image: image,
-				Size:  l.Size,
-			})
-			if err != nil {
-				return err
-			}
-			mrCh, err := r.queueClient.Watch(ctx, mr.MessageID)
-			if err != nil {
-				return err
-			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				var prevProgress int64
-				for m := range mrCh {
-					progress.Add(m.Data.Progress - prevProgress)
-					prevProgress = m.Data.Progress
+				r.logger.Info("Create config blob", "msg", l.Digest)
+				mr, err := r.queueClient.Create(ctx, l.Digest, priority, model.MessageAttr{
+					Kind:  model.KindBlob,
+					Host:  host,
+					Image: image,
+					Size:  l.Size,
+				})
+				if err != nil {
+					return err
 				}
+				mrCh, err := r.queueClient.Watch(ctx, mr.MessageID)
+				if err != nil {
+					return err
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var prevProgress int64
+					for m := range mrCh {
+						progress.Add(m.Data.Progress - prevProgress)
+						prevProgress = m.Data.Progress
+					}
 
-				progress.Add(l.Size - prevProgress)
-			}()
+					progress.Add(l.Size - prevProgress)
+				}()
+			}
 
 			wg.Wait()
 
@@ -387,9 +417,21 @@ func (r *Runner) manifest(ctx context.Context, messageID int64, host, image, tag
 				}
 			}
 
+			if referrers {
+				r.syncReferrers(ctx, host, image, manifestDigest(tagOrBlob, body), priority)
+			}
 			return nil
 		}
 	}
 
 	return fmt.Errorf("failed to sync manifest content: no valid manifest layers found")
 }
+
+// manifestDigest returns the digest of the manifest content fetched by the tag
+// or digest.
+func manifestDigest(tagOrBlob string, body []byte) string {
+	if strings.Contains(tagOrBlob, ":") {
+		return tagOrBlob
+	}
+	return digest.FromBytes(body).String()
+}
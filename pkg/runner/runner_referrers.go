@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"context"
+	"strings"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/spec"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+)
+
+// cosignTagSuffixes are the tags cosign attaches signatures, attestations
+// and SBOMs with on registries without the referrers API, like
+// sha256-<hex>.sig.
+var cosignTagSuffixes = []string{".sig", ".att", ".sbom"}
+
+// WithReferrers makes deep syncs follow the referrers of the manifests, like
+// signatures, SBOMs and attestations, so they travel with the images.
+func WithReferrers(referrers bool) Option {
+	return func(r *Runner) {
+		r.referrers = referrers
+	}
+}
+
+// syncReferrers queues deep syncs of the referrers of the manifest. They are
+// not waited for, a missing signature does not fail its image.
+func (r *Runner) syncReferrers(ctx context.Context, host, image, manifestDigest string, priority int) {
+	if r.rateLimited(host) {
+		r.logger.Info("skip referrers by rate limit", "host", host, "image", image, "digest", manifestDigest)
+		return
+	}
+
+	var contents []string
+
+	referrers, _, err := spec.Referrers(ctx, r.httpClient, host, image, manifestDigest, "")
+	if err != nil {
+		r.logger.Warn("list referrers", "host", host, "image", image, "digest", manifestDigest, "error", err)
+	}
+	for _, d := range referrers {
+		contents = append(contents, host+"/"+image+"@"+d.Digest)
+	}
+
+	tagPrefix := strings.Replace(manifestDigest, ":", "-", 1)
+	for _, suffix := range cosignTagSuffixes {
+		if r.rateLimited(host) {
+			break
+		}
+		tag := tagPrefix + suffix
+		_, err := r.headDigest(ctx, host, image, tag)
+		if err != nil {
+			continue
+		}
+		// The tag itself is synced, cosign looks the signatures up by it.
+		contents = append(contents, host+"/"+image+":"+tag)
+	}
+
+	for _, content := range contents {
+		r.logger.Info("Create referrer manifest", "msg", content)
+		_, err := r.queueClient.Create(ctx, content, priority, model.MessageAttr{
+			Kind:     model.KindManifest,
+			Host:     host,
+			Image:    image,
+			Deep:     true,
+			Referrer: true,
+		})
+		if err != nil {
+			r.logger.Warn("failed to queue referrer", "content", content, "error", err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tagwatch"
+)
+
+const defaultTagWatchInterval = time.Hour
+
+// WithTagWatchInterval checks the tag watches of the queue at this interval,
+// queueing a deep sync of every watched tag whose upstream digest changed.
+// Only one runner needs it.
+func WithTagWatchInterval(tagWatchInterval time.Duration) Option {
+	return func(r *Runner) {
+		r.tagWatchInterval = tagWatchInterval
+	}
+}
+
+func (r *Runner) runTagWatch(ctx context.Context) {
+	for {
+		tagWatches, err := r.queueClient.ListTagWatches(ctx)
+		if err != nil {
+			r.logger.Warn("failed to list tag watches", "error", err)
+		}
+		for _, tw := range tagWatches {
+			if ctx.Err() != nil {
+				return
+			}
+			r.checkTagWatch(ctx, tw)
+		}
+
+		select {
+		case <-time.After(r.tagWatchInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkTagWatch heads the watched tags upstream once the interval of the
+// watch passed, and records their digests.
+func (r *Runner) checkTagWatch(ctx context.Context, tw client.TagWatchResponse) {
+	interval := defaultTagWatchInterval
+	if tw.Spec.Interval != "" {
+		if d, err := time.ParseDuration(tw.Spec.Interval); err == nil {
+			interval = d
+		}
+	}
+	if time.Since(tw.Status.LastCheck) < interval {
+		return
+	}
+
+	host, image, ok := strings.Cut(tw.Repository, "/")
+	if !ok {
+		return
+	}
+	if r.rateLimited(host) {
+		return
+	}
+
+	status := model.TagWatchStatus{
+		Digests:   map[string]string{},
+		LastCheck: time.Now(),
+	}
+	err := r.syncTagWatch(ctx, host, image, tw, status.Digests)
+	if err != nil {
+		r.logger.Warn("failed to check tag watch", "repository", tw.Repository, "error", err)
+		status.Error = err.Error()
+	}
+	if err != nil {
+		// Keep the digests of the tags not checked yet.
+		for tag, digest := range tw.Status.Digests {
+			if _, ok := status.Digests[tag]; !ok {
+				status.Digests[tag] = digest
+			}
+		}
+	}
+
+	err = r.queueClient.UpdateTagWatchStatus(ctx, tw.TagWatchID, client.TagWatchStatusRequest{
+		Status: status,
+	})
+	if err != nil {
+		r.logger.Warn("failed to update tag watch status", "repository", tw.Repository, "error", err)
+	}
+}
+
+func (r *Runner) syncTagWatch(ctx context.Context, host, image string, tw client.TagWatchResponse, digests map[string]string) error {
+	matcher, err := tagwatch.NewMatcher(tw.Spec.Tags)
+	if err != nil {
+		return err
+	}
+
+	tags, ok := matcher.Literals()
+	if !ok {
+		all, err := r.listTags(ctx, host, image)
+		if err != nil {
+			return err
+		}
+		tags = tags[:0]
+		for _, tag := range all {
+			if matcher.Match(tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	// A tag failing keeps its previous digest, so it is retried next time.
+	var errs []error
+	for _, tag := range tags {
+		digest, err := r.headDigest(ctx, host, image, tag)
+		if err != nil {
+			r.logger.Warn("failed to head watched tag", "repository", tw.Repository, "tag", tag, "error", err)
+			errs = append(errs, fmt.Errorf("head %s: %w", tag, err))
+			continue
+		}
+		if tw.Status.Digests[tag] != digest {
+			err = r.queueTagSync(ctx, host, image, tag, digest, tw.Spec.Priority)
+			if err != nil {
+				r.logger.Warn("failed to queue watched tag", "repository", tw.Repository, "tag", tag, "error", err)
+				errs = append(errs, err)
+				continue
+			}
+		}
+		digests[tag] = digest
+	}
+	return errors.Join(errs...)
+}
+
+// queueTagSync queues a deep sync of the tag. A finished or shallow message of
+// the same tag is returned as is, the digest is synced instead then and the tag
+// is relinked on the next pull.
+func (r *Runner) queueTagSync(ctx context.Context, host, image, tag, digest string, priority int) error {
+	attr := model.MessageAttr{
+		Kind:  model.KindManifest,
+		Host:  host,
+		Image: image,
+		Deep:  true,
+	}
+	content := host + "/" + image + ":" + tag
+	mr, err := r.queueClient.Create(ctx, content, priority, attr)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s: %w", content, err)
+	}
+	if !mr.Data.Deep || mr.Status == model.StatusCompleted || mr.Status == model.StatusFailed {
+		content = host + "/" + image + "@" + digest
+		_, err = r.queueClient.Create(ctx, content, priority, attr)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s: %w", content, err)
+		}
+	}
+
+	metrics.RunnerTagWatchSyncsTotal.Inc()
+	r.logger.Info("queue watched tag", "content", content, "digest", digest)
+	return nil
+}
+
+func (r *Runner) headDigest(ctx context.Context, host, image, tag string) (string, error) {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   fmt.Sprintf("/v2/%s/manifests/%s", image, tag),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", acceptsStr)
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to head manifest: status code %d", resp.StatusCode)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("missing Docker-Content-Digest")
+	}
+	return digest, nil
+}
+
+// listTags lists the tags of the repository upstream, following the pages
+// of the Link header.
+func (r *Runner) listTags(ctx context.Context, host, image string) ([]string, error) {
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     fmt.Sprintf("/v2/%s/tags/list", image),
+		RawQuery: "n=1000",
+	}
+
+	var tags []string
+	for u != nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list tags: status code %d", resp.StatusCode)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tags: %w", err)
+		}
+		tags = append(tags, list.Tags...)
+
+		u, err = nextLink(u, resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// nextLink resolves the `<...>; rel="next"` Link header of a page.
+func nextLink(base *url.URL, link string) (*url.URL, error) {
+	if link == "" {
+		return nil, nil
+	}
+	start := strings.Index(link, "<")
+	end := strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return nil, nil
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Link header %q: %w", link, err)
+	}
+	return base.ResolveReference(next), nil
+}
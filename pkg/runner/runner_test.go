@@ -0,0 +1,267 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/queuetest"
+	"github.com/OpenCIDN/OpenCIDN/internal/registrytest"
+	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
+)
+
+func newTestRunner(t *testing.T, registry *registrytest.Registry, queue *queuetest.Queue) (*Runner, *cache.Cache) {
+	t.Helper()
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRunner(
+		WithHttpClient(registry.Client()),
+		WithLogger(slog.Default()),
+		WithCaches(c),
+		WithQueueClient(queue.MessageClient()),
+		WithLease("test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, c
+}
+
+func TestRunnerManifest(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	config := registry.PutBlob([]byte(`{}`))
+	layer := registry.PutBlob([]byte("layer"))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + config + `","size":2},"layers":[{"digest":"` + layer + `","size":5}]}`)
+	manifestDigest := registry.PutManifest("library/busybox", "latest", manifest)
+
+	tests := []struct {
+		name string
+		deep bool
+		// cached is set when a shallow sync cached the manifest before.
+		cached    bool
+		wantBlobs []string
+	}{
+		{
+			name: "shallow",
+		},
+		{
+			name:      "deep",
+			deep:      true,
+			wantBlobs: []string{config, layer},
+		},
+		{
+			name:   "shallow cached",
+			cached: true,
+		},
+		{
+			name:      "deep cached",
+			deep:      true,
+			cached:    true,
+			wantBlobs: []string{config, layer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := queuetest.NewQueue(t)
+			r, c := newTestRunner(t, registry, queue)
+			if tt.cached {
+				_, _, _, err := c.PutManifestContent(ctx, registry.Host(), "library/busybox", "latest", manifest)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := r.manifest(ctx, 0, registry.Host(), "library/busybox", "latest", tt.deep, false, 0, &atomic.Int64{}, &atomic.Int64{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, got, _, err := c.GetManifestContent(ctx, registry.Host(), "library/busybox", "latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != manifestDigest {
+				t.Errorf("cached manifest = %s, want %s", got, manifestDigest)
+			}
+
+			var blobs []string
+			for _, m := range queue.Messages() {
+				if m.Data.Kind == model.KindBlob {
+					blobs = append(blobs, m.Content)
+				}
+			}
+			sort.Strings(blobs)
+			want := append([]string(nil), tt.wantBlobs...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(blobs, want) {
+				t.Errorf("queued blobs = %v, want %v", blobs, want)
+			}
+		})
+	}
+}
+
+func TestRunnerBlob(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	content := []byte("layer")
+	blob := registry.PutBlob(content)
+
+	r, c := newTestRunner(t, registry, queuetest.NewQueue(t))
+
+	for _, size := range []int64{0, int64(len(content))} {
+		err := r.blob(ctx, registry.Host(), "library/busybox", blob, size, &atomic.Int64{}, &atomic.Int64{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := c.GetBlobContent(ctx, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("cached blob = %q, want %q", got, content)
+	}
+}
+
+func TestRunnerSyncTagWatch(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	manifestDigest := registry.PutManifest("library/busybox", "latest", []byte(`{"schemaVersion":2}`))
+
+	queue := queuetest.NewQueue(t)
+	r, _ := newTestRunner(t, registry, queue)
+
+	// A shallow sync of the tag is still pending.
+	_, err := queue.MessageClient().Create(ctx, registry.Host()+"/library/busybox:latest", 0, model.MessageAttr{
+		Kind:  model.KindManifest,
+		Host:  registry.Host(),
+		Image: "library/busybox",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tw := client.TagWatchResponse{
+		Repository: registry.Host() + "/library/busybox",
+		Spec:       model.TagWatchSpec{Tags: []string{"missing", "latest"}},
+		Status:     model.TagWatchStatus{Digests: map[string]string{"missing": "sha256:old"}},
+	}
+	digests := map[string]string{}
+	err = r.syncTagWatch(ctx, registry.Host(), "library/busybox", tw, digests)
+	if err == nil {
+		t.Error("syncTagWatch() = nil, want the error of the missing tag")
+	}
+	want := map[string]string{"latest": manifestDigest}
+	if !reflect.DeepEqual(digests, want) {
+		t.Errorf("digests = %v, want %v", digests, want)
+	}
+
+	var deep []string
+	for _, m := range queue.Messages() {
+		if m.Data.Deep {
+			deep = append(deep, m.Content)
+		}
+	}
+	wantDeep := []string{registry.Host() + "/library/busybox@" + manifestDigest}
+	if !reflect.DeepEqual(deep, wantDeep) {
+		t.Errorf("deep messages = %v, want %v", deep, wantDeep)
+	}
+}
+
+func TestRunnerManifestReferrers(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+	config := registry.PutBlob([]byte(`{}`))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + config + `","size":2},"layers":[]}`)
+	manifestDigest := registry.PutManifest("library/busybox", "latest", manifest)
+	signatureTag := strings.Replace(manifestDigest, ":", "-", 1) + ".sig"
+	registry.PutManifest("library/busybox", signatureTag, manifest)
+	signature := registry.Host() + "/library/busybox:" + signatureTag
+
+	tests := []struct {
+		name      string
+		referrers bool
+		want      []string
+	}{
+		{name: "top level", referrers: true, want: []string{signature}},
+		// Referrers do not follow referrers of their own.
+		{name: "referrer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := queuetest.NewQueue(t)
+			r, _ := newTestRunner(t, registry, queue)
+
+			err := r.manifest(ctx, 0, registry.Host(), "library/busybox", "latest", true, tt.referrers, 0, &atomic.Int64{}, &atomic.Int64{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range queue.Messages() {
+				if m.Data.Referrer {
+					got = append(got, m.Content)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued referrers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerHeartbeatRateLimited(t *testing.T) {
+	ctx := context.Background()
+	registry := registrytest.NewRegistry(t)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus model.MessageStatus
+	}{
+		{name: "rate limited", err: fmt.Errorf("failed to get blob: status code 429"), wantStatus: model.StatusPending},
+		{name: "not found", err: fmt.Errorf("failed to get blob: status code 404"), wantStatus: model.StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := queuetest.NewQueue(t)
+			r, _ := newTestRunner(t, registry, queue)
+			r.rateLimits = transport.NewRateLimits()
+
+			mc := queue.MessageClient()
+			mr, err := mc.Create(ctx, "sha256:blob", 0, model.MessageAttr{Kind: model.KindBlob})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = mc.Consume(ctx, mr.MessageID, r.lease)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errCh := make(chan error, 1)
+			errCh <- tt.err
+			_ = r.heartbeat(ctx, mr.MessageID, &atomic.Int64{}, &atomic.Int64{}, errCh)
+
+			got, err := mc.Get(ctx, mr.MessageID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+)
+
+// uploadsDir holds the files being written until they are committed.
+const uploadsDir = "_uploads"
+
+// FileSystem stores files under a local directory. Writes are staged and
+// renamed into place on commit, so readers never see partial files.
+type FileSystem struct {
+	root string
+}
+
+var _ storage.Driver = (*FileSystem)(nil)
+
+func NewFileSystem(root string) (*FileSystem, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Join(root, uploadsDir), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("create storage directory: %w", err)
+	}
+	return &FileSystem{
+		root: root,
+	}, nil
+}
+
+func (f *FileSystem) fullPath(p string) string {
+	return filepath.Join(f.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+// uploadPath is where the upload of p is kept between a writer closed without
+// commit and the writer resuming it.
+func (f *FileSystem) uploadPath(p string) string {
+	sum := sha256.Sum256([]byte(path.Clean("/" + p)))
+	return filepath.Join(f.root, uploadsDir, hex.EncodeToString(sum[:]))
+}
+
+// Writer starts writing p from scratch into a staging file of its own, so
+// concurrent writers of the same path do not see each other's content.
+func (f *FileSystem) Writer(ctx context.Context, p string) (storage.FileWriter, error) {
+	resume := f.uploadPath(p)
+	file, err := os.CreateTemp(filepath.Dir(resume), filepath.Base(resume)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriter{
+		file:   file,
+		path:   f.fullPath(p),
+		resume: resume,
+	}, nil
+}
+
+// WriterWithAppend resumes the upload of p left by a writer closed without
+// commit, it fails if there is none. The upload is taken over, so only one
+// writer resumes it.
+func (f *FileSystem) WriterWithAppend(ctx context.Context, p string) (storage.FileWriter, error) {
+	resume := f.uploadPath(p)
+	tmp, err := os.CreateTemp(filepath.Dir(resume), filepath.Base(resume)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+
+	err = os.Rename(resume, tmp.Name())
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	file, err := os.OpenFile(tmp.Name(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &FileWriter{
+		file:   file,
+		path:   f.fullPath(p),
+		resume: resume,
+		size:   stat.Size(),
+	}, nil
+}
+
+func (f *FileSystem) PutContent(ctx context.Context, p string, content []byte) error {
+	full := f.fullPath(p)
+	err := os.MkdirAll(filepath.Dir(full), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(full), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, full)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (f *FileSystem) Delete(ctx context.Context, p string) error {
+	full := f.fullPath(p)
+	_, err := os.Lstat(full)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(full)
+}
+
+func (f *FileSystem) Reader(ctx context.Context, p string) (io.ReadCloser, error) {
+	return os.Open(f.fullPath(p))
+}
+
+func (f *FileSystem) ReaderWithOffset(ctx context.Context, p string, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(f.fullPath(p))
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *FileSystem) GetContent(ctx context.Context, p string) ([]byte, error) {
+	return os.ReadFile(f.fullPath(p))
+}
+
+func (f *FileSystem) Stat(ctx context.Context, p string) (storage.FileInfo, error) {
+	stat, err := os.Stat(f.fullPath(p))
+	if err != nil {
+		return nil, err
+	}
+	return FileInfo{
+		path: path.Clean("/" + p),
+		info: stat,
+	}, nil
+}
+
+// Walk calls fun with every file under p, directories are not reported.
+func (f *FileSystem) Walk(ctx context.Context, p string, fun func(storage.FileInfo) error) error {
+	from := path.Clean("/" + p)
+	err := filepath.WalkDir(f.fullPath(from), func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if d.Name() == uploadsDir && filepath.Dir(full) == f.root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(f.root, full)
+		if err != nil {
+			return err
+		}
+		return fun(FileInfo{
+			path: "/" + filepath.ToSlash(rel),
+			info: info,
+		})
+	})
+	if err != nil && !errors.Is(err, fs.SkipAll) {
+		return err
+	}
+	return nil
+}
+
+// List calls fun with the direct children of p, until fun returns false.
+func (f *FileSystem) List(ctx context.Context, p string, fun func(storage.FileInfo) bool) error {
+	from := path.Clean("/" + p)
+	entries, err := os.ReadDir(f.fullPath(from))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if from == "/" && entry.Name() == uploadsDir {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if !fun(FileInfo{
+			path: path.Join(from, entry.Name()),
+			info: info,
+		}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// FileInfo describes a file or directory in the FileSystem.
+type FileInfo struct {
+	path string
+	info fs.FileInfo
+}
+
+func (i FileInfo) Path() string {
+	return i.path
+}
+
+func (i FileInfo) Size() int64 {
+	return i.info.Size()
+}
+
+func (i FileInfo) ModTime() time.Time {
+	return i.info.ModTime()
+}
+
+func (i FileInfo) IsDir() bool {
+	return i.info.IsDir()
+}
+
+// FileWriter writes a staged file, which only replaces its destination on Commit.
+type FileWriter struct {
+	file   *os.File
+	path   string
+	resume string
+	size   int64
+
+	closed    bool
+	committed bool
+	cancelled bool
+}
+
+func (w *FileWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("already closed")
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *FileWriter) Size() int64 {
+	return w.size
+}
+
+// Close keeps the staged file, so the upload can be resumed with WriterWithAppend.
+func (w *FileWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.file.Close()
+	if err != nil || w.committed || w.cancelled {
+		return err
+	}
+	return os.Rename(w.file.Name(), w.resume)
+}
+
+func (w *FileWriter) Cancel(ctx context.Context) error {
+	if w.committed {
+		return fmt.Errorf("already committed")
+	}
+	w.cancelled = true
+	_ = w.Close()
+	return os.Remove(w.file.Name())
+}
+
+func (w *FileWriter) Commit(ctx context.Context) error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	}
+	if w.cancelled {
+		return fmt.Errorf("already cancelled")
+	}
+
+	err := w.file.Sync()
+	if err != nil {
+		return err
+	}
+	w.closed = true
+	err = w.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(w.path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(w.file.Name(), w.path)
+	if err != nil {
+		return err
+	}
+	w.committed = true
+	return nil
+}
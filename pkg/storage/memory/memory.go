@@ -0,0 +1,337 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+)
+
+// Memory stores files in process memory, for tests without an object store.
+// Like the other backends, written files only become visible on commit and
+// uncommitted uploads can be resumed.
+type Memory struct {
+	mut     sync.RWMutex
+	files   map[string]*file
+	uploads map[string][]byte
+}
+
+var _ storage.Driver = (*Memory)(nil)
+
+type file struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		files:   map[string]*file{},
+		uploads: map[string][]byte{},
+	}
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+func notExist(op, p string) error {
+	return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+}
+
+// Writer starts writing p from scratch into a buffer of its own, so
+// concurrent writers of the same path do not see each other's content.
+func (m *Memory) Writer(ctx context.Context, p string) (storage.FileWriter, error) {
+	return &FileWriter{
+		m:    m,
+		path: cleanPath(p),
+	}, nil
+}
+
+// WriterWithAppend resumes the upload of p left by a writer closed without
+// commit, it fails if there is none. The upload is taken over, so only one
+// writer resumes it.
+func (m *Memory) WriterWithAppend(ctx context.Context, p string) (storage.FileWriter, error) {
+	p = cleanPath(p)
+	m.mut.Lock()
+	data, ok := m.uploads[p]
+	delete(m.uploads, p)
+	m.mut.Unlock()
+	if !ok {
+		return nil, notExist("append", p)
+	}
+	return &FileWriter{
+		m:    m,
+		path: p,
+		data: data,
+	}, nil
+}
+
+func (m *Memory) PutContent(ctx context.Context, p string, content []byte) error {
+	p = cleanPath(p)
+	m.mut.Lock()
+	m.files[p] = &file{
+		data:    bytes.Clone(content),
+		modTime: time.Now(),
+	}
+	m.mut.Unlock()
+	return nil
+}
+
+// Delete removes p, or every file under p.
+func (m *Memory) Delete(ctx context.Context, p string) error {
+	p = cleanPath(p)
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	found := false
+	if _, ok := m.files[p]; ok {
+		delete(m.files, p)
+		found = true
+	}
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.files, name)
+			found = true
+		}
+	}
+	if !found {
+		return notExist("delete", p)
+	}
+	return nil
+}
+
+func (m *Memory) get(p string) (*file, bool) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	f, ok := m.files[cleanPath(p)]
+	return f, ok
+}
+
+func (m *Memory) Reader(ctx context.Context, p string) (io.ReadCloser, error) {
+	return m.ReaderWithOffset(ctx, p, 0)
+}
+
+func (m *Memory) ReaderWithOffset(ctx context.Context, p string, offset int64) (io.ReadCloser, error) {
+	f, ok := m.get(p)
+	if !ok {
+		return nil, notExist("open", p)
+	}
+	if offset > int64(len(f.data)) {
+		return nil, fmt.Errorf("offset %d exceeds size %d", offset, len(f.data))
+	}
+	return io.NopCloser(bytes.NewReader(f.data[offset:])), nil
+}
+
+func (m *Memory) GetContent(ctx context.Context, p string) ([]byte, error) {
+	f, ok := m.get(p)
+	if !ok {
+		return nil, notExist("open", p)
+	}
+	return bytes.Clone(f.data), nil
+}
+
+// Stat returns the file at p, or a directory if files exist under p.
+func (m *Memory) Stat(ctx context.Context, p string) (storage.FileInfo, error) {
+	p = cleanPath(p)
+	f, ok := m.get(p)
+	if ok {
+		return FileInfo{
+			path:    p,
+			size:    int64(len(f.data)),
+			modTime: f.modTime,
+		}, nil
+	}
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			return FileInfo{
+				path:  p,
+				isDir: true,
+			}, nil
+		}
+	}
+	return nil, notExist("stat", p)
+}
+
+// Walk calls fun with every file under p in lexical order, directories are
+// not reported.
+func (m *Memory) Walk(ctx context.Context, p string, fun func(storage.FileInfo) error) error {
+	prefix := strings.TrimSuffix(cleanPath(p), "/") + "/"
+
+	m.mut.RLock()
+	var infos []FileInfo
+	for name, f := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			infos = append(infos, FileInfo{
+				path:    name,
+				size:    int64(len(f.data)),
+				modTime: f.modTime,
+			})
+		}
+	}
+	m.mut.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].path < infos[j].path
+	})
+	for _, info := range infos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := fun(info)
+		if err != nil {
+			if err == fs.SkipAll {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// List calls fun with the direct children of p in lexical order, until fun
+// returns false.
+func (m *Memory) List(ctx context.Context, p string, fun func(storage.FileInfo) bool) error {
+	p = cleanPath(p)
+	prefix := strings.TrimSuffix(p, "/") + "/"
+
+	m.mut.RLock()
+	children := map[string]FileInfo{}
+	for name, f := range m.files {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		info := FileInfo{
+			path:  path.Join(p, child),
+			isDir: isDir,
+		}
+		if !isDir {
+			info.size = int64(len(f.data))
+			info.modTime = f.modTime
+		}
+		children[child] = info
+	}
+	m.mut.RUnlock()
+
+	if len(children) == 0 {
+		return notExist("list", p)
+	}
+
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !fun(children[name]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// FileInfo describes a file or directory in the Memory.
+type FileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i FileInfo) Path() string {
+	return i.path
+}
+
+func (i FileInfo) Size() int64 {
+	return i.size
+}
+
+func (i FileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i FileInfo) IsDir() bool {
+	return i.isDir
+}
+
+// FileWriter writes a staged file, which only replaces its destination on Commit.
+type FileWriter struct {
+	m    *Memory
+	path string
+	data []byte
+
+	closed    bool
+	committed bool
+	cancelled bool
+}
+
+func (w *FileWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("already closed")
+	}
+	w.data = append(w.data, p...)
+	return len(p), nil
+}
+
+func (w *FileWriter) Size() int64 {
+	return int64(len(w.data))
+}
+
+// Close keeps the staged file, so the upload can be resumed with WriterWithAppend.
+func (w *FileWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.committed || w.cancelled {
+		return nil
+	}
+	w.m.mut.Lock()
+	w.m.uploads[w.path] = w.data
+	w.m.mut.Unlock()
+	return nil
+}
+
+func (w *FileWriter) Cancel(ctx context.Context) error {
+	if w.committed {
+		return fmt.Errorf("already committed")
+	}
+	w.cancelled = true
+	w.closed = true
+	w.data = nil
+	return nil
+}
+
+func (w *FileWriter) Commit(ctx context.Context) error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	}
+	if w.cancelled {
+		return fmt.Errorf("already cancelled")
+	}
+
+	w.m.mut.Lock()
+	w.m.files[w.path] = &file{
+		data:    w.data,
+		modTime: time.Now(),
+	}
+	w.m.mut.Unlock()
+
+	w.closed = true
+	w.committed = true
+	return nil
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+)
+
+func TestFileWriterCommit(t *testing.T) {
+	ctx := context.Background()
+	f := NewMemory()
+
+	w, err := f.Writer(ctx, "/a/b/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Stat(ctx, "/a/b/data")
+	if !os.IsNotExist(err) {
+		t.Fatalf("Stat() before commit error = %v, want not exist", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = f.WriterWithAppend(ctx, "/a/b/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Size() != 6 {
+		t.Fatalf("Size() = %d, want 6", w.Size())
+	}
+	_, err = w.Write([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := f.GetContent(ctx, "/a/b/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello world" {
+		t.Fatalf("GetContent() = %q, want %q", content, "hello world")
+	}
+
+	r, err := f.ReaderWithOffset(ctx, "/a/b/data", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	content, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "world" {
+		t.Fatalf("ReaderWithOffset() = %q, want %q", content, "world")
+	}
+
+	_, err = f.WriterWithAppend(ctx, "/a/b/data")
+	if !os.IsNotExist(err) {
+		t.Fatalf("WriterWithAppend() after commit error = %v, want not exist", err)
+	}
+}
+
+func TestFileWriterConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	a, err := m.Writer(ctx, "/a/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Writer(ctx, "/a/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.Write([]byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Write([]byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.(storage.Canceler).Cancel(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := m.GetContent(ctx, "/a/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "first" {
+		t.Fatalf("GetContent() = %q, want %q", content, "first")
+	}
+
+	_, err = m.WriterWithAppend(ctx, "/a/data")
+	if !os.IsNotExist(err) {
+		t.Errorf("WriterWithAppend() after cancel error = %v, want not exist", err)
+	}
+}
+
+func TestWalkAndList(t *testing.T) {
+	ctx := context.Background()
+	f := NewMemory()
+
+	for _, p := range []string{"/r/a/link", "/r/b/link", "/r/b/c/link"} {
+		err := f.PutContent(ctx, p, []byte(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := f.Writer(ctx, "/r/pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+	err = f.Walk(ctx, "/", func(fi storage.FileInfo) error {
+		walked = append(walked, fi.Path())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/r/a/link", "/r/b/c/link", "/r/b/link"}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk() = %v, want %v", walked, want)
+	}
+
+	var listed []string
+	err = f.List(ctx, "/r", func(fi storage.FileInfo) bool {
+		listed = append(listed, fi.Path())
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"/r/a", "/r/b"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("List() = %v, want %v", listed, want)
+	}
+
+	err = f.Walk(ctx, "/missing", func(fi storage.FileInfo) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Walk() missing error = %v", err)
+	}
+
+	err = f.Delete(ctx, "/r/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Stat(ctx, "/r/b/link")
+	if !os.IsNotExist(err) {
+		t.Errorf("Stat() after delete error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,83 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage"
+	"github.com/wzshiming/sss"
+)
+
+// Driver keeps the cache in S3 compatible storage.
+type Driver struct {
+	s *sss.SSS
+}
+
+var (
+	_ storage.Driver = (*Driver)(nil)
+	_ storage.Signer = (*Driver)(nil)
+)
+
+func NewDriver(s *sss.SSS) *Driver {
+	return &Driver{
+		s: s,
+	}
+}
+
+// NewDriverFromURL opens the storage from a sss://... url.
+func NewDriverFromURL(rawURL string) (*Driver, error) {
+	s, err := sss.NewSSS(sss.WithURL(rawURL))
+	if err != nil {
+		return nil, err
+	}
+	return NewDriver(s), nil
+}
+
+func (d *Driver) Writer(ctx context.Context, path string) (storage.FileWriter, error) {
+	return d.s.Writer(ctx, path)
+}
+
+func (d *Driver) WriterWithAppend(ctx context.Context, path string) (storage.FileWriter, error) {
+	return d.s.WriterWithAppend(ctx, path)
+}
+
+func (d *Driver) PutContent(ctx context.Context, path string, content []byte) error {
+	return d.s.PutContent(ctx, path, content)
+}
+
+func (d *Driver) Delete(ctx context.Context, path string) error {
+	return d.s.Delete(ctx, path)
+}
+
+func (d *Driver) Reader(ctx context.Context, path string) (io.ReadCloser, error) {
+	return d.s.Reader(ctx, path)
+}
+
+func (d *Driver) ReaderWithOffset(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	return d.s.ReaderWithOffset(ctx, path, offset)
+}
+
+func (d *Driver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return d.s.GetContent(ctx, path)
+}
+
+func (d *Driver) Stat(ctx context.Context, path string) (storage.FileInfo, error) {
+	return d.s.Stat(ctx, path)
+}
+
+func (d *Driver) Walk(ctx context.Context, path string, fun func(storage.FileInfo) error) error {
+	return d.s.Walk(ctx, path, func(fi sss.FileInfo) error {
+		return fun(fi)
+	})
+}
+
+func (d *Driver) List(ctx context.Context, path string, fun func(storage.FileInfo) bool) error {
+	return d.s.List(ctx, path, func(fi sss.FileInfo) bool {
+		return fun(fi)
+	})
+}
+
+func (d *Driver) SignGet(path string, expires time.Duration) (string, error) {
+	return d.s.SignGet(path, expires)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Driver is the storage a cache is kept in. Paths are slash separated and
+// absolute, like /docker/registry/v2/blobs/sha256/ab/abcd/data.
+type Driver interface {
+	// Writer starts writing path, the content replaces path on Commit.
+	Writer(ctx context.Context, path string) (FileWriter, error)
+	// WriterWithAppend resumes a write closed without Commit, failing if
+	// there is none.
+	WriterWithAppend(ctx context.Context, path string) (FileWriter, error)
+	PutContent(ctx context.Context, path string, content []byte) error
+	// Delete removes path, or everything under it.
+	Delete(ctx context.Context, path string) error
+	Reader(ctx context.Context, path string) (io.ReadCloser, error)
+	ReaderWithOffset(ctx context.Context, path string, offset int64) (io.ReadCloser, error)
+	GetContent(ctx context.Context, path string) ([]byte, error)
+	Stat(ctx context.Context, path string) (FileInfo, error)
+	// Walk calls fun with every file under path, stopping without error
+	// when fun returns fs.SkipAll.
+	Walk(ctx context.Context, path string, fun func(FileInfo) error) error
+	// List calls fun with the files and directories directly under path,
+	// until fun returns false.
+	List(ctx context.Context, path string, fun func(FileInfo) bool) error
+}
+
+// Signer is implemented by drivers able to hand out links clients download
+// from directly, without it content is served through the proxy.
+type Signer interface {
+	SignGet(path string, expires time.Duration) (string, error)
+}
+
+// Canceler is implemented by writers able to drop what has been written,
+// writers without it are only closed.
+type Canceler interface {
+	Cancel(ctx context.Context) error
+}
+
+type FileInfo interface {
+	Path() string
+	Size() int64
+	ModTime() time.Time
+	IsDir() bool
+}
+
+// FileWriter writes a file. Closing it without Commit keeps what has been
+// written for WriterWithAppend.
+type FileWriter interface {
+	io.WriteCloser
+	Size() int64
+	Commit(ctx context.Context) error
+}
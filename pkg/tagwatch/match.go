@@ -0,0 +1,235 @@
+package tagwatch
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Matcher matches tags against globs like "1.*" and semver ranges like
+// ">=1.25 <2", "~1.2" or "^3.19 || ^4". Pre-release tags only match globs.
+type Matcher struct {
+	globs  []string
+	ranges [][]constraint
+}
+
+// NewMatcher parses the patterns, a tag matching any of them is matched.
+func NewMatcher(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !isRange(p) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid tag glob %q: %w", p, err)
+			}
+			m.globs = append(m.globs, p)
+			continue
+		}
+
+		for _, alt := range strings.Split(p, "||") {
+			cs, err := parseRange(alt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid semver range %q: %w", p, err)
+			}
+			m.ranges = append(m.ranges, cs)
+		}
+	}
+	if len(m.globs) == 0 && len(m.ranges) == 0 {
+		return nil, fmt.Errorf("no tag patterns")
+	}
+	return m, nil
+}
+
+// Match reports whether the tag matches any pattern.
+func (m *Matcher) Match(tag string) bool {
+	for _, g := range m.globs {
+		if ok, _ := path.Match(g, tag); ok {
+			return true
+		}
+	}
+	if len(m.ranges) == 0 {
+		return false
+	}
+
+	v, ok := parseVersion(tag)
+	if !ok || v.pre != "" {
+		return false
+	}
+	for _, cs := range m.ranges {
+		if matchAll(cs, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Literals returns the patterns when all of them are plain tags, so the
+// tags can be checked without listing the repository.
+func (m *Matcher) Literals() ([]string, bool) {
+	if len(m.ranges) != 0 {
+		return nil, false
+	}
+	for _, g := range m.globs {
+		if strings.ContainsAny(g, `*?[\`) {
+			return nil, false
+		}
+	}
+	return m.globs, true
+}
+
+func isRange(p string) bool {
+	return strings.ContainsAny(p, "<>=~^|")
+}
+
+type version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func (v version) compare(o version) int {
+	switch {
+	case v.major != o.major:
+		return cmpInt(v.major, o.major)
+	case v.minor != o.minor:
+		return cmpInt(v.minor, o.minor)
+	default:
+		return cmpInt(v.patch, o.patch)
+	}
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// parseVersion parses tags like "1", "v1.2" or "1.2.3-rc.1", missing parts
+// are zero.
+func parseVersion(s string) (version, bool) {
+	v, _, ok := parsePartialVersion(s)
+	return v, ok
+}
+
+// parsePartialVersion also returns how many of major, minor and patch are
+// given, for the ranges of "~1.2" or "^1".
+func parsePartialVersion(s string) (version, int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	var v version
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		if s[i] == '-' {
+			v.pre = s[i+1:]
+			if j := strings.IndexByte(v.pre, '+'); j >= 0 {
+				v.pre = v.pre[:j]
+			}
+		}
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return version{}, 0, false
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return version{}, 0, false
+		}
+		nums[i] = n
+	}
+	v.major, v.minor, v.patch = nums[0], nums[1], nums[2]
+	return v, len(parts), true
+}
+
+type constraint struct {
+	op string
+	v  version
+}
+
+func (c constraint) match(v version) bool {
+	n := v.compare(c.v)
+	switch c.op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	}
+	return n == 0
+}
+
+func matchAll(cs []constraint, v version) bool {
+	for _, c := range cs {
+		if !c.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRange parses comparators separated by spaces or commas, all of them
+// must match.
+func parseRange(s string) ([]constraint, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty range")
+	}
+
+	var cs []constraint
+	for _, f := range fields {
+		op := ""
+		for _, o := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(f, o) {
+				op = o
+				break
+			}
+		}
+		v, n, ok := parsePartialVersion(strings.TrimPrefix(f, op))
+		if !ok || v.pre != "" {
+			return nil, fmt.Errorf("invalid version %q", f)
+		}
+
+		switch op {
+		case "~":
+			// ~1.2.3 is >=1.2.3 <1.3.0, ~1 is >=1.0.0 <2.0.0.
+			upper := version{major: v.major, minor: v.minor + 1}
+			if n == 1 {
+				upper = version{major: v.major + 1}
+			}
+			cs = append(cs, constraint{">=", v}, constraint{"<", upper})
+		case "^":
+			// ^1.2.3 is >=1.2.3 <2.0.0, ^0.2.3 is >=0.2.3 <0.3.0.
+			upper := version{major: v.major + 1}
+			if v.major == 0 && n > 1 {
+				upper = version{minor: v.minor + 1}
+			}
+			cs = append(cs, constraint{">=", v}, constraint{"<", upper})
+		case "", "=":
+			// A partial version like "1.2" matches all its patches.
+			switch n {
+			case 1:
+				cs = append(cs, constraint{">=", v}, constraint{"<", version{major: v.major + 1}})
+			case 2:
+				cs = append(cs, constraint{">=", v}, constraint{"<", version{major: v.major, minor: v.minor + 1}})
+			default:
+				cs = append(cs, constraint{"=", v})
+			}
+		default:
+			cs = append(cs, constraint{op, v})
+		}
+	}
+	return cs, nil
+}
@@ -0,0 +1,54 @@
+package tagwatch
+
+import (
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		tag      string
+		want     bool
+	}{
+		{patterns: []string{"latest"}, tag: "latest", want: true},
+		{patterns: []string{"1.*"}, tag: "1.25-alpine", want: true},
+		{patterns: []string{"1.*"}, tag: "2.0", want: false},
+		{patterns: []string{">=1.25 <2"}, tag: "1.25.3", want: true},
+		{patterns: []string{">=1.25 <2"}, tag: "v1.26", want: true},
+		{patterns: []string{">=1.25 <2"}, tag: "2.0.0", want: false},
+		{patterns: []string{">=1.25 <2"}, tag: "1.26.0-rc.1", want: false},
+		{patterns: []string{">=1.25 <2"}, tag: "alpine", want: false},
+		{patterns: []string{"~1.2"}, tag: "1.2.9", want: true},
+		{patterns: []string{"~1.2"}, tag: "1.3.0", want: false},
+		{patterns: []string{"^3.19"}, tag: "3.20", want: true},
+		{patterns: []string{"^3.19"}, tag: "4.0", want: false},
+		{patterns: []string{"^0.2.3"}, tag: "0.2.9", want: true},
+		{patterns: []string{"^0.2.3"}, tag: "0.3.0", want: false},
+		{patterns: []string{"^1 || ^3"}, tag: "3.1", want: true},
+		{patterns: []string{"^1 || ^3"}, tag: "2.1", want: false},
+		{patterns: []string{"=1.2"}, tag: "1.2.7", want: true},
+		{patterns: []string{"stable", ">=2"}, tag: "stable", want: true},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.patterns)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q) error: %v", tt.patterns, err)
+		}
+		if got := m.Match(tt.tag); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.patterns, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherInvalid(t *testing.T) {
+	for _, patterns := range [][]string{
+		nil,
+		{"[a-"},
+		{">=x"},
+		{">=1.2.3-rc"},
+	} {
+		if _, err := NewMatcher(patterns); err == nil {
+			t.Errorf("NewMatcher(%q) succeeded, want error", patterns)
+		}
+	}
+}
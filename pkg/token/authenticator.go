@@ -45,7 +45,9 @@ func (c *Authenticator) Authenticate(rw http.ResponseWriter, r *http.Request) {
 	}
 	header := fmt.Sprintf("Bearer realm=%q,service=%q", tokenURL, r.Host)
 
-	if image, ok := getImage(r.URL.Path); ok {
+	if r.URL.Path == "/v2/_catalog" {
+		header += `,scope="registry:catalog:*"`
+	} else if image, ok := getImage(r.URL.Path); ok {
 		header += fmt.Sprintf(`,scope="repository:%s:pull"`, image)
 	}
 
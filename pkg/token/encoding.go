@@ -50,6 +50,7 @@ type Attribute struct {
 	NoBlock       bool `json:"no_block,omitempty"`
 	AllowTagsList bool `json:"allow_tags_list,omitempty"`
 	CacheFirst    bool `json:"cache_first,omitempty"`
+	Offline       bool `json:"offline,omitempty"`
 	Weight        int  `json:"weight,omitempty"`
 
 	Host  string `json:"host,omitempty"`
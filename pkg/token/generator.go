@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/internal/utils"
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
 	"github.com/docker/distribution/registry/api/errcode"
 )
 
@@ -43,6 +44,7 @@ func (g *Generator) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	t, err := g.getToken(r)
 	if err != nil {
+		metrics.TokenRequestsTotal.WithLabelValues("denied").Inc()
 		errcode.ServeJSON(rw, err)
 		return
 	}
@@ -57,10 +59,13 @@ func (g *Generator) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	code, err := g.tokenEncoder.Encode(*t)
 	if err != nil {
 		g.logger.Error("Error encoding token", "error", err)
+		metrics.TokenRequestsTotal.WithLabelValues("error").Inc()
 		errcode.ServeJSON(rw, errcode.ErrorCodeUnknown)
 		return
 	}
 
+	metrics.TokenRequestsTotal.WithLabelValues("issued").Inc()
+
 	json.NewEncoder(rw).Encode(tokenInfo{
 		Token:     code,
 		ExpiresIn: int64(expiresIn),
@@ -87,11 +92,17 @@ func (g *Generator) getToken(r *http.Request) (*Token, error) {
 			return nil, errcode.ErrorCodeDenied.WithMessage(fmt.Sprintf("Invalid scope %q", scope))
 		}
 
-		if scopeSlice[2] != "pull" {
-			return nil, errcode.ErrorCodeDenied.WithMessage("Read Only")
-		}
+		if scopeSlice[0] == "registry" && scopeSlice[1] == "catalog" {
+			if scopeSlice[2] != "*" {
+				return nil, errcode.ErrorCodeDenied.WithMessage("Read Only")
+			}
+		} else {
+			if scopeSlice[2] != "pull" {
+				return nil, errcode.ErrorCodeDenied.WithMessage("Read Only")
+			}
 
-		t.Image = scopeSlice[1]
+			t.Image = scopeSlice[1]
+		}
 	}
 
 	if g.authFunc == nil {
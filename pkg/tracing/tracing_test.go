@@ -0,0 +1,65 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/client"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParentPropagation(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	ctx, span := tracing.Start(context.Background(), "test")
+	defer span.End()
+	want := span.SpanContext().TraceID()
+
+	var got model.MessageAttr
+	srv := httptest.NewServer(tracing.NewHandler("queue", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if id := trace.SpanContextFromContext(r.Context()).TraceID(); id != want {
+			t.Errorf("server span trace = %s, want %s", id, want)
+		}
+		var req client.MessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		got = req.Data
+		rw.WriteHeader(http.StatusCreated)
+		json.NewEncoder(rw).Encode(client.MessageResponse{Content: req.Content, Data: req.Data})
+	})))
+	defer srv.Close()
+
+	_, err := client.NewMessageClient(srv.Client(), srv.URL, "").Create(ctx, "docker.io/library/alpine:latest", 0, model.MessageAttr{})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got.TraceParent == "" {
+		t.Fatal("message traceparent is empty")
+	}
+
+	// A runner picking the message up continues the same trace.
+	consumer := tracing.WithTraceParent(context.Background(), got.TraceParent)
+	_, child := tracing.Start(consumer, "consume")
+	defer child.End()
+	if id := child.SpanContext().TraceID(); id != want {
+		t.Errorf("consumer span trace = %s, want %s", id, want)
+	}
+}
+
+func TestWithTraceParentEmpty(t *testing.T) {
+	ctx := context.Background()
+	if got := tracing.WithTraceParent(ctx, ""); got != ctx {
+		t.Error("WithTraceParent() with an empty traceparent changed the context")
+	}
+	if got := tracing.TraceParent(ctx); got != "" {
+		t.Errorf("TraceParent() = %q, want empty", got)
+	}
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// credentialCooldown is how long a credential rejected by the registry is skipped.
+const credentialCooldown = 5 * time.Minute
+
+type credential struct {
+	authn.AuthConfig
+	key      string
+	badUntil atomic.Int64
+}
+
+// credentialKey identifies a credential for rate limits and cached token
+// transports without exposing its secret.
+func credentialKey(config authn.AuthConfig) string {
+	if config == (authn.AuthConfig{}) {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(config.Username + "\x00" + config.Password + "\x00" + config.Auth + "\x00" + config.IdentityToken + "\x00" + config.RegistryToken))
+	return config.Username + "#" + hex.EncodeToString(sum[:6])
+}
+
+func (c *credential) anonymous() bool {
+	return c.AuthConfig == authn.AuthConfig{}
+}
+
+func (c *credential) usable(now time.Time) bool {
+	return c.badUntil.Load() <= now.UnixNano()
+}
+
+func (c *credential) markBad(now time.Time) {
+	c.badUntil.Store(now.Add(credentialCooldown).UnixNano())
+}
+
+func (c *credential) markGood() {
+	c.badUntil.Store(0)
+}
+
+// credentialPool holds the credentials of one registry host and hands them
+// out round-robin, skipping the ones recently rejected.
+type credentialPool struct {
+	next        atomic.Uint64
+	credentials []*credential
+	// expires is when a pool from a credential source is resolved again.
+	expires atomic.Int64
+}
+
+func newCredentialPool(configs []authn.AuthConfig) *credentialPool {
+	p := &credentialPool{}
+	for _, config := range configs {
+		p.credentials = append(p.credentials, &credential{
+			AuthConfig: config,
+			key:        credentialKey(config),
+		})
+	}
+	return p
+}
+
+func (p *credentialPool) equal(configs []authn.AuthConfig) bool {
+	if len(configs) == 0 {
+		configs = []authn.AuthConfig{{}}
+	}
+	if len(p.credentials) != len(configs) {
+		return false
+	}
+	for i, c := range p.credentials {
+		if c.AuthConfig != configs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var anonymousPool = newCredentialPool([]authn.AuthConfig{{}})
+
+// candidates returns the usable credentials starting at the next in turn, or
+// all of them if none is usable.
+func (p *credentialPool) candidates(now time.Time) []*credential {
+	n := len(p.credentials)
+	start := int((p.next.Add(1) - 1) % uint64(n))
+
+	candidates := make([]*credential, 0, n)
+	for i := 0; i != n; i++ {
+		c := p.credentials[(start+i)%n]
+		if c.usable(now) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) != 0 {
+		return candidates
+	}
+
+	for i := 0; i != n; i++ {
+		candidates = append(candidates, p.credentials[(start+i)%n])
+	}
+	return candidates
+}
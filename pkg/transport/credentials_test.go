@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+func TestCredentialPoolCandidates(t *testing.T) {
+	now := time.Now()
+	p := newCredentialPool([]authn.AuthConfig{
+		{Username: "a"},
+		{Username: "b"},
+		{Username: "c"},
+	})
+
+	usernames := func(cs []*credential) []string {
+		var names []string
+		for _, c := range cs {
+			names = append(names, c.Username)
+		}
+		return names
+	}
+
+	for _, want := range []string{"a", "b", "c", "a"} {
+		got := p.candidates(now)
+		if got[0].Username != want || len(got) != 3 {
+			t.Fatalf("candidates() = %v, want starting at %q", usernames(got), want)
+		}
+	}
+
+	p.credentials[1].markBad(now)
+	got := usernames(p.candidates(now))
+	if len(got) != 2 || got[0] == "b" || got[1] == "b" {
+		t.Fatalf("candidates() = %v, want b skipped", got)
+	}
+
+	for _, c := range p.credentials {
+		c.markBad(now)
+	}
+	if got := p.candidates(now); len(got) != 3 {
+		t.Fatalf("candidates() = %v, want all when none usable", usernames(got))
+	}
+
+	if got := p.candidates(now.Add(credentialCooldown)); len(got) != 3 || !got[0].usable(now.Add(credentialCooldown)) {
+		t.Fatalf("candidates() = %v, want usable after cooldown", usernames(got))
+	}
+}
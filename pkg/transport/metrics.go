@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/metrics"
+)
+
+type metricsTransport struct {
+	baseTransport http.RoundTripper
+}
+
+func NewMetricsTransport(baseTransport http.RoundTripper) http.RoundTripper {
+	return &metricsTransport{
+		baseTransport: baseTransport,
+	}
+}
+
+func (m *metricsTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	start := time.Now()
+	defer func() {
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		metrics.UpstreamRequestDuration.WithLabelValues(req.URL.Host, code).Observe(time.Since(start).Seconds())
+	}()
+
+	return m.baseTransport.RoundTrip(req)
+}
@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// mirrorCooldown is how long an endpoint is skipped after it failed.
+const mirrorCooldown = 30 * time.Second
+
+type mirrorEndpoint struct {
+	host       string
+	pathPrefix string
+	downUntil  atomic.Int64
+}
+
+func (e *mirrorEndpoint) String() string {
+	if e.pathPrefix == "" {
+		return e.host
+	}
+	return e.host + "/" + e.pathPrefix
+}
+
+func (e *mirrorEndpoint) healthy(now time.Time) bool {
+	return e.downUntil.Load() <= now.UnixNano()
+}
+
+func (e *mirrorEndpoint) markDown(now time.Time) {
+	e.downUntil.Store(now.Add(mirrorCooldown).UnixNano())
+}
+
+func (e *mirrorEndpoint) markUp() {
+	e.downUntil.Store(0)
+}
+
+// WithMirrors sets an ordered list of upstream endpoints per registry host,
+// each given as "host=endpoint[,endpoint...]". An endpoint may carry a path
+// prefix, like "harbor.internal/dockerhub", for proxy projects.
+func WithMirrors(mirrors []string) Option {
+	return func(c *Transport) error {
+		m, err := toMirrors(mirrors)
+		if err != nil {
+			return err
+		}
+		c.mirrors = m
+		return nil
+	}
+}
+
+func toMirrors(mirrors []string) (map[string][]*mirrorEndpoint, error) {
+	m := map[string][]*mirrorEndpoint{}
+	for _, mirror := range mirrors {
+		host, endpoints, ok := strings.Cut(mirror, "=")
+		if !ok || host == "" || endpoints == "" {
+			return nil, fmt.Errorf("invalid mirror %q", mirror)
+		}
+		for _, endpoint := range strings.Split(endpoints, ",") {
+			endpoint = strings.Trim(endpoint, "/ ")
+			if endpoint == "" {
+				return nil, fmt.Errorf("invalid mirror %q", mirror)
+			}
+			h, p, _ := strings.Cut(endpoint, "/")
+			m[host] = append(m[host], &mirrorEndpoint{
+				host:       h,
+				pathPrefix: p,
+			})
+		}
+	}
+	return m, nil
+}
+
+func (c *Transport) mirrorRoundTrip(req *http.Request, endpoints []*mirrorEndpoint) (*http.Response, error) {
+	now := time.Now()
+	candidates := make([]*mirrorEndpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.healthy(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = endpoints
+	}
+
+	var errs []error
+	for i, e := range candidates {
+		last := i == len(candidates)-1
+
+		resp, err := c.roundTrip(mirrorRequest(req, e))
+		if err != nil {
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			e.markDown(time.Now())
+			c.logger.Warn("mirror request failed", "host", req.URL.Host, "endpoint", e.String(), "error", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			e.markDown(time.Now())
+			if last {
+				return resp, nil
+			}
+			c.logger.Warn("mirror response unavailable", "host", req.URL.Host, "endpoint", e.String(), "statusCode", resp.StatusCode)
+			resp.Body.Close()
+			continue
+		}
+
+		e.markUp()
+		return resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func mirrorRequest(req *http.Request, e *mirrorEndpoint) *http.Request {
+	r := req.Clone(req.Context())
+	r.Host = ""
+	r.URL.Host = e.host
+	if e.pathPrefix != "" && strings.HasPrefix(r.URL.Path, "/v2/") {
+		r.URL.Path = "/v2/" + e.pathPrefix + "/" + strings.TrimPrefix(r.URL.Path, "/v2/")
+		r.URL.RawPath = ""
+	}
+	return r
+}
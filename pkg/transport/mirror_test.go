@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeRegistry struct {
+	*httptest.Server
+	status   atomic.Int32
+	requests atomic.Int32
+	lastPath atomic.Value
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	f := &fakeRegistry{}
+	f.status.Store(http.StatusOK)
+	f.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		f.requests.Add(1)
+		f.lastPath.Store(r.URL.Path)
+		status := int(f.status.Load())
+		if status == http.StatusTooManyRequests {
+			rw.Header().Set("Retry-After", "20")
+		}
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRegistry) host() string {
+	return strings.TrimPrefix(f.URL, "http://")
+}
+
+func TestMirrorRoundTrip(t *testing.T) {
+	harbor := newFakeRegistry(t)
+	hub := newFakeRegistry(t)
+
+	rateLimits := NewRateLimits()
+	rt, err := NewTransport(
+		WithMirrors([]string{"docker.io=" + harbor.host() + "/dockerhub," + hub.host()}),
+		WithRateLimits(rateLimits),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "http://docker.io/v2/library/busybox/manifests/latest", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get(); got != http.StatusOK {
+		t.Fatalf("status = %d, want %d", got, http.StatusOK)
+	}
+	if got := harbor.lastPath.Load(); got != "/v2/dockerhub/library/busybox/manifests/latest" {
+		t.Errorf("mirror path = %v, want the proxy project prefixed", got)
+	}
+	if hub.requests.Load() != 0 {
+		t.Errorf("fallback requested while the first mirror is healthy")
+	}
+
+	// The first mirror runs out of quota and is skipped until its cooldown passes.
+	harbor.status.Store(http.StatusTooManyRequests)
+	if got := get(); got != http.StatusOK || hub.requests.Load() != 1 {
+		t.Fatalf("status = %d, fallback requests = %d, want served by the fallback", got, hub.requests.Load())
+	}
+	if !rateLimits.Until("docker.io").IsZero() {
+		t.Errorf("Until(docker.io) is set while the fallback has quota left")
+	}
+	harborRequests := harbor.requests.Load()
+	if got := get(); got != http.StatusOK || harbor.requests.Load() != harborRequests {
+		t.Errorf("status = %d, unhealthy mirror requested again", got)
+	}
+	if got := hub.lastPath.Load(); got != "/v2/library/busybox/manifests/latest" {
+		t.Errorf("fallback path = %v", got)
+	}
+
+	// The quota of the registry is the quota of its endpoints.
+	hub.status.Store(http.StatusTooManyRequests)
+	if got := get(); got != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if rateLimits.Until("docker.io").IsZero() {
+		t.Errorf("Until(docker.io) is zero with every endpoint unavailable")
+	}
+	if rateLimits.Delay("docker.io") == 0 {
+		t.Errorf("Delay(docker.io) is zero with every endpoint unavailable")
+	}
+}
+
+func TestRateLimitsMirrors(t *testing.T) {
+	r := NewRateLimits()
+	r.setMirrors("docker.io", []string{"harbor.internal", "registry-1.docker.io"})
+
+	tooMany := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"60"}},
+	}
+	r.observe("registry-1.docker.io", "", tooMany, time.Now())
+	if !r.Until("docker.io").IsZero() {
+		t.Errorf("Until(docker.io) is set while a mirror has quota left")
+	}
+
+	r.observe("harbor.internal", "", tooMany, time.Now())
+	if r.Until("docker.io").IsZero() {
+		t.Errorf("Until(docker.io) is zero with every endpoint exhausted")
+	}
+}
@@ -0,0 +1,282 @@
+package transport
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxRateLimitDelay is the longest work is held back waiting for the quota of a
+// host, beyond it requests fail fast with 429 instead.
+const MaxRateLimitDelay = 30 * time.Second
+
+// defaultRetryAfter is used when an exhausted registry does not say when to retry.
+const defaultRetryAfter = time.Minute
+
+// lowWaterDivisor sets the low-water mark of a quota to 1/lowWaterDivisor of
+// its limit, at least one request. Below it requests are paced to the refill
+// rate of the window, so the quota is never spent to the last request.
+const lowWaterDivisor = 20
+
+func lowWater(limit int) int {
+	return max(limit/lowWaterDivisor, 1)
+}
+
+// RateLimits tracks the quota reported by upstream registries per host and
+// credential, it is shared by the transport and the workers feeding it.
+type RateLimits struct {
+	mut   sync.Mutex
+	hosts map[string]map[string]*rateLimit
+	// mirrors maps a registry host to the endpoints requests for it go to,
+	// whose quota is what is tracked.
+	mirrors map[string][]string
+}
+
+type rateLimit struct {
+	// remaining is the quota left, or -1 if the registry has not reported it.
+	remaining int
+	until     time.Time
+}
+
+func NewRateLimits() *RateLimits {
+	return &RateLimits{
+		hosts:   map[string]map[string]*rateLimit{},
+		mirrors: map[string][]string{},
+	}
+}
+
+func WithRateLimits(rateLimits *RateLimits) Option {
+	return func(c *Transport) error {
+		c.rateLimits = rateLimits
+		return nil
+	}
+}
+
+// setMirrors makes host available as long as one of its endpoints is.
+func (r *RateLimits) setMirrors(host string, endpoints []string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.mirrors[host] = endpoints
+}
+
+func (r *RateLimits) state(host, user string) *rateLimit {
+	users, ok := r.hosts[host]
+	if !ok {
+		users = map[string]*rateLimit{}
+		r.hosts[host] = users
+	}
+	s, ok := users[user]
+	if !ok {
+		s = &rateLimit{remaining: -1}
+		users[user] = s
+	}
+	return s
+}
+
+// pick returns the index of the user with the most quota left on host. If all
+// of them are exhausted it returns the one available first and when that is.
+func (r *RateLimits) pick(host string, users []string, now time.Time) (int, time.Time) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	best, bestRemaining := -1, -1
+	next, nextUntil := 0, time.Time{}
+	for i, user := range users {
+		s := r.state(host, user)
+		if s.until.After(now) {
+			if nextUntil.IsZero() || s.until.Before(nextUntil) {
+				next, nextUntil = i, s.until
+			}
+			continue
+		}
+
+		remaining := s.remaining
+		if remaining < 0 {
+			remaining = math.MaxInt
+		}
+		if remaining > bestRemaining {
+			best, bestRemaining = i, remaining
+		}
+	}
+
+	if best < 0 {
+		return next, nextUntil
+	}
+	return best, time.Time{}
+}
+
+func (r *RateLimits) observe(host, user string, resp *http.Response, now time.Time) {
+	limit, window, hasLimit := parseRateLimit(resp.Header.Get("RateLimit-Limit"))
+	remaining, _, hasRemaining := parseRateLimit(resp.Header.Get("RateLimit-Remaining"))
+	retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	tooMany := resp.StatusCode == http.StatusTooManyRequests
+	if !hasRemaining && !tooMany {
+		return
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	s := r.state(host, user)
+	if tooMany {
+		s.remaining = 0
+	} else {
+		s.remaining = remaining
+	}
+
+	if s.remaining > 0 && (!hasLimit || s.remaining > lowWater(limit)) {
+		s.until = time.Time{}
+		return
+	}
+
+	switch {
+	case hasRetryAfter:
+		s.until = now.Add(retryAfter)
+	case hasLimit && limit > 0 && window > 0:
+		// The window slides, so one more request fits after window/limit.
+		s.until = now.Add(window / time.Duration(limit))
+	default:
+		s.until = now.Add(defaultRetryAfter)
+	}
+}
+
+// Until returns when host is expected to accept requests again, or the zero
+// time if at least one of its credentials, on one of its mirror endpoints,
+// has quota left.
+func (r *RateLimits) Until(host string) time.Time {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return r.until(host, time.Now())
+}
+
+func (r *RateLimits) until(host string, now time.Time) time.Time {
+	if endpoints, ok := r.mirrors[host]; ok {
+		var until time.Time
+		for _, endpoint := range endpoints {
+			u := r.endpointUntil(endpoint, now)
+			if u.IsZero() {
+				return time.Time{}
+			}
+			if until.IsZero() || u.Before(until) {
+				until = u
+			}
+		}
+		return until
+	}
+	return r.endpointUntil(host, now)
+}
+
+func (r *RateLimits) endpointUntil(host string, now time.Time) time.Time {
+	var until time.Time
+	for _, s := range r.hosts[host] {
+		if !s.until.After(now) {
+			return time.Time{}
+		}
+		if until.IsZero() || s.until.Before(until) {
+			until = s.until
+		}
+	}
+	return until
+}
+
+// Next returns the earliest time a currently exhausted host becomes available,
+// or the zero time if no host is exhausted.
+func (r *RateLimits) Next() time.Time {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	for host := range r.hosts {
+		until := r.endpointUntil(host, now)
+		if until.IsZero() {
+			continue
+		}
+		if next.IsZero() || until.Before(next) {
+			next = until
+		}
+	}
+	return next
+}
+
+// Delay returns how long requests to host should be held back, or zero if the
+// host is available or stays exhausted for longer than MaxRateLimitDelay.
+func (r *RateLimits) Delay(host string) time.Duration {
+	d := time.Until(r.Until(host))
+	if d <= 0 || d > MaxRateLimitDelay {
+		return 0
+	}
+	return d
+}
+
+// parseRateLimit parses values like "100;w=21600" as sent by Docker Hub.
+func parseRateLimit(value string) (int, time.Duration, bool) {
+	if value == "" {
+		return 0, 0, false
+	}
+	n, params, _ := strings.Cut(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	var window time.Duration
+	for _, param := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || k != "w" {
+			continue
+		}
+		w, err := strconv.Atoi(v)
+		if err == nil {
+			window = time.Duration(w) * time.Second
+		}
+	}
+	return count, window, true
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(value); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+const rateLimitedBody = `{"errors":[{"code":"TOOMANYREQUESTS","message":"upstream rate limit exceeded"}]}`
+
+// rateLimitedResponse answers for an exhausted host without contacting it.
+func rateLimitedResponse(req *http.Request, until time.Time) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rateLimitedBody)),
+		ContentLength: int64(len(rateLimitedBody)),
+		Request:       req,
+	}
+}
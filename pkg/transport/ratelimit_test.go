@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantCount  int
+		wantWindow time.Duration
+		wantOk     bool
+	}{
+		{
+			value:      "100;w=21600",
+			wantCount:  100,
+			wantWindow: 6 * time.Hour,
+			wantOk:     true,
+		},
+		{
+			value:     "76",
+			wantCount: 76,
+			wantOk:    true,
+		},
+		{
+			value:  "",
+			wantOk: false,
+		},
+		{
+			value:  "x;w=21600",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			count, window, ok := parseRateLimit(tt.value)
+			if ok != tt.wantOk {
+				t.Fatalf("parseRateLimit() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if count != tt.wantCount || window != tt.wantWindow {
+				t.Errorf("parseRateLimit() = %v, %v, want %v, %v", count, window, tt.wantCount, tt.wantWindow)
+			}
+		})
+	}
+}
+
+func TestRateLimitsPick(t *testing.T) {
+	now := time.Now()
+	users := []string{"a", "b"}
+	r := NewRateLimits()
+
+	i, until := r.pick("docker.io", users, now)
+	if i != 0 || !until.IsZero() {
+		t.Fatalf("pick() = %v, %v, want first user", i, until)
+	}
+
+	r.observe("docker.io", "a", &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"60"}},
+	}, now)
+
+	i, until = r.pick("docker.io", users, now)
+	if i != 1 || !until.IsZero() {
+		t.Fatalf("pick() = %v, %v, want second user", i, until)
+	}
+
+	r.observe("docker.io", "b", &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Ratelimit-Limit": {"100;w=21600"}, "Ratelimit-Remaining": {"0;w=21600"}},
+	}, now)
+
+	i, until = r.pick("docker.io", users, now)
+	if i != 0 || !until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("pick() = %v, %v, want first user after retry-after", i, until)
+	}
+
+	i, until = r.pick("docker.io", users, now.Add(2*time.Minute))
+	if i != 0 || !until.IsZero() {
+		t.Fatalf("pick() = %v, %v, want first user once recovered", i, until)
+	}
+}
+
+func TestRateLimitsLowWater(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		remaining string
+		wantUntil time.Time
+	}{
+		{name: "plenty left", remaining: "50;w=21600"},
+		{name: "above the low-water mark", remaining: "6;w=21600"},
+		{name: "at the low-water mark", remaining: "5;w=21600", wantUntil: now.Add(216 * time.Second)},
+		{name: "exhausted", remaining: "0;w=21600", wantUntil: now.Add(216 * time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRateLimits()
+			r.observe("docker.io", "a", &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Ratelimit-Limit": {"100;w=21600"}, "Ratelimit-Remaining": {tt.remaining}},
+			}, now)
+			if got := r.until("docker.io", now); !got.Equal(tt.wantUntil) {
+				t.Errorf("until() = %v, want %v", got, tt.wantUntil)
+			}
+		})
+	}
+}
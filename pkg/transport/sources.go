@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// credentialRefresh is how long credentials resolved from files, the
+// environment or keychains are used before being resolved again.
+const credentialRefresh = time.Minute
+
+// credentialSource returns the credentials it holds for host, if any.
+type credentialSource func(host string) ([]authn.AuthConfig, error)
+
+// WithUserFiles reads credentials from files with one user:pwd@host per line,
+// a file is read again when it changes.
+func WithUserFiles(paths []string) Option {
+	return func(c *Transport) error {
+		for _, path := range paths {
+			f := &userFile{path: path}
+			_, err := f.credentials("")
+			if err != nil {
+				return err
+			}
+			c.sources = append(c.sources, f.credentials)
+		}
+		return nil
+	}
+}
+
+// WithUserEnvs reads credentials from environment variables holding
+// user:pwd@host entries separated by whitespace.
+func WithUserEnvs(names []string) Option {
+	return func(c *Transport) error {
+		for _, name := range names {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return fmt.Errorf("environment variable %q is not set", name)
+			}
+			userpass, err := toUserAndPass(strings.Fields(value))
+			if err != nil {
+				return fmt.Errorf("environment variable %q: %w", name, err)
+			}
+			c.sources = append(c.sources, func(host string) ([]authn.AuthConfig, error) {
+				return userpass[host], nil
+			})
+		}
+		return nil
+	}
+}
+
+// WithKeychain resolves credentials for hosts not configured otherwise from keychain.
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(c *Transport) error {
+		c.sources = append(c.sources, func(host string) ([]authn.AuthConfig, error) {
+			registry, err := name.NewRegistry(host)
+			if err != nil {
+				return nil, err
+			}
+			auth, err := keychain.Resolve(registry)
+			if err != nil {
+				return nil, err
+			}
+			if auth == authn.Anonymous {
+				return nil, nil
+			}
+			cfg, err := auth.Authorization()
+			if err != nil {
+				return nil, err
+			}
+			if *cfg == (authn.AuthConfig{}) {
+				return nil, nil
+			}
+			return []authn.AuthConfig{*cfg}, nil
+		})
+		return nil
+	}
+}
+
+// WithCredentialHelpers exchanges short-lived credentials through Docker
+// credential helpers, each given as "host=helper". A helper that is not a
+// path runs as docker-credential-<helper>, like ecr-login, gcr or acr-env.
+func WithCredentialHelpers(helpers []string) Option {
+	return func(c *Transport) error {
+		programs := map[string]string{}
+		for _, helper := range helpers {
+			host, program, ok := strings.Cut(helper, "=")
+			if !ok || host == "" || program == "" {
+				return fmt.Errorf("invalid credential helper %q", helper)
+			}
+			if !strings.Contains(program, "/") {
+				program = "docker-credential-" + program
+			}
+			programs[host] = program
+		}
+		c.sources = append(c.sources, func(host string) ([]authn.AuthConfig, error) {
+			program, ok := programs[host]
+			if !ok {
+				return nil, nil
+			}
+			creds, err := client.Get(client.NewShellProgramFunc(program), host)
+			if err != nil {
+				if credentials.IsErrCredentialsNotFound(err) {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("credential helper %q: %w", program, err)
+			}
+			return []authn.AuthConfig{toAuthConfig(creds.Username, creds.Secret)}, nil
+		})
+		return nil
+	}
+}
+
+type userFile struct {
+	path string
+
+	mut      sync.Mutex
+	modTime  time.Time
+	userpass map[string][]authn.AuthConfig
+}
+
+// credentials returns the credentials of host from the file, read again when
+// it changes. The last good credentials are returned along with the error
+// when it can not be read, like while a mounted secret is being swapped.
+func (f *userFile) credentials(host string) ([]authn.AuthConfig, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return f.userpass[host], fmt.Errorf("stat user file: %w", err)
+	}
+
+	if f.userpass == nil || !stat.ModTime().Equal(f.modTime) {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return f.userpass[host], fmt.Errorf("read user file: %w", err)
+		}
+
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+
+		userpass, err := toUserAndPass(lines)
+		if err != nil {
+			return f.userpass[host], fmt.Errorf("user file %q: %w", f.path, err)
+		}
+		f.userpass = userpass
+		f.modTime = stat.ModTime()
+	}
+
+	return f.userpass[host], nil
+}
+
+type dockerConfigKeychain struct {
+	path string
+}
+
+// NewDockerConfigKeychain resolves credentials from the Docker config.json at
+// path, including its credential helpers. The file is read on every resolve.
+func NewDockerConfigKeychain(path string) authn.Keychain {
+	return &dockerConfigKeychain{
+		path: path,
+	}
+}
+
+func (k *dockerConfigKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	f, err := os.Open(k.path)
+	if err != nil {
+		return nil, fmt.Errorf("open docker config: %w", err)
+	}
+	defer f.Close()
+
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("load docker config: %w", err)
+	}
+
+	key := target.RegistryStr()
+	switch key {
+	case name.DefaultRegistry, "docker.io", "registry-1.docker.io":
+		key = authn.DefaultAuthKey
+	}
+
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, fmt.Errorf("get auth config for %q: %w", key, err)
+	}
+
+	auth := authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}
+	if auth == (authn.AuthConfig{}) {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(auth), nil
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUserFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	err := os.WriteFile(path, []byte("# accounts\na:1@docker.io\nb:2@docker.io\n\nc:3@ghcr.io\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &userFile{path: path}
+	got, err := f.credentials("registry-1.docker.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Username != "a" || got[1].Username != "b" {
+		t.Fatalf("credentials() = %v, want a and b", got)
+	}
+
+	err = os.WriteFile(path, []byte("d:4@ghcr.io\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Second)
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = f.credentials("ghcr.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Username != "d" || got[0].Password != "4" {
+		t.Fatalf("credentials() = %v, want d after reload", got)
+	}
+
+	// The last good credentials are kept while the file is being swapped.
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = f.credentials("ghcr.io")
+	if err == nil {
+		t.Error("credentials() error = nil with the file missing")
+	}
+	if len(got) != 1 || got[0].Username != "d" {
+		t.Fatalf("credentials() = %v, want d kept", got)
+	}
+}
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/OpenCIDN/OpenCIDN/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type tracingTransport struct {
+	baseTransport http.RoundTripper
+}
+
+func NewTracingTransport(baseTransport http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{
+		baseTransport: baseTransport,
+	}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	ctx, span := tracing.Start(req.Context(), "upstream "+req.Method,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+	)
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		tracing.End(span, err)
+	}()
+
+	return t.baseTransport.RoundTrip(req.WithContext(ctx))
+}
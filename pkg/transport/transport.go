@@ -2,11 +2,13 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/OpenCIDN/OpenCIDN/internal/maps"
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -16,8 +18,12 @@ import (
 
 type Transport struct {
 	baseTransport http.RoundTripper
-	userAndPass   map[string]authn.AuthConfig
-	clientset     maps.SyncMap[string, maps.SyncMap[string, http.RoundTripper]]
+	userAndPass   map[string]*credentialPool
+	sources       []credentialSource
+	pools         maps.SyncMap[string, *credentialPool]
+	mirrors       map[string][]*mirrorEndpoint
+	rateLimits    *RateLimits
+	clientset     maps.SyncMap[string, *maps.SyncMap[string, http.RoundTripper]]
 	mutClientset  sync.Mutex
 	logger        *slog.Logger
 }
@@ -44,7 +50,10 @@ func WithUserAndPass(userAndPass []string) Option {
 		if err != nil {
 			return err
 		}
-		c.userAndPass = userpass
+		c.userAndPass = map[string]*credentialPool{}
+		for host, configs := range userpass {
+			c.userAndPass[host] = newCredentialPool(configs)
+		}
 		return nil
 	}
 }
@@ -62,15 +71,63 @@ func NewTransport(opts ...Option) (http.RoundTripper, error) {
 		}
 	}
 
+	// Quota is tracked per endpoint, while callers ask for the registry.
+	if c.rateLimits != nil {
+		for host, endpoints := range c.mirrors {
+			hosts := make([]string, 0, len(endpoints))
+			for _, e := range endpoints {
+				hosts = append(hosts, e.host)
+			}
+			c.rateLimits.setMirrors(host, hosts)
+		}
+	}
+
 	return c, nil
 }
 
-func (c *Transport) getUserpass(host string) (authn.AuthConfig, bool) {
+func (c *Transport) getUserpass(host string) *credentialPool {
 	userpass, ok := c.userAndPass[host]
-	if !ok {
-		return authn.AuthConfig{}, false
+	if ok {
+		return userpass
 	}
-	return userpass, true
+	if len(c.sources) == 0 {
+		return anonymousPool
+	}
+
+	now := time.Now()
+	pool, ok := c.pools.Load(host)
+	if ok && now.UnixNano() < pool.expires.Load() {
+		return pool
+	}
+
+	configs := c.resolveUserpass(host)
+	if !ok || !pool.equal(configs) {
+		if len(configs) == 0 {
+			configs = []authn.AuthConfig{{}}
+		}
+		pool = newCredentialPool(configs)
+		c.pools.Store(host, pool)
+		if ok {
+			c.evictRoundTrippers(host, pool)
+		}
+	}
+	pool.expires.Store(now.Add(credentialRefresh).UnixNano())
+	return pool
+}
+
+// resolveUserpass returns the credentials of the first source that has any for
+// host. A source failing may still return the last credentials it resolved.
+func (c *Transport) resolveUserpass(host string) []authn.AuthConfig {
+	for _, source := range c.sources {
+		configs, err := source(host)
+		if err != nil {
+			c.logger.Warn("failed to resolve credentials", "host", host, "error", err)
+		}
+		if len(configs) != 0 {
+			return configs
+		}
+	}
+	return nil
 }
 
 func parsePath(path string) (string, bool) {
@@ -89,16 +146,88 @@ func parsePath(path string) (string, bool) {
 }
 
 func (c *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if endpoints, ok := c.mirrors[req.URL.Host]; ok &&
+		(req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		return c.mirrorRoundTrip(req, endpoints)
+	}
+
+	return c.roundTrip(req)
+}
+
+func (c *Transport) roundTrip(req *http.Request) (*http.Response, error) {
 	if req.URL.Host == "ollama.com" {
 		return c.baseTransport.RoundTrip(req)
 	}
 
-	rt, err := c.getRoundTripper(req)
+	host, _ := getHostAndSecure(req)
+	now := time.Now()
+	candidates := c.getUserpass(host).candidates(now)
+
+	var u *credential
+	var rt http.RoundTripper
+	for {
+		u = candidates[0]
+		if c.rateLimits != nil {
+			users := make([]string, 0, len(candidates))
+			for _, cred := range candidates {
+				users = append(users, cred.key)
+			}
+			i, until := c.rateLimits.pick(host, users, now)
+			if !until.IsZero() {
+				c.logger.Warn("upstream rate limited", "host", host, "until", until)
+				return rateLimitedResponse(req, until), nil
+			}
+			u = candidates[i]
+		}
+
+		var err error
+		rt, err = c.getRoundTripper(req, u)
+		if err == nil {
+			break
+		}
+		if !c.checkRejected(host, u, err) || len(candidates) == 1 {
+			return nil, err
+		}
+
+		// Nothing was sent yet, so fail over to the next credential.
+		rest := make([]*credential, 0, len(candidates)-1)
+		for _, cred := range candidates {
+			if cred != u {
+				rest = append(rest, cred)
+			}
+		}
+		candidates = rest
+	}
+
+	resp, err := rt.RoundTrip(req)
 	if err != nil {
+		c.checkRejected(host, u, err)
 		return nil, err
 	}
 
-	return rt.RoundTrip(req)
+	if resp.StatusCode < http.StatusBadRequest {
+		u.markGood()
+	}
+
+	if c.rateLimits != nil {
+		c.rateLimits.observe(host, u.key, resp, time.Now())
+	}
+	return resp, nil
+}
+
+// checkRejected marks u bad when the token exchange refused it. A plain 401
+// response is not enough, registries also send it for missing repositories.
+func (c *Transport) checkRejected(host string, u *credential, err error) bool {
+	if u.anonymous() {
+		return false
+	}
+	var tErr *transport.Error
+	if !errors.As(err, &tErr) || tErr.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	c.logger.Warn("upstream credential rejected", "host", host, "username", u.Username, "error", err)
+	u.markBad(time.Now())
+	return true
 }
 
 func getHostAndSecure(req *http.Request) (string, bool) {
@@ -111,20 +240,19 @@ func getHostAndSecure(req *http.Request) (string, bool) {
 	return host, secure
 }
 
-func (c *Transport) getRoundTripper(req *http.Request) (http.RoundTripper, error) {
+func (c *Transport) getRoundTripper(req *http.Request, u *credential) (http.RoundTripper, error) {
 	image, ok := parsePath(req.URL.Path)
 	if !ok {
 		return c.baseTransport, nil
 	}
 
 	host, secure := getHostAndSecure(req)
+	key := u.key + "@" + image
 
-	sets, hasSets := c.clientset.Load(host)
-	if hasSets {
-		tr, ok := sets.Load(image)
-		if ok {
-			return tr, nil
-		}
+	sets, _ := c.clientset.LoadOrStore(host, &maps.SyncMap[string, http.RoundTripper]{})
+	tr, ok := sets.Load(key)
+	if ok {
+		return tr, nil
 	}
 
 	var registry name.Registry
@@ -139,15 +267,15 @@ func (c *Transport) getRoundTripper(req *http.Request) (http.RoundTripper, error
 	}
 
 	var auth authn.Authenticator
-	if u, ok := c.getUserpass(host); ok {
-		auth = authn.FromConfig(u)
+	if !u.anonymous() {
+		auth = authn.FromConfig(u.AuthConfig)
 	} else {
 		auth = authn.Anonymous
 	}
 
 	c.mutClientset.Lock()
 	defer c.mutClientset.Unlock()
-	tr, ok := sets.Load(image)
+	tr, ok = sets.Load(key)
 	if ok {
 		return tr, nil
 	}
@@ -163,12 +291,37 @@ func (c *Transport) getRoundTripper(req *http.Request) (http.RoundTripper, error
 		return nil, err
 	}
 
-	sets.Store(image, tr)
+	sets.Store(key, tr)
 	return tr, nil
 }
 
-func toUserAndPass(userpass []string) (map[string]authn.AuthConfig, error) {
-	bc := map[string]authn.AuthConfig{}
+// evictRoundTrippers drops the transports cached for host with credentials
+// that are no longer in its pool, like a rotated password.
+func (c *Transport) evictRoundTrippers(host string, pool *credentialPool) {
+	sets, ok := c.clientset.Load(host)
+	if !ok {
+		return
+	}
+
+	keys := map[string]struct{}{}
+	for _, cred := range pool.credentials {
+		keys[cred.key] = struct{}{}
+	}
+
+	sets.Range(func(key string, _ http.RoundTripper) bool {
+		i := strings.LastIndex(key, "@")
+		if i < 0 {
+			return true
+		}
+		if _, ok := keys[key[:i]]; !ok {
+			sets.Delete(key)
+		}
+		return true
+	})
+}
+
+func toUserAndPass(userpass []string) (map[string][]authn.AuthConfig, error) {
+	bc := map[string][]authn.AuthConfig{}
 	for _, up := range userpass {
 		s := strings.SplitN(up, "@", 3)
 		if len(s) != 2 {
@@ -180,18 +333,32 @@ func toUserAndPass(userpass []string) (map[string]authn.AuthConfig, error) {
 			return nil, fmt.Errorf("invalid userpass %q", up)
 		}
 		host := s[1]
-		user := u[0]
-		pwd := u[1]
-		bc[host] = authn.AuthConfig{
-			Username: user,
-			Password: pwd,
-		}
+		config := toAuthConfig(u[0], u[1])
+		bc[host] = append(bc[host], config)
 		if host == "docker.io" {
-			bc["registry-1.docker.io"] = authn.AuthConfig{
-				Username: user,
-				Password: pwd,
-			}
+			bc["registry-1.docker.io"] = append(bc["registry-1.docker.io"], config)
 		}
 	}
 	return bc, nil
 }
+
+// toAuthConfig follows the credential helper convention where the user
+// "<token>" carries an identity token, used to refresh OAuth2 access tokens.
+// The user "<registry-token>" carries a bearer token sent to the registry as is.
+func toAuthConfig(user, secret string) authn.AuthConfig {
+	switch user {
+	case "<token>":
+		return authn.AuthConfig{
+			Username:      user,
+			IdentityToken: secret,
+		}
+	case "<registry-token>":
+		return authn.AuthConfig{
+			RegistryToken: secret,
+		}
+	}
+	return authn.AuthConfig{
+		Username: user,
+		Password: secret,
+	}
+}
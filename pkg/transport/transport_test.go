@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/maps"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+func TestToUserAndPass(t *testing.T) {
+	tests := []struct {
+		name     string
+		userpass []string
+		want     map[string][]authn.AuthConfig
+		wantErr  bool
+	}{
+		{
+			name:     "basic",
+			userpass: []string{"a:1@ghcr.io", "b:2@ghcr.io"},
+			want: map[string][]authn.AuthConfig{
+				"ghcr.io": {{Username: "a", Password: "1"}, {Username: "b", Password: "2"}},
+			},
+		},
+		{
+			name:     "docker hub alias",
+			userpass: []string{"a:1@docker.io"},
+			want: map[string][]authn.AuthConfig{
+				"docker.io":            {{Username: "a", Password: "1"}},
+				"registry-1.docker.io": {{Username: "a", Password: "1"}},
+			},
+		},
+		{
+			name:     "identity token",
+			userpass: []string{"<token>:refresh@registry.example.com"},
+			want: map[string][]authn.AuthConfig{
+				"registry.example.com": {{Username: "<token>", IdentityToken: "refresh"}},
+			},
+		},
+		{
+			name:     "registry token",
+			userpass: []string{"<registry-token>:bearer@registry.example.com"},
+			want: map[string][]authn.AuthConfig{
+				"registry.example.com": {{RegistryToken: "bearer"}},
+			},
+		},
+		{
+			name:     "missing host",
+			userpass: []string{"a:1"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toUserAndPass(tt.userpass)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toUserAndPass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toUserAndPass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictRoundTrippers(t *testing.T) {
+	c := &Transport{}
+	old := newCredentialPool([]authn.AuthConfig{{Username: "a@example.com", Password: "1"}, {Username: "b", Password: "2"}})
+	sets, _ := c.clientset.LoadOrStore("ghcr.io", &maps.SyncMap[string, http.RoundTripper]{})
+	for _, cred := range old.credentials {
+		sets.Store(cred.key+"@org/app", http.DefaultTransport)
+	}
+
+	// The password of a was rotated.
+	rotated := newCredentialPool([]authn.AuthConfig{{Username: "a@example.com", Password: "3"}, {Username: "b", Password: "2"}})
+	c.evictRoundTrippers("ghcr.io", rotated)
+
+	want := []string{rotated.credentials[1].key + "@org/app"}
+	if got := sets.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached transports = %v, want %v", got, want)
+	}
+}
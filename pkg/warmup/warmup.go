@@ -0,0 +1,166 @@
+package warmup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/OpenCIDN/OpenCIDN/internal/format"
+	"github.com/OpenCIDN/OpenCIDN/internal/utils"
+	"github.com/OpenCIDN/OpenCIDN/pkg/queue/model"
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultHost is the registry of references without one, like "busybox".
+const DefaultHost = "docker.io"
+
+// Reference is an image to warm up, either by tag or by digest.
+type Reference struct {
+	Host   string
+	Image  string
+	Tag    string
+	Digest string
+}
+
+// String returns the content of the manifest message fetching the reference,
+// "host/image:tag" or "host/image@digest".
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return r.Host + "/" + r.Image + "@" + r.Digest
+	}
+	return r.Host + "/" + r.Image + ":" + r.Tag
+}
+
+// ParseReference parses an image reference like "busybox", "ghcr.io/org/app:v1"
+// or "quay.io/org/app@sha256:...", filling the default host and the latest tag.
+// A reference with both a tag and a digest is pinned to the digest.
+func ParseReference(ref string) (Reference, error) {
+	name := ref
+	var r Reference
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		d, err := digest.Parse(name[i+1:])
+		if err != nil {
+			return Reference{}, fmt.Errorf("invalid digest of %q: %w", ref, err)
+		}
+		r.Digest = d.String()
+		name = name[:i]
+	}
+
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if r.Tag == "" {
+		r.Tag = "latest"
+	}
+
+	host := DefaultHost
+	if i := strings.Index(name, "/"); i > 0 {
+		first := name[:i]
+		if first == "localhost" || strings.ContainsAny(first, ".:") && format.IsDomainName(strings.Split(first, ":")[0]) {
+			host = first
+			name = name[i+1:]
+		}
+	}
+	if name == "" || strings.ContainsAny(name, ": @") {
+		return Reference{}, fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	r.Host, r.Image = utils.CorrectImage(host, name)
+	return r, nil
+}
+
+// ParseImages reads image references from a list with one reference per
+// line, or from the "image:" fields of Kubernetes manifests and rendered
+// Helm charts. Duplicates are dropped, the order is kept.
+func ParseImages(r io.Reader) ([]string, error) {
+	var images []string
+	seen := map[string]struct{}{}
+	add := func(image string) {
+		if image == "" {
+			return
+		}
+		if _, ok := seen[image]; ok {
+			return
+		}
+		seen[image] = struct{}{}
+		images = append(images, image)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "- "))
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.HasPrefix(value, " ") || ok && value == "" {
+			// A YAML field, only images are wanted.
+			if key != "image" {
+				continue
+			}
+			add(unquote(strings.TrimSpace(value)))
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			continue
+		}
+		add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func unquote(s string) string {
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if u, err := strconv.Unquote(`"` + s[1:len(s)-1] + `"`); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Progress aggregates the state of the manifest messages of a warmup.
+type Progress struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+
+	Progress int64 `json:"progress"`
+	Size     int64 `json:"size"`
+}
+
+// Add counts a message in its status.
+func (p *Progress) Add(status model.MessageStatus, data model.MessageAttr) {
+	p.Total++
+	switch status {
+	case model.StatusPending:
+		p.Pending++
+	case model.StatusProcessing:
+		p.Processing++
+	case model.StatusCompleted, model.StatusCleanup:
+		p.Completed++
+	case model.StatusFailed:
+		p.Failed++
+	}
+	p.Progress += data.Progress
+	p.Size += data.Size
+}
+
+// Done reports whether every message is completed or failed.
+func (p *Progress) Done() bool {
+	return p.Pending == 0 && p.Processing == 0
+}
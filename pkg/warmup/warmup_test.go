@@ -0,0 +1,87 @@
+package warmup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	sum := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "busybox", want: "registry-1.docker.io/library/busybox:latest"},
+		{ref: "nginx:1.25", want: "registry-1.docker.io/library/nginx:1.25"},
+		{ref: "bitnami/redis:7", want: "registry-1.docker.io/bitnami/redis:7"},
+		{ref: "ghcr.io/org/app:v1", want: "ghcr.io/org/app:v1"},
+		{ref: "localhost:5000/app", want: "localhost:5000/app:latest"},
+		{ref: "quay.io/org/app@" + sum, want: "quay.io/org/app@" + sum},
+		{ref: "quay.io/org/app:v1@" + sum, want: "quay.io/org/app@" + sum},
+		{ref: "quay.io/org/app@sha256:bad", wantErr: true},
+		{ref: "ghcr.io/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseReference() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "list",
+			content: "busybox\n# comment\n\nghcr.io/org/app:v1\nbusybox\n",
+			want:    []string{"busybox", "ghcr.io/org/app:v1"},
+		},
+		{
+			name: "kubernetes",
+			content: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - image: "busybox:1.36"
+      containers:
+      - name: app
+        image: ghcr.io/org/app:v1 # pinned
+        ports:
+        - containerPort: 80
+---
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: 'nginx'
+`,
+			want: []string{"busybox:1.36", "ghcr.io/org/app:v1", "nginx"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImages(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ func TestAll(t *testing.T) {
 	envs := []func() (*httptest.Server, string, func()){
 		OnlyForward,
 		WithCache,
+		WithMemoryCache,
 	}
 	for _, env := range envs {
 		server, name, done := env()
@@ -11,6 +11,8 @@ import (
 	"github.com/OpenCIDN/OpenCIDN/pkg/cache"
 	"github.com/OpenCIDN/OpenCIDN/pkg/gateway"
 	"github.com/OpenCIDN/OpenCIDN/pkg/manifests"
+	"github.com/OpenCIDN/OpenCIDN/pkg/storage/memory"
+	storages3 "github.com/OpenCIDN/OpenCIDN/pkg/storage/s3"
 	"github.com/OpenCIDN/OpenCIDN/pkg/transport"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -101,7 +103,7 @@ func WithCache() (*httptest.Server, string, func()) {
 		Transport: tp,
 	}
 
-	c, err := cache.NewCache(cache.WithStorageDriver(s))
+	c, err := cache.NewCache(cache.WithStorageDriver(storages3.NewDriver(s)))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -133,3 +135,47 @@ func WithCache() (*httptest.Server, string, func()) {
 		}
 	}
 }
+
+func WithMemoryCache() (*httptest.Server, string, func()) {
+	transportOpts := []transport.Option{
+		transport.WithUserAndPass(nil),
+	}
+
+	tp, err := transport.NewTransport(transportOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tp = transport.NewLogTransport(tp, slog.Default(), 0)
+
+	httpClient := &http.Client{
+		Transport: tp,
+	}
+
+	c, err := cache.NewCache(cache.WithStorageDriver(memory.NewMemory()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest, err := manifests.NewManifests(
+		manifests.WithClient(httpClient),
+		manifests.WithCache(c),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gw, err := gateway.NewGateway(
+		gateway.WithClient(httpClient),
+		gateway.WithManifests(manifest),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/v2/", gw)
+
+	return httptest.NewServer(mux), "with memory cache", func() {}
+}